@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"url-shortener/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewAPIKey(t *testing.T) {
+	key, secret, err := NewAPIKey("user-1", "ci")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(secret, APIKeyPrefix))
+	assert.True(t, strings.HasPrefix(secret, key.Prefix))
+	assert.Equal(t, HashAPIKey(secret), key.KeyHash)
+	assert.NotContains(t, key.KeyHash, secret)
+
+	_, other, err := NewAPIKey("user-1", "ci")
+	assert.NoError(t, err)
+	assert.NotEqual(t, secret, other)
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	key, secret, _ := NewAPIKey("user-1", "ci")
+	key, _ = memoryStore.CreateAPIKey(key)
+
+	now := time.Now()
+	user, err := AuthenticateAPIKey(memoryStore, secret, now)
+	assert.NoError(t, err)
+	assert.Equal(t, User{Id: "user-1", Role: RoleUser, APIKeyId: key.Id}, user)
+
+	// The last use is recorded at most once per interval
+	_, _ = AuthenticateAPIKey(memoryStore, secret, now.Add(time.Second))
+	stored, _ := memoryStore.RetrieveAPIKey(key.KeyHash)
+	assert.True(t, stored.LastUsedAt.Equal(now))
+	_, _ = AuthenticateAPIKey(memoryStore, secret, now.Add(touchInterval))
+	stored, _ = memoryStore.RetrieveAPIKey(key.KeyHash)
+	assert.True(t, stored.LastUsedAt.Equal(now.Add(touchInterval)))
+
+	_, err = AuthenticateAPIKey(memoryStore, "not-a-key", now)
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+	_, err = AuthenticateAPIKey(memoryStore, secret+"x", now)
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+
+	assert.NoError(t, memoryStore.RevokeAPIKey("user-1", key.Id))
+	_, err = AuthenticateAPIKey(memoryStore, secret, now)
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Values of users.role
+const (
+	RoleUser      = "USER"
+	RoleAdmin     = "ADMIN"
+	RoleModerator = "MODERATOR"
+)
+
+// User is the caller a request was authenticated as
+type User struct {
+	Id       string
+	Role     string
+	APIKeyId string // Set when authenticated with an API key
+}
+
+func (u User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// Moderators and admins review links held back by screening
+func (u User) CanModerate() bool {
+	return u.Role == RoleAdmin || u.Role == RoleModerator
+}
+
+// Context key under which the authenticated user is stored
+const userKey = "auth.user"
+
+func setUser(c *gin.Context, user User) {
+	c.Set(userKey, user)
+}
+
+// CurrentUser returns the authenticated user of the request, if any
+func CurrentUser(c *gin.Context) (User, bool) {
+	value, ok := c.Get(userKey)
+	if !ok {
+		return User{}, false
+	}
+	user, ok := value.(User)
+	return user, ok
+}
+
+// Required rejects requests that carry no valid credentials
+func Required() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := CurrentUser(c); !ok {
+			unauthorized(c, "Authentication required")
+			return
+		}
+		c.Next()
+	}
+}
+
+func unauthorized(c *gin.Context, message string) {
+	c.Header("WWW-Authenticate", `Bearer realm="api"`)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": message})
+}
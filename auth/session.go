@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+	"url-shortener/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Cookies NextAuth keeps the database session token in, depending on
+// whether the site is served over HTTPS
+var SessionCookies = []string{
+	"__Secure-next-auth.session-token",
+	"__Host-next-auth.session-token",
+	"next-auth.session-token",
+}
+
+// Header for clients that pass the session token explicitly instead of
+// "Authorization: Bearer"
+const SessionHeader = "X-Session-Token"
+
+var (
+	ErrInvalidSession = errors.New("invalid session")
+	ErrSessionExpired = errors.New("session expired")
+)
+
+// AuthenticateSession resolves a NextAuth session token to its user
+func AuthenticateSession(sessions store.SessionStore, sessionToken string, now time.Time) (User, error) {
+	session, err := sessions.RetrieveSession(sessionToken)
+	if errors.Is(err, store.ErrNotFound) {
+		return User{}, ErrInvalidSession
+	}
+	if err != nil {
+		return User{}, err
+	}
+	if session.IsExpired(now) {
+		return User{}, ErrSessionExpired
+	}
+
+	role := session.Role
+	if role == "" {
+		role = RoleUser
+	}
+	return User{Id: session.UserId, Role: role}, nil
+}
+
+// Sessions authenticates browser requests with the NextAuth session of the
+// frontend. A token sent in a header must be valid. A stale cookie is only
+// ignored, so that signed-out browsers can still follow short links.
+func Sessions(sessions store.SessionStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := CurrentUser(c); ok {
+			c.Next()
+			return
+		}
+
+		sessionToken, explicit := sessionTokenOf(c)
+		if sessionToken == "" {
+			c.Next()
+			return
+		}
+
+		user, err := AuthenticateSession(sessions, sessionToken, time.Now())
+		switch {
+		case err == nil:
+			setUser(c, user)
+		case errors.Is(err, ErrInvalidSession) || errors.Is(err, ErrSessionExpired):
+			if explicit {
+				unauthorized(c, "Invalid or expired session")
+				return
+			}
+		case errors.Is(err, store.ErrRequiresDatabase) && !explicit:
+			// Sessions live in PostgreSQL; without it cookies carry no identity
+		default:
+			log.Printf("Error validating session: %v", err)
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Authentication is temporarily unavailable"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// The session token of a request and whether it was sent explicitly rather
+// than as a cookie
+func sessionTokenOf(c *gin.Context) (string, bool) {
+	if token := c.GetHeader(SessionHeader); token != "" {
+		return token, true
+	}
+	if token, ok := bearerToken(c); ok {
+		return token, true
+	}
+	for _, name := range SessionCookies {
+		if token, err := c.Cookie(name); err == nil && token != "" {
+			return token, false
+		}
+	}
+	return "", false
+}
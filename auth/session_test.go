@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"url-shortener/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func sessionRouter(memoryStore *store.MemoryStore) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(APIKeys(memoryStore), Sessions(memoryStore))
+	r.GET("/whoami", func(c *gin.Context) {
+		user, ok := CurrentUser(c)
+		if !ok {
+			c.String(http.StatusOK, "anonymous")
+			return
+		}
+		c.String(http.StatusOK, user.Id+" "+user.Role)
+	})
+	return r
+}
+
+func whoami(r http.Handler, setup func(req *http.Request)) (int, string) {
+	req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+	setup(req)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code, w.Body.String()
+}
+
+func TestSessions(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	memoryStore.SaveSession("valid-token", store.Session{UserId: "user-1", Role: RoleAdmin, Expires: time.Now().Add(time.Hour)})
+	memoryStore.SaveSession("expired-token", store.Session{UserId: "user-2", Role: RoleUser, Expires: time.Now().Add(-time.Minute)})
+	r := sessionRouter(memoryStore)
+
+	code, body := whoami(r, func(req *http.Request) {
+		req.AddCookie(&http.Cookie{Name: "next-auth.session-token", Value: "valid-token"})
+	})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "user-1 ADMIN", body)
+
+	code, body = whoami(r, func(req *http.Request) {
+		req.AddCookie(&http.Cookie{Name: "__Secure-next-auth.session-token", Value: "valid-token"})
+	})
+	assert.Equal(t, "user-1 ADMIN", body)
+
+	code, body = whoami(r, func(req *http.Request) { req.Header.Set(SessionHeader, "valid-token") })
+	assert.Equal(t, "user-1 ADMIN", body)
+	code, body = whoami(r, func(req *http.Request) { req.Header.Set("Authorization", "Bearer valid-token") })
+	assert.Equal(t, "user-1 ADMIN", body)
+
+	// Stale cookies are ignored, explicit tokens are rejected
+	code, body = whoami(r, func(req *http.Request) {
+		req.AddCookie(&http.Cookie{Name: "next-auth.session-token", Value: "expired-token"})
+	})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "anonymous", body)
+
+	code, _ = whoami(r, func(req *http.Request) { req.Header.Set(SessionHeader, "expired-token") })
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = whoami(r, func(req *http.Request) { req.Header.Set("Authorization", "Bearer unknown-token") })
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, body = whoami(r, func(req *http.Request) {})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "anonymous", body)
+}
+
+func TestAuthenticateSession(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	expires := time.Now().Add(time.Hour)
+	memoryStore.SaveSession("token", store.Session{UserId: "user-1", Expires: expires})
+
+	user, err := AuthenticateSession(memoryStore, "token", time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, User{Id: "user-1", Role: RoleUser}, user)
+
+	_, err = AuthenticateSession(memoryStore, "token", expires)
+	assert.ErrorIs(t, err, ErrSessionExpired)
+	_, err = AuthenticateSession(memoryStore, "other", time.Now())
+	assert.ErrorIs(t, err, ErrInvalidSession)
+}
@@ -2,8 +2,15 @@
 -- Run this in your PostgreSQL/Supabase SQL Editor
 
 -- Drop existing tables if they exist (be careful in production!)
+DROP TABLE IF EXISTS url_versions CASCADE;
+DROP TABLE IF EXISTS url_tags CASCADE;
 DROP TABLE IF EXISTS url_clicks CASCADE;
 DROP TABLE IF EXISTS urls CASCADE;
+DROP TABLE IF EXISTS tags CASCADE;
+DROP TABLE IF EXISTS campaigns CASCADE;
+DROP TABLE IF EXISTS utm_presets CASCADE;
+DROP TABLE IF EXISTS domains CASCADE;
+DROP TABLE IF EXISTS api_keys CASCADE;
 DROP TABLE IF EXISTS sessions CASCADE;
 DROP TABLE IF EXISTS accounts CASCADE;
 DROP TABLE IF EXISTS verification_tokens CASCADE;
@@ -73,13 +80,72 @@ CREATE TABLE verification_tokens (
     UNIQUE(identifier, token)
 );
 
+-- API keys for programmatic access
+CREATE TABLE api_keys (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL, -- Start of the key, shown in listings
+    key_hash TEXT UNIQUE NOT NULL, -- SHA-256 of the key; the key itself is never stored
+    created_at TIMESTAMP DEFAULT NOW(),
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP
+);
+
+-- Groups a user files links under. Names are unique per user.
+CREATE TABLE tags (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    UNIQUE (user_id, name)
+);
+
+CREATE TABLE campaigns (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    UNIQUE (user_id, name)
+);
+
+-- Custom domains links are served under. Any number of users may register a
+-- host, only one can verify it through the TXT record holding the token.
+CREATE TABLE domains (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    host TEXT NOT NULL, -- Lowercase, in punycode
+    token TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    verified_at TIMESTAMP,
+    UNIQUE (user_id, host)
+);
+
+-- Saved sets of UTM parameters for new links
+CREATE TABLE utm_presets (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    utm_source TEXT,
+    utm_medium TEXT,
+    utm_campaign TEXT,
+    utm_term TEXT,
+    utm_content TEXT,
+    created_at TIMESTAMP DEFAULT NOW(),
+    UNIQUE (user_id, name)
+);
+
 -- URLs table - core functionality
 CREATE TABLE urls (
     id TEXT PRIMARY KEY,
-    short_code TEXT UNIQUE NOT NULL, -- e.g., "abc123"
+    short_code TEXT UNIQUE NOT NULL, -- e.g., "abc123", or "<domain id>/abc123" on a custom domain
     original_url TEXT NOT NULL,
     title TEXT, -- Page title for better UX
     description TEXT, -- Meta description
+    image_url TEXT, -- og:image of the destination
+    site_name TEXT, -- og:site_name of the destination
+    favicon_url TEXT,
+    metadata_fetched_at TIMESTAMP, -- When the destination was last described
     
     -- User relationship
     user_id TEXT REFERENCES users(id) ON DELETE SET NULL, -- Nullable for guest users
@@ -87,7 +153,18 @@ CREATE TABLE urls (
     -- Settings
     is_active BOOLEAN DEFAULT TRUE,
     expires_at TIMESTAMP,
+    deleted_at TIMESTAMP, -- Soft-deleted links keep their code reserved
+    is_custom_alias BOOLEAN DEFAULT FALSE, -- Code chosen by the user, counts against alias quotas
     password TEXT, -- Optional password protection (hashed)
+    quarantine_reason TEXT, -- Set while the destination is held for review
+    campaign_id TEXT REFERENCES campaigns(id) ON DELETE SET NULL, -- At most one campaign per link
+    
+    -- UTM parameters added to the destination when the link was created
+    utm_source TEXT,
+    utm_medium TEXT,
+    utm_campaign TEXT,
+    utm_term TEXT,
+    utm_content TEXT,
     
     -- Analytics
     click_count INTEGER DEFAULT 0,
@@ -120,6 +197,26 @@ CREATE TABLE url_clicks (
     clicked_at TIMESTAMP DEFAULT NOW()
 );
 
+-- Tags: any number per link
+CREATE TABLE url_tags (
+    url_id TEXT NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    tag_id TEXT NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    PRIMARY KEY (url_id, tag_id)
+);
+
+-- Destination history: one row per change of a link's destination
+CREATE TABLE url_versions (
+    id TEXT PRIMARY KEY,
+    url_id TEXT NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL, -- 1 for the first change of the link
+    old_url TEXT NOT NULL,
+    new_url TEXT NOT NULL,
+    changed_by TEXT NOT NULL, -- No foreign key: the record outlives the user
+    changed_at TIMESTAMP DEFAULT NOW(),
+    rolled_back_to INTEGER, -- Version restored by this change, if any
+    UNIQUE (url_id, version)
+);
+
 -- Create indexes for better performance
 CREATE INDEX idx_users_email ON users(email);
 CREATE INDEX idx_users_created_at ON users(created_at);
@@ -130,10 +227,17 @@ CREATE INDEX idx_accounts_provider ON accounts(provider, provider_account_id);
 CREATE INDEX idx_sessions_user_id ON sessions(user_id);
 CREATE INDEX idx_sessions_token ON sessions(session_token);
 
+CREATE INDEX idx_api_keys_user_id ON api_keys(user_id);
+
+CREATE UNIQUE INDEX idx_domains_verified_host ON domains(host) WHERE verified_at IS NOT NULL;
+
 CREATE INDEX idx_urls_short_code ON urls(short_code);
 CREATE INDEX idx_urls_user_id ON urls(user_id);
 CREATE INDEX idx_urls_created_at ON urls(created_at);
 CREATE INDEX idx_urls_is_active ON urls(is_active);
+CREATE INDEX idx_urls_campaign_id ON urls(campaign_id);
+
+CREATE INDEX idx_url_tags_tag_id ON url_tags(tag_id);
 
 CREATE INDEX idx_url_clicks_url_id ON url_clicks(url_id);
 CREATE INDEX idx_url_clicks_user_id ON url_clicks(user_id);
@@ -0,0 +1,145 @@
+// Package domains checks the custom domains users serve their links under.
+// Ownership is proven with a DNS TXT record holding a token issued when the
+// domain is registered.
+package domains
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	"golang.org/x/net/idna"
+)
+
+// Name of the TXT record, below the domain, that proves ownership
+const RecordLabel = "_shrinkr-verification"
+
+// Prefix of the TXT record's value, followed by the domain's token
+const recordValuePrefix = "shrinkr-verification="
+
+// Longest domain name DNS allows
+const maxHostLength = 253
+
+var (
+	ErrInvalidHost    = errors.New("domain must be a host name such as links.example.com, without scheme, port or path")
+	ErrRecordNotFound = errors.New("no verification TXT record found")
+	ErrRecordMismatch = errors.New("the verification TXT record does not contain the expected token")
+)
+
+// Resolver looks up TXT records. *net.Resolver implements it.
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// NormalizeHost validates a host name and returns its canonical form:
+// lowercase, in punycode and without a trailing dot. IP addresses and names
+// without a dot are rejected.
+func NormalizeHost(host string) (string, error) {
+	host = strings.TrimSuffix(strings.TrimSpace(host), ".")
+	if host == "" || strings.ContainsAny(host, "/:@?#[] ") {
+		return "", ErrInvalidHost
+	}
+	if _, err := netip.ParseAddr(host); err == nil {
+		return "", ErrInvalidHost
+	}
+	ascii, err := idna.Lookup.ToASCII(strings.ToLower(host))
+	if err != nil || len(ascii) > maxHostLength || !strings.Contains(ascii, ".") {
+		return "", ErrInvalidHost
+	}
+	return ascii, nil
+}
+
+// Host of a request's Host header, normalized for looking up domains.
+// Returns "" for hosts that cannot be custom domains.
+func RequestHost(hostHeader string) string {
+	host := hostHeader
+	if h, _, err := net.SplitHostPort(hostHeader); err == nil {
+		host = h
+	}
+	normalized, err := NormalizeHost(host)
+	if err != nil {
+		return ""
+	}
+	return normalized
+}
+
+// NewToken returns a random verification token
+func NewToken() (string, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// Name of the TXT record that verifies host
+func RecordName(host string) string {
+	return RecordLabel + "." + host
+}
+
+// Value the TXT record must have
+func RecordValue(token string) string {
+	return recordValuePrefix + token
+}
+
+// Verifier checks TXT records through a resolver
+type Verifier struct {
+	resolver Resolver
+	timeout  time.Duration
+}
+
+// Lookups give up after this long
+const DefaultTimeout = 5 * time.Second
+
+// NewVerifier checks records with resolver, or the system resolver when it
+// is nil
+func NewVerifier(resolver Resolver) *Verifier {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return &Verifier{resolver: resolver, timeout: DefaultTimeout}
+}
+
+// Verify checks that host has a TXT record for token. The errors are
+// ErrRecordNotFound, ErrRecordMismatch or a failed lookup.
+func (v *Verifier) Verify(ctx context.Context, host string, token string) error {
+	ctx, cancel := context.WithTimeout(ctx, v.timeout)
+	defer cancel()
+
+	records, err := v.resolver.LookupTXT(ctx, RecordName(host))
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return ErrRecordNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("looking up %s: %w", RecordName(host), err)
+	}
+	if len(records) == 0 {
+		return ErrRecordNotFound
+	}
+	want := RecordValue(token)
+	for _, record := range records {
+		if strings.TrimSpace(record) == want {
+			return nil
+		}
+	}
+	return ErrRecordMismatch
+}
+
+// StaticResolver answers TXT lookups from a map of record name to values,
+// for tests and setups without DNS
+type StaticResolver map[string][]string
+
+func (r StaticResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	records, ok := r[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return records, nil
+}
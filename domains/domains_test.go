@@ -0,0 +1,56 @@
+package domains
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeHost(t *testing.T) {
+	for input, want := range map[string]string{
+		"Links.Example.com":   "links.example.com",
+		" go.example.org. ":   "go.example.org",
+		"bücher.example":      "xn--bcher-kva.example",
+		"example.com:8080":    "",
+		"https://example.com": "",
+		"example.com/path":    "",
+		"localhost":           "",
+		"192.0.2.1":           "",
+		"":                    "",
+	} {
+		got, err := NormalizeHost(input)
+		if want == "" {
+			assert.ErrorIs(t, err, ErrInvalidHost, input)
+			continue
+		}
+		assert.NoError(t, err, input)
+		assert.Equal(t, want, got, input)
+	}
+
+	assert.Equal(t, "links.example.com", RequestHost("Links.Example.com:443"))
+	assert.Equal(t, "", RequestHost("localhost:9808"))
+	assert.Equal(t, "", RequestHost("[::1]:9808"))
+}
+
+type failingResolver struct{}
+
+func (failingResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	return nil, errors.New("server misbehaving")
+}
+
+func TestVerify(t *testing.T) {
+	verifier := NewVerifier(StaticResolver{
+		RecordName("links.example.com"): {"v=spf1 -all", " " + RecordValue("token-1") + " "},
+		RecordName("other.example.com"): {RecordValue("token-2")},
+	})
+	ctx := context.Background()
+	assert.NoError(t, verifier.Verify(ctx, "links.example.com", "token-1"))
+	assert.ErrorIs(t, verifier.Verify(ctx, "other.example.com", "token-1"), ErrRecordMismatch)
+	assert.ErrorIs(t, verifier.Verify(ctx, "missing.example.com", "token-1"), ErrRecordNotFound)
+
+	err := NewVerifier(failingResolver{}).Verify(ctx, "links.example.com", "token-1")
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, ErrRecordNotFound))
+}
@@ -0,0 +1,95 @@
+package endpoint_handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"url-shortener/auth"
+	"url-shortener/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxAPIKeyNameLength = 100
+
+// Request model for issuing an API key
+type APIKeyCreationRequest struct {
+	Name string `json:"name"`
+}
+
+// CreateAPIKey issues a key for the authenticated user. The secret is only
+// ever returned here.
+func (h *Handler) CreateAPIKey(c *gin.Context) {
+	user, _ := auth.CurrentUser(c)
+
+	var creationRequest APIKeyCreationRequest
+	if err := c.ShouldBindJSON(&creationRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name := strings.TrimSpace(creationRequest.Name)
+	if name == "" || len(name) > maxAPIKeyNameLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name must be between 1 and 100 characters", "field": "name"})
+		return
+	}
+
+	key, secret, err := auth.NewAPIKey(user.Id, name)
+	if err == nil {
+		key, err = h.apiKeys.CreateAPIKey(key)
+	}
+	if !h.writeAPIKeyError(c, err) {
+		return
+	}
+
+	log.Printf("API key %s created for user %s", key.Id, user.Id)
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "api key created successfully, store it now as it will not be shown again",
+		"key":     secret,
+		"api_key": key,
+	})
+}
+
+// ListAPIKeys shows the authenticated user's keys without their secrets
+func (h *Handler) ListAPIKeys(c *gin.Context) {
+	user, _ := auth.CurrentUser(c)
+
+	keys, err := h.apiKeys.ListAPIKeys(user.Id)
+	if !h.writeAPIKeyError(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"api_keys": keys})
+}
+
+// RevokeAPIKey disables one of the authenticated user's keys for good
+func (h *Handler) RevokeAPIKey(c *gin.Context) {
+	user, _ := auth.CurrentUser(c)
+	id := c.Param("id")
+
+	err := h.apiKeys.RevokeAPIKey(user.Id, id)
+	if errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+	if !h.writeAPIKeyError(c, err) {
+		return
+	}
+
+	log.Printf("API key %s revoked by user %s", id, user.Id)
+	c.JSON(http.StatusOK, gin.H{"message": "api key revoked successfully", "id": id})
+}
+
+// Report a failed API key operation. Returns true when there was nothing to
+// report.
+func (h *Handler) writeAPIKeyError(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, store.ErrRequiresDatabase):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Error managing API keys: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to manage API keys", "details": err.Error()})
+	}
+	return false
+}
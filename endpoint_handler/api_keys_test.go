@@ -0,0 +1,144 @@
+package endpoint_handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"url-shortener/auth"
+	"url-shortener/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func authorizedRequest(r http.Handler, method string, path string, key string, body string) (int, map[string]interface{}) {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	_ = json.Unmarshal(w.Body.Bytes(), &response)
+	return w.Code, response
+}
+
+// Issue a key directly in the store, as the bootstrap script does
+func issueAPIKey(t *testing.T, memoryStore *store.MemoryStore, userId string) string {
+	t.Helper()
+	key, secret, err := auth.NewAPIKey(userId, "bootstrap")
+	assert.NoError(t, err)
+	_, err = memoryStore.CreateAPIKey(key)
+	assert.NoError(t, err)
+	return secret
+}
+
+func TestAPIKeyManagement(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	r := setupRouter(memoryStore)
+	bootstrap := issueAPIKey(t, memoryStore, "user-1")
+
+	code, _ := authorizedRequest(r, http.MethodPost, "/api-keys", "", `{"name": "ci"}`)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, response := authorizedRequest(r, http.MethodPost, "/api-keys", bootstrap, `{"name": "ci"}`)
+	assert.Equal(t, http.StatusCreated, code)
+	secret := response["key"].(string)
+	assert.True(t, strings.HasPrefix(secret, auth.APIKeyPrefix))
+	created := response["api_key"].(map[string]interface{})
+	assert.Equal(t, "ci", created["name"])
+	assert.NotContains(t, created, "key_hash")
+
+	code, response = authorizedRequest(r, http.MethodGet, "/api-keys", secret, "")
+	assert.Equal(t, http.StatusOK, code)
+	keys := response["api_keys"].([]interface{})
+	assert.Len(t, keys, 2)
+	assert.Equal(t, "ci", keys[0].(map[string]interface{})["name"])
+	assert.NotNil(t, keys[0].(map[string]interface{})["last_used_at"])
+
+	// Other users cannot revoke the key
+	other := issueAPIKey(t, memoryStore, "user-2")
+	code, _ = authorizedRequest(r, http.MethodDelete, "/api-keys/"+created["id"].(string), other, "")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _ = authorizedRequest(r, http.MethodDelete, "/api-keys/"+created["id"].(string), bootstrap, "")
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = authorizedRequest(r, http.MethodGet, "/api-keys", secret, "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, _ = authorizedRequest(r, http.MethodGet, "/api-keys", auth.APIKeyPrefix+"made-up", "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+func TestAPIKeyOverridesUserId(t *testing.T) {
+	t.Setenv("BASE_URL", "http://short.test/")
+	memoryStore := store.NewMemoryStore()
+	r := setupRouter(memoryStore)
+	key := issueAPIKey(t, memoryStore, "user-1")
+
+	code, _ := authorizedRequest(r, http.MethodPost, "/create-short-url", key,
+		`{"long_url": "https://example.com", "user_id": "user-2", "alias": "owned-by-key"}`)
+	assert.Equal(t, http.StatusOK, code)
+
+	link, err := memoryStore.RetrieveLink("owned-by-key")
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", link.UserId)
+
+	// Claiming another user's ID does not grant access to their links
+	code, _ = authorizedRequest(r, http.MethodPatch, "/links/owned-by-key", issueAPIKey(t, memoryStore, "user-2"),
+		`{"is_active": false, "user_id": "user-1"}`)
+	assert.Equal(t, http.StatusForbidden, code)
+	code, _ = authorizedRequest(r, http.MethodPatch, "/links/owned-by-key", key, `{"is_active": false}`)
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestSessionUsers(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	memoryStore.SaveSession("user-session", store.Session{UserId: "user-1", Role: auth.RoleUser, Expires: time.Now().Add(time.Hour)})
+	memoryStore.SaveSession("admin-session", store.Session{UserId: "admin-1", Role: auth.RoleAdmin, Expires: time.Now().Add(time.Hour)})
+	r := setupRouter(memoryStore)
+
+	code, response := authorizedRequest(r, http.MethodGet, "/me", "user-session", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]interface{}{"user_id": "user-1", "role": "USER", "auth_method": "session"}, response)
+
+	// Signed-in users can issue their first API key
+	code, response = authorizedRequest(r, http.MethodPost, "/api-keys", "user-session", `{"name": "first"}`)
+	assert.Equal(t, http.StatusCreated, code)
+	code, response = authorizedRequest(r, http.MethodGet, "/me", response["key"].(string), "")
+	assert.Equal(t, "api_key", response["auth_method"])
+
+	code, _ = authorizedRequest(r, http.MethodPost, "/create-short-url", "user-session",
+		`{"long_url": "https://example.com", "alias": "session-link"}`)
+	assert.Equal(t, http.StatusOK, code)
+
+	// Admins may manage any link
+	code, _ = authorizedRequest(r, http.MethodPatch, "/links/session-link", "admin-session", `{"is_active": false}`)
+	assert.Equal(t, http.StatusOK, code)
+}
+
+// The frontend creates links for signed-in users from its server, passing
+// their session token on in a header
+func TestCreateShortUrlWithSessionHeader(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	memoryStore.SaveSession("user-session", store.Session{UserId: "user-1", Role: auth.RoleUser, Expires: time.Now().Add(time.Hour)})
+	r := setupRouter(memoryStore)
+
+	req := httptest.NewRequest(http.MethodPost, "/create-short-url", strings.NewReader(`{"longUrl": "https://example.com", "alias": "from-frontend"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(auth.SessionHeader, "user-session")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	link, err := memoryStore.RetrieveLink("from-frontend")
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", link.UserId)
+	code, response := authorizedRequest(r, http.MethodGet, "/me/links", "user-session", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, response["links"], 1)
+}
@@ -0,0 +1,463 @@
+package endpoint_handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"url-shortener/auth"
+	"url-shortener/plan"
+	"url-shortener/screening"
+	shorturl "url-shortener/shorturl"
+	"url-shortener/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Largest bulk request body read, whatever the plan allows
+const maxBulkBodyBytes = 8 << 20
+
+// Outcome of one item of a bulk request. Index is the position in the JSON
+// array or the data row of the CSV file, counting from 0.
+type bulkResult struct {
+	Index     int    `json:"index"`
+	LongUrl   string `json:"long_url,omitempty"`
+	ShortCode string `json:"short_code,omitempty"`
+	ShortUrl  string `json:"short_url,omitempty"`
+	Status    string `json:"status"` // created, quarantined or failed
+	Error     string `json:"error,omitempty"`
+	Code      string `json:"code,omitempty"`
+	Field     string `json:"field,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// One item of a bulk request on its way through validation and saving
+type bulkItem struct {
+	request UrlCreationRequest
+	link    store.Link
+	domain  store.Domain
+	result  bulkResult
+}
+
+func (i *bulkItem) failed() bool {
+	return i.result.Status == "failed"
+}
+
+func (i *bulkItem) fail(field string, code string, err error) {
+	i.result.Status = "failed"
+	i.result.Field = field
+	i.result.Code = code
+	i.result.Error = err.Error()
+}
+
+// CreateLinksBulk creates many links for the authenticated user from a JSON
+// array of creation requests or a CSV file, sent as the body or as the file
+// field of a form upload. Items are checked and saved independently and
+// each gets its own result; the number of items is capped by the plan.
+func (h *Handler) CreateLinksBulk(c *gin.Context) {
+	user, ok := auth.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBulkBodyBytes)
+	items, err := parseBulkItems(c)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("request body must be at most %d bytes", maxBulkBodyBytes)})
+		return
+	case errors.Is(err, errUnsupportedBulkFormat):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case len(items) == 0:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no links given"})
+		return
+	}
+
+	tier := h.tiers.Tier(user.Id)
+	if limit := plan.LimitsFor(tier).BulkItems; len(items) > limit {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error": fmt.Sprintf("the %s plan allows at most %d links per bulk request", tier, limit),
+			"code":  "bulk_limit_exceeded",
+			"limit": limit,
+			"tier":  tier,
+		})
+		return
+	}
+
+	// Usage is counted once and then item by item, so a batch cannot run
+	// past the monthly quota
+	usage, err := h.usage.LinkUsage(user.Id, plan.PeriodStart(time.Now()))
+	counted := err == nil
+	if err != nil && !errors.Is(err, store.ErrRequiresDatabase) {
+		log.Printf("Error counting links of user %s: %v", user.Id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check plan limits"})
+		return
+	}
+
+	now := time.Now()
+	aliases := make(map[string]bool)
+	groups := h.ownerGroups(user.Id)
+	domainsByHost := make(map[string]store.Domain)
+	var pending []*bulkItem
+	for _, item := range items {
+		if item.failed() {
+			continue
+		}
+		if !h.prepareBulkItem(item, user.Id, tier, now, aliases, groups, domainsByHost) {
+			continue
+		}
+		if counted {
+			if err := plan.CheckUsage(tier, usage, item.link); err != nil {
+				item.fail("", "quota_exceeded", err)
+				continue
+			}
+			usage.LinksCreated++
+			if item.link.CustomAlias {
+				usage.CustomAliases++
+			}
+		}
+		pending = append(pending, item)
+	}
+
+	if !h.saveBulkItems(c, pending) {
+		return
+	}
+
+	results := make([]bulkResult, len(items))
+	created := 0
+	for i, item := range items {
+		results[i] = item.result
+		if !item.failed() {
+			created++
+		}
+	}
+	log.Printf("Bulk request of user %s: %d of %d links created", user.Id, created, len(items))
+	c.JSON(http.StatusOK, gin.H{
+		"created": created,
+		"failed":  len(items) - created,
+		"results": results,
+	})
+}
+
+// Validate and screen one item and choose its code. Returns false when the
+// item failed.
+func (h *Handler) prepareBulkItem(item *bulkItem, userId string, tier string, now time.Time, aliases map[string]bool, groups *groupIndex, domainsByHost map[string]store.Domain) bool {
+	link, field, err := h.buildLink(item.request, userId, now)
+	if err != nil {
+		item.fail(field, "invalid", err)
+		return false
+	}
+	item.result.LongUrl = link.OriginalUrl
+
+	verdict := h.screener.Check(link.OriginalUrl)
+	if verdict.Action == screening.Block {
+		item.fail("long_url", "destination_blocked", errors.New(destinationBlockedMessage))
+		item.result.Reason = verdict.Reason
+		return false
+	}
+	if verdict.Action == screening.Quarantine {
+		link.QuarantineReason = verdict.Reason
+	}
+
+	if err := plan.CheckFeatures(tier, link); err != nil {
+		item.fail("", "feature_not_in_plan", err)
+		return false
+	}
+
+	if field, err := groups.check(item.request.TagIds, item.request.CampaignId); err != nil {
+		if field == "" {
+			log.Printf("Error loading groups of user %s: %v", userId, err)
+			item.fail("", "internal_error", errors.New("failed to check tags and campaign"))
+		} else {
+			item.fail(field, "unknown_group", err)
+		}
+		return false
+	}
+
+	if host := item.request.Domain; host != "" {
+		domain, found := domainsByHost[host]
+		if !found {
+			domain, err = h.creationDomain(host, userId)
+			if err != nil {
+				item.fail("domain", "invalid", err)
+				return false
+			}
+			domainsByHost[host] = domain
+		}
+		item.domain = domain
+	}
+
+	if alias := item.request.Alias; alias != "" {
+		if h.reserved.IsReserved(alias) {
+			item.fail("alias", "alias_reserved", errAliasReserved)
+			return false
+		}
+		key := store.DomainCode(item.domain.Id, alias)
+		available, err := h.links.IsShortCodeAvailable(key)
+		if err != nil {
+			log.Printf("Error checking alias %s: %v", key, err)
+			item.fail("alias", "internal_error", errors.New("failed to check alias"))
+			return false
+		}
+		if !available || aliases[key] {
+			item.fail("alias", "alias_taken", store.ErrShortCodeTaken)
+			return false
+		}
+		aliases[key] = true
+		link.ShortCode = key
+	} else {
+		// Later attempts are only needed on collisions, see saveBulkItems
+		for attempt := 0; attempt < shorturl.MaxAttempts && link.ShortCode == ""; attempt++ {
+			if code := shorturl.GenerateShortLinkAttempt(link.OriginalUrl, userId, attempt); !h.reserved.IsReserved(code) {
+				link.ShortCode = store.DomainCode(item.domain.Id, code)
+			}
+		}
+	}
+
+	item.link = link
+	return true
+}
+
+// Save the prepared items in one batch. Generated codes that collide are
+// retried one by one. Writes the error response and returns false when the
+// batch as a whole failed.
+func (h *Handler) saveBulkItems(c *gin.Context, items []*bulkItem) bool {
+	if len(items) == 0 {
+		return true
+	}
+	links := make([]store.Link, len(items))
+	for i, item := range items {
+		links[i] = item.link
+	}
+	errs, err := h.batches.SaveLinks(links)
+	if err != nil {
+		log.Printf("Error saving bulk links: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save links. Please try again.", "details": err.Error()})
+		return false
+	}
+
+	for i, item := range items {
+		err := errs[i]
+		if errors.Is(err, store.ErrShortCodeTaken) && !item.link.CustomAlias {
+			item.link.ShortCode, err = h.allocateShortCode(item.link, item.domain.Id)
+		}
+		if err == nil {
+			err = h.assignLinkGroups(item.link.ShortCode, item.request.TagIds, item.request.CampaignId)
+			if err != nil {
+				log.Printf("Error filing bulk link %s under its tags and campaign: %v", item.link.ShortCode, err)
+				item.fail("", "internal_error", errors.New("link created but its tags and campaign could not be saved"))
+				_, item.result.ShortCode = store.SplitDomainCode(item.link.ShortCode)
+				continue
+			}
+		}
+		switch {
+		case err == nil:
+			_, item.result.ShortCode = store.SplitDomainCode(item.link.ShortCode)
+			item.result.ShortUrl = shortUrlOn(item.domain.Host, item.result.ShortCode)
+			item.result.Status = "created"
+			if item.link.IsQuarantined() {
+				item.result.Status = "quarantined"
+				item.result.Reason = item.link.QuarantineReason
+			}
+			h.describe(item.link)
+		case errors.Is(err, store.ErrShortCodeTaken):
+			item.fail("alias", "alias_taken", err)
+		case errors.Is(err, store.ErrRequiresDatabase):
+			item.fail("", "unavailable", errors.New("password-protected and quarantined links are temporarily unavailable"))
+		default:
+			log.Printf("Error saving bulk link %s: %v", item.link.ShortCode, err)
+			item.fail("", "internal_error", errors.New("failed to save link"))
+		}
+	}
+	return true
+}
+
+// Returned for bodies that are neither JSON, CSV nor a form upload
+var errUnsupportedBulkFormat = errors.New("send a JSON array, a CSV file, or a form upload with a file field")
+
+// Read the items of a bulk request from its body
+func parseBulkItems(c *gin.Context) ([]*bulkItem, error) {
+	switch c.ContentType() {
+	case "application/json":
+		var requests []UrlCreationRequest
+		if err := json.NewDecoder(c.Request.Body).Decode(&requests); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("body must be a JSON array of links: %v", err)
+		}
+		items := make([]*bulkItem, len(requests))
+		for i, request := range requests {
+			if request.LongUrl == "" {
+				request.LongUrl = request.LongURL
+			}
+			items[i] = &bulkItem{request: request, result: bulkResult{Index: i}}
+		}
+		return items, nil
+	case "text/csv":
+		return parseBulkCSV(c.Request.Body)
+	case "multipart/form-data":
+		header, err := c.FormFile("file")
+		if err != nil {
+			return nil, fmt.Errorf("form upload must have a file field: %v", err)
+		}
+		file, err := header.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return parseBulkCSV(file)
+	default:
+		return nil, errUnsupportedBulkFormat
+	}
+}
+
+// CSV columns, by header name. The header row is required; long_url is the
+// only required column.
+var bulkCSVColumns = map[string]func(request *UrlCreationRequest, value string) error{
+	"long_url": func(request *UrlCreationRequest, value string) error {
+		request.LongUrl = value
+		return nil
+	},
+	"alias": func(request *UrlCreationRequest, value string) error {
+		request.Alias = value
+		return nil
+	},
+	"password": func(request *UrlCreationRequest, value string) error {
+		request.Password = value
+		return nil
+	},
+	"expires_at": func(request *UrlCreationRequest, value string) error {
+		expiresAt, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return fmt.Errorf("%q is not an RFC 3339 time", value)
+		}
+		request.ExpiresAt = &expiresAt
+		return nil
+	},
+	"campaign_id": func(request *UrlCreationRequest, value string) error {
+		request.CampaignId = value
+		return nil
+	},
+	"tag_ids": func(request *UrlCreationRequest, value string) error {
+		for _, id := range strings.Split(value, ";") {
+			if id = strings.TrimSpace(id); id != "" {
+				request.TagIds = append(request.TagIds, id)
+			}
+		}
+		return nil
+	},
+	"utm_source": func(request *UrlCreationRequest, value string) error {
+		request.UTM.Source = value
+		return nil
+	},
+	"utm_medium": func(request *UrlCreationRequest, value string) error {
+		request.UTM.Medium = value
+		return nil
+	},
+	"utm_campaign": func(request *UrlCreationRequest, value string) error {
+		request.UTM.Campaign = value
+		return nil
+	},
+	"utm_term": func(request *UrlCreationRequest, value string) error {
+		request.UTM.Term = value
+		return nil
+	},
+	"utm_content": func(request *UrlCreationRequest, value string) error {
+		request.UTM.Content = value
+		return nil
+	},
+	"utm_preset": func(request *UrlCreationRequest, value string) error {
+		request.UTMPreset = value
+		return nil
+	},
+	"domain": func(request *UrlCreationRequest, value string) error {
+		request.Domain = value
+		return nil
+	},
+	"expires_in": func(request *UrlCreationRequest, value string) error {
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number of seconds", value)
+		}
+		request.ExpiresIn = seconds
+		return nil
+	},
+}
+
+// Read a CSV file of links. Rows with unreadable values become failed
+// items; a malformed file or header fails as a whole.
+func parseBulkCSV(r io.Reader) ([]*bulkItem, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, csvError(err)
+	}
+	columns := make([]string, len(header))
+	hasUrl := false
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\uFEFF")))
+		if name == "url" {
+			name = "long_url"
+		}
+		if _, ok := bulkCSVColumns[name]; !ok {
+			return nil, fmt.Errorf("unknown CSV column %q", header[i])
+		}
+		columns[i] = name
+		hasUrl = hasUrl || name == "long_url"
+	}
+	if !hasUrl {
+		return nil, errors.New("CSV header must have a long_url column")
+	}
+
+	var items []*bulkItem
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return items, nil
+		}
+		if err != nil {
+			return nil, csvError(err)
+		}
+
+		item := &bulkItem{result: bulkResult{Index: len(items)}}
+		for i, value := range record {
+			value = strings.TrimSpace(value)
+			if i >= len(columns) || value == "" {
+				continue
+			}
+			if err := bulkCSVColumns[columns[i]](&item.request, value); err != nil {
+				item.fail(columns[i], "invalid", err)
+				break
+			}
+		}
+		items = append(items, item)
+	}
+}
+
+func csvError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return err
+	}
+	return fmt.Errorf("invalid CSV: %v", err)
+}
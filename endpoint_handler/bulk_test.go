@@ -0,0 +1,146 @@
+package endpoint_handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"url-shortener/plan"
+	"url-shortener/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type bulkResponse struct {
+	Created int          `json:"created"`
+	Failed  int          `json:"failed"`
+	Results []bulkResult `json:"results"`
+	Code    string       `json:"code"`
+}
+
+func bulkRequest(t *testing.T, r *gin.Engine, key string, contentType string, body []byte) (int, bulkResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/links/bulk", bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", "Bearer "+key)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var response bulkResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &response)
+	return w.Code, response
+}
+
+func TestBulkCreateJSON(t *testing.T) {
+	t.Setenv("BASE_URL", "http://short.test/")
+	memoryStore := store.NewMemoryStore()
+	r := setupRouter(memoryStore)
+	key := issueAPIKey(t, memoryStore, "pro-user")
+
+	code, response := bulkRequest(t, r, key, "application/json", []byte(`[
+		{"long_url": "https://example.com/a"},
+		{"longUrl": "https://example.com/b", "alias": "bulk-b"},
+		{"long_url": "javascript:alert(1)"},
+		{"long_url": "https://example.com/c", "alias": "bulk-b"},
+		{"long_url": "https://example.com/d", "alias": "acme"},
+		{"long_url": "https://example.com/e", "expires_in": 3600}
+	]`))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 3, response.Created)
+	assert.Equal(t, 3, response.Failed)
+
+	results := response.Results
+	assert.Len(t, results, 6)
+	assert.Equal(t, "created", results[0].Status)
+	assert.Equal(t, "http://short.test/"+results[0].ShortCode, results[0].ShortUrl)
+	assert.Equal(t, "bulk-b", results[1].ShortCode)
+	assert.Equal(t, "long_url", results[2].Field)
+	assert.Equal(t, "alias_taken", results[3].Code)
+	assert.Equal(t, "alias_reserved", results[4].Code)
+	assert.Equal(t, "created", results[5].Status)
+	for i, result := range results {
+		assert.Equal(t, i, result.Index)
+	}
+
+	link, err := memoryStore.RetrieveLink("bulk-b")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/b", link.OriginalUrl)
+	assert.Equal(t, "pro-user", link.UserId)
+	assert.True(t, link.CustomAlias)
+}
+
+func TestBulkCreateCSV(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	r := setupRouter(memoryStore)
+	key := issueAPIKey(t, memoryStore, "user-1")
+
+	csvFile := "url,alias,expires_in\n" +
+		"https://example.com/one,csv-one,\n" +
+		"https://example.com/two,,soon\n" +
+		"https://example.com/three,,3600\n"
+
+	code, response := bulkRequest(t, r, key, "text/csv", []byte(csvFile))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, response.Created)
+	assert.Equal(t, "csv-one", response.Results[0].ShortCode)
+	assert.Equal(t, "expires_in", response.Results[1].Field)
+	// Expiry is not part of the FREE plan
+	assert.Equal(t, "feature_not_in_plan", response.Results[2].Code)
+
+	// The same file as a form upload
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "links.csv")
+	assert.NoError(t, err)
+	_, _ = part.Write([]byte("long_url\nhttps://example.com/upload\n"))
+	assert.NoError(t, form.Close())
+	code, response = bulkRequest(t, r, key, form.FormDataContentType(), body.Bytes())
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, response.Created)
+
+	code, _ = bulkRequest(t, r, key, "text/csv", []byte("destination\nhttps://example.com\n"))
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = bulkRequest(t, r, key, "text/plain", []byte("https://example.com"))
+	assert.Equal(t, http.StatusUnsupportedMediaType, code)
+}
+
+func TestBulkCreateLimits(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	r := setupRouter(memoryStore)
+	key := issueAPIKey(t, memoryStore, "user-1")
+	limits := plan.LimitsFor(plan.Free)
+
+	// The request size follows the tier
+	items := make([]string, limits.BulkItems+1)
+	for i := range items {
+		items[i] = fmt.Sprintf(`{"long_url": "https://example.com/%d"}`, i)
+	}
+	code, response := bulkRequest(t, r, key, "application/json", []byte("["+strings.Join(items, ",")+"]"))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, code)
+	assert.Equal(t, "bulk_limit_exceeded", response.Code)
+	usage, _ := memoryStore.LinkUsage("user-1", plan.PeriodStart(time.Now()))
+	assert.Zero(t, usage.LinksCreated)
+
+	// Items past the alias quota fail one by one
+	aliases := make([]string, limits.CustomAliases+1)
+	for i := range aliases {
+		aliases[i] = fmt.Sprintf(`{"long_url": "https://example.com/%d", "alias": "quota-%d"}`, i, i)
+	}
+	code, response = bulkRequest(t, r, key, "application/json", []byte("["+strings.Join(aliases, ",")+"]"))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, limits.CustomAliases, response.Created)
+	assert.Equal(t, "quota_exceeded", response.Results[limits.CustomAliases].Code)
+
+	// Anonymous callers cannot bulk create
+	req := httptest.NewRequest(http.MethodPost, "/links/bulk", strings.NewReader(`[]`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
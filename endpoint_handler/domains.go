@@ -0,0 +1,369 @@
+package endpoint_handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+	"url-shortener/auth"
+	"url-shortener/domains"
+	"url-shortener/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Verified domains are looked up on every redirect that does not come in on
+// the default domain, so each instance remembers hits and misses for a
+// while. Verifying or deleting a domain takes effect on other instances
+// once their entry expires.
+const (
+	domainRouteTTL  = time.Minute
+	maxDomainRoutes = 10000
+)
+
+type domainRoute struct {
+	domain  store.Domain
+	found   bool
+	expires time.Time
+}
+
+// Verified domains by host
+type domainRoutes struct {
+	domains store.DomainStore
+
+	mu      sync.Mutex
+	entries map[string]domainRoute
+}
+
+func newDomainRoutes(domains store.DomainStore) *domainRoutes {
+	return &domainRoutes{domains: domains, entries: make(map[string]domainRoute)}
+}
+
+// The verified domain of host. found is false when nobody verified it, and
+// without Postgres, where there are no custom domains.
+func (r *domainRoutes) lookup(host string, now time.Time) (store.Domain, bool, error) {
+	r.mu.Lock()
+	route, cached := r.entries[host]
+	r.mu.Unlock()
+	if cached && now.Before(route.expires) {
+		return route.domain, route.found, nil
+	}
+
+	domain, err := r.domains.RetrieveVerifiedDomain(host)
+	found := err == nil
+	if errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrRequiresDatabase) {
+		err = nil
+	}
+	if err != nil {
+		return store.Domain{}, false, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Host headers are chosen by clients, so the cache must not grow
+	// without bound
+	if len(r.entries) >= maxDomainRoutes {
+		r.entries = make(map[string]domainRoute)
+	}
+	r.entries[host] = domainRoute{domain: domain, found: found, expires: now.Add(domainRouteTTL)}
+	return domain, found, nil
+}
+
+func (r *domainRoutes) forget(host string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.entries, host)
+}
+
+// Host of the default domain, from BASE_URL
+func defaultHost() string {
+	parsed, err := url.Parse(baseUrl())
+	if err != nil {
+		return ""
+	}
+	return domains.RequestHost(parsed.Host)
+}
+
+// Short URL of a code on host, or on the default domain when host is empty.
+// Custom domains are always served over HTTPS.
+func shortUrlOn(host string, code string) string {
+	if host == "" {
+		return baseUrl() + code
+	}
+	return "https://" + host + "/" + code
+}
+
+// How a link is shown to its owner. The key it is stored under is internal.
+type linkAddress struct {
+	ShortCode string `json:"short_code"`
+	ShortUrl  string `json:"short_url"`
+	Domain    string `json:"domain,omitempty"`
+}
+
+// Address of the link stored under key, given the hosts of the owner's
+// domains by ID
+func addressOf(key string, hosts map[string]string) linkAddress {
+	domainId, code := store.SplitDomainCode(key)
+	return linkAddress{ShortCode: code, ShortUrl: shortUrlOn(hosts[domainId], code), Domain: hosts[domainId]}
+}
+
+// Add the address of link to a response about it. The owner's domains are
+// only loaded for links on a custom domain.
+func (h *Handler) withLinkAddress(response gin.H, link store.Link) gin.H {
+	var hosts map[string]string
+	if domainId, _ := store.SplitDomainCode(link.ShortCode); domainId != "" {
+		hosts = h.domainHosts(link.UserId)
+	}
+	address := addressOf(link.ShortCode, hosts)
+	response["short_code"] = address.ShortCode
+	response["short_url"] = address.ShortUrl
+	if address.Domain != "" {
+		response["domain"] = address.Domain
+	}
+	return response
+}
+
+// Hosts of a user's domains by ID, for showing their links. Links on
+// domains that cannot be loaded are shown on the default domain.
+func (h *Handler) domainHosts(userId string) map[string]string {
+	hosts := make(map[string]string)
+	userDomains, err := h.domains.ListDomains(userId)
+	if err != nil && !errors.Is(err, store.ErrRequiresDatabase) {
+		log.Printf("Warning: Failed to load domains of user %s: %v", userId, err)
+	}
+	for _, domain := range userDomains {
+		hosts[domain.Id] = domain.Host
+	}
+	return hosts
+}
+
+// Key of the link a visitor asks for with code: links are looked up on the
+// domain of the request's Host header, and on the default domain for hosts
+// nobody verified. Writes the error response and returns false when the
+// domain cannot be looked up.
+func (h *Handler) routedCode(c *gin.Context, code string) (string, bool) {
+	host := domains.RequestHost(c.Request.Host)
+	if host == "" || host == defaultHost() {
+		return code, true
+	}
+	domain, _, err := h.routes.lookup(host, time.Now())
+	if err != nil {
+		log.Printf("Error looking up domain %s: %v", host, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve short URL"})
+		return "", false
+	}
+	return store.DomainCode(domain.Id, code), true
+}
+
+// Key of the link an API request for code is about. Links on a custom
+// domain are addressed with its host in the domain query parameter. Writes
+// the error response and returns false when there is no such domain.
+func (h *Handler) managedCode(c *gin.Context, code string) (string, bool) {
+	if c.Query("domain") == "" {
+		return code, true
+	}
+	host, err := domains.NormalizeHost(c.Query("domain"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "field": "domain"})
+		return "", false
+	}
+	domain, found, err := h.routes.lookup(host, time.Now())
+	if err != nil {
+		log.Printf("Error looking up domain %s: %v", host, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load domain"})
+		return "", false
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Domain not found"})
+		return "", false
+	}
+	return store.DomainCode(domain.Id, code), true
+}
+
+// Returned for domains a user may not create links on
+var errDomainNotVerified = errors.New("domain must be one of your verified domains")
+
+// The domain a link of userId is created on: one of the user's verified
+// domains, or the default domain when host is empty
+func (h *Handler) creationDomain(host string, userId string) (store.Domain, error) {
+	if host == "" {
+		return store.Domain{}, nil
+	}
+	host, err := domains.NormalizeHost(host)
+	if err != nil {
+		return store.Domain{}, err
+	}
+	domain, err := h.domains.RetrieveVerifiedDomain(host)
+	if errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrRequiresDatabase) || (err == nil && domain.UserId != userId) {
+		return store.Domain{}, errDomainNotVerified
+	}
+	if err != nil {
+		log.Printf("Error loading domain %s: %v", host, err)
+		return store.Domain{}, errors.New("failed to load domain")
+	}
+	return domain, nil
+}
+
+// Request model for registering a domain
+type DomainRequest struct {
+	Host string `json:"host"`
+}
+
+// TXT record a domain's owner publishes to verify it
+type verificationRecord struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// A domain as shown to its owner. Unverified domains come with the record
+// that verifies them.
+type domainResponse struct {
+	store.Domain
+	Verification *verificationRecord `json:"verification,omitempty"`
+}
+
+func newDomainResponse(domain store.Domain) domainResponse {
+	response := domainResponse{Domain: domain}
+	if !domain.IsVerified() {
+		response.Verification = &verificationRecord{
+			Type:  "TXT",
+			Name:  domains.RecordName(domain.Host),
+			Value: domains.RecordValue(domain.Token),
+		}
+	}
+	return response
+}
+
+// CreateDomain registers a custom domain for the authenticated user. Links
+// can be created on it once it is verified.
+func (h *Handler) CreateDomain(c *gin.Context) {
+	user, _ := auth.CurrentUser(c)
+	var domainRequest DomainRequest
+	if err := c.ShouldBindJSON(&domainRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	host, err := domains.NormalizeHost(domainRequest.Host)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "field": "host"})
+		return
+	}
+	if host == defaultHost() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "this is the default domain", "field": "host"})
+		return
+	}
+
+	token, err := domains.NewToken()
+	if err != nil {
+		log.Printf("Error generating domain token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register domain"})
+		return
+	}
+	domain, err := h.domains.CreateDomain(store.Domain{UserId: user.Id, Host: host, Token: token})
+	if !writeDomainError(c, err) {
+		return
+	}
+	log.Printf("Domain %s registered by user %s", host, user.Id)
+	c.JSON(http.StatusCreated, gin.H{"message": "domain registered, publish the TXT record and verify it", "domain": newDomainResponse(domain)})
+}
+
+func (h *Handler) ListDomains(c *gin.Context) {
+	user, _ := auth.CurrentUser(c)
+	userDomains, err := h.domains.ListDomains(user.Id)
+	if !writeDomainError(c, err) {
+		return
+	}
+	response := make([]domainResponse, len(userDomains))
+	for i, domain := range userDomains {
+		response[i] = newDomainResponse(domain)
+	}
+	c.JSON(http.StatusOK, gin.H{"domains": response})
+}
+
+// VerifyDomain checks the TXT record of one of the authenticated user's
+// domains and marks the domain verified when it holds the token
+func (h *Handler) VerifyDomain(c *gin.Context) {
+	user, _ := auth.CurrentUser(c)
+	domain, ok := h.ownedDomain(c, user.Id, c.Param("id"))
+	if !ok {
+		return
+	}
+	if domain.IsVerified() {
+		c.JSON(http.StatusOK, gin.H{"message": "domain is verified", "domain": newDomainResponse(domain)})
+		return
+	}
+
+	err := h.verifier.Verify(c.Request.Context(), domain.Host, domain.Token)
+	if errors.Is(err, domains.ErrRecordNotFound) || errors.Is(err, domains.ErrRecordMismatch) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "domain": newDomainResponse(domain)})
+		return
+	}
+	if err != nil {
+		log.Printf("Error verifying domain %s: %v", domain.Host, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "DNS lookup failed, try again later"})
+		return
+	}
+
+	domain, err = h.domains.VerifyDomain(user.Id, domain.Id, time.Now())
+	if !writeDomainError(c, err) {
+		return
+	}
+	h.routes.forget(domain.Host)
+	log.Printf("Domain %s verified by user %s", domain.Host, user.Id)
+	c.JSON(http.StatusOK, gin.H{"message": "domain is verified", "domain": newDomainResponse(domain)})
+}
+
+// DeleteDomain removes one of the authenticated user's domains together
+// with the links on it
+func (h *Handler) DeleteDomain(c *gin.Context) {
+	user, _ := auth.CurrentUser(c)
+	domain, ok := h.ownedDomain(c, user.Id, c.Param("id"))
+	if !ok {
+		return
+	}
+	err := h.domains.DeleteDomain(user.Id, domain.Id)
+	if !writeDomainError(c, err) {
+		return
+	}
+	h.routes.forget(domain.Host)
+	log.Printf("Domain %s deleted by user %s", domain.Host, user.Id)
+	c.JSON(http.StatusOK, gin.H{"message": "domain deleted successfully", "id": domain.Id})
+}
+
+// Look up a domain of the user. Writes the error response and returns false
+// when the user has no such domain.
+func (h *Handler) ownedDomain(c *gin.Context, userId string, id string) (store.Domain, bool) {
+	userDomains, err := h.domains.ListDomains(userId)
+	if !writeDomainError(c, err) {
+		return store.Domain{}, false
+	}
+	for _, domain := range userDomains {
+		if domain.Id == id {
+			return domain, true
+		}
+	}
+	writeDomainError(c, store.ErrNotFound)
+	return store.Domain{}, false
+}
+
+// Report a failed domain operation. Returns true when there was nothing to
+// report.
+func writeDomainError(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, store.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Domain not found"})
+	case errors.Is(err, store.ErrDomainTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "field": "host"})
+	case errors.Is(err, store.ErrRequiresDatabase):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Error managing domains: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update domains"})
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package endpoint_handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"url-shortener/domains"
+	"url-shortener/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func redirectOn(r *gin.Engine, host string, shortCode string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/"+shortCode, nil)
+	req.Host = host
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCustomDomains(t *testing.T) {
+	t.Setenv("BASE_URL", "http://short.test/")
+	memoryStore := store.NewMemoryStore()
+	resolver := domains.StaticResolver{}
+	r := setupTestRouter(memoryStore, nil, nil, resolver)
+	key := issueAPIKey(t, memoryStore, "user-1")
+	otherKey := issueAPIKey(t, memoryStore, "user-2")
+
+	code, response := authorizedRequest(r, http.MethodPost, "/domains", key, `{"host": "Go.Example.com"}`)
+	assert.Equal(t, http.StatusCreated, code)
+	domain := response["domain"].(map[string]interface{})
+	domainId := domain["id"].(string)
+	assert.Equal(t, "go.example.com", domain["host"])
+	verification := domain["verification"].(map[string]interface{})
+	assert.Equal(t, "_shrinkr-verification.go.example.com", verification["name"])
+
+	code, response = authorizedRequest(r, http.MethodPost, "/domains", key, `{"host": "https://go.example.com/"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "host", response["field"])
+
+	// Not verified yet
+	code, _ = authorizedRequest(r, http.MethodPost, "/create-short-url", key, `{"long_url": "https://example.com/a", "domain": "go.example.com"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = authorizedRequest(r, http.MethodPost, "/domains/"+domainId+"/verify", key, "")
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	code, _ = authorizedRequest(r, http.MethodPost, "/domains/"+domainId+"/verify", otherKey, "")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	resolver[verification["name"].(string)] = []string{verification["value"].(string)}
+	code, response = authorizedRequest(r, http.MethodPost, "/domains/"+domainId+"/verify", key, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.NotNil(t, response["domain"].(map[string]interface{})["verified_at"])
+	assert.Nil(t, response["domain"].(map[string]interface{})["verification"])
+
+	// Once verified the host is taken for everyone else
+	code, _ = authorizedRequest(r, http.MethodPost, "/domains", otherKey, `{"host": "go.example.com"}`)
+	assert.Equal(t, http.StatusConflict, code)
+
+	// The same code on two domains
+	code, response = authorizedRequest(r, http.MethodPost, "/create-short-url", key, `{"long_url": "https://example.com/branded", "alias": "launch", "domain": "go.example.com"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "https://go.example.com/launch", response["short_url"])
+	code, response = authorizedRequest(r, http.MethodPost, "/create-short-url", otherKey, `{"long_url": "https://example.com/plain", "alias": "launch"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "http://short.test/launch", response["short_url"])
+	code, _ = authorizedRequest(r, http.MethodPost, "/create-short-url", otherKey, `{"long_url": "https://example.com/b", "domain": "go.example.com"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	assert.Equal(t, "https://example.com/branded", redirectOn(r, "GO.example.com:443", "launch").Header().Get("Location"))
+	assert.Equal(t, "https://example.com/plain", redirectOn(r, "short.test", "launch").Header().Get("Location"))
+	// Hosts nobody verified are served like the default domain
+	assert.Equal(t, "https://example.com/plain", redirectOn(r, "localhost:9808", "launch").Header().Get("Location"))
+
+	code, _ = authorizedRequest(r, http.MethodPatch, "/links/launch?domain=go.example.com", key, `{"is_active": false}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, http.StatusNotFound, redirectOn(r, "go.example.com", "launch").Code)
+	assert.Equal(t, http.StatusFound, redirectOn(r, "short.test", "launch").Code)
+	code, _ = authorizedRequest(r, http.MethodPatch, "/links/launch?domain=missing.example.com", key, `{"is_active": true}`)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, response = authorizedRequest(r, http.MethodGet, "/me/links", key, "")
+	assert.Equal(t, http.StatusOK, code)
+	link := response["links"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "launch", link["short_code"])
+	assert.Equal(t, "go.example.com", link["domain"])
+	assert.Equal(t, "https://go.example.com/launch", link["short_url"])
+
+	// Deleting the domain takes its links along
+	code, _ = authorizedRequest(r, http.MethodDelete, "/domains/"+domainId, key, "")
+	assert.Equal(t, http.StatusOK, code)
+	code, response = authorizedRequest(r, http.MethodGet, "/me/links", key, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, response["links"], 0)
+	assert.Equal(t, "https://example.com/plain", redirectOn(r, "go.example.com", "launch").Header().Get("Location"))
+}
@@ -0,0 +1,257 @@
+package endpoint_handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"url-shortener/auth"
+	"url-shortener/plan"
+	"url-shortener/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Rows read from the store per query while streaming an export
+const exportPageSize = 500
+
+// Export formats
+const (
+	exportCSV    = "csv"
+	exportNDJSON = "ndjson"
+)
+
+// A row of an export, written as a CSV record or a JSON line
+type exportRow interface {
+	csvRecord() []string
+}
+
+// Links on custom domains are told apart by their domain, which comes last
+// in CSV so that the columns of earlier exports keep their place
+type linkExportRow struct {
+	linkAddress
+	OriginalUrl string    `json:"original_url"`
+	CreatedAt   time.Time `json:"created_at"`
+	Clicks      int64     `json:"clicks"`
+	Status      string    `json:"status"`
+	store.UTM
+}
+
+var linkExportColumns = []string{"short_code", "original_url", "created_at", "clicks", "status",
+	"utm_source", "utm_medium", "utm_campaign", "utm_term", "utm_content", "domain", "short_url"}
+
+func (r linkExportRow) csvRecord() []string {
+	return []string{r.ShortCode, r.OriginalUrl, r.CreatedAt.UTC().Format(time.RFC3339), strconv.FormatInt(r.Clicks, 10), r.Status,
+		r.Source, r.Medium, r.Campaign, r.Term, r.Content, r.Domain, r.ShortUrl}
+}
+
+type clickExportRow struct {
+	ShortCode string    `json:"short_code"`
+	Domain    string    `json:"domain,omitempty"`
+	ClickedAt time.Time `json:"clicked_at"`
+	IpAddress string    `json:"ip_address"`
+	UserAgent string    `json:"user_agent"`
+	Referer   string    `json:"referer"`
+	Country   string    `json:"country"`
+	City      string    `json:"city"`
+	Device    string    `json:"device"`
+	Browser   string    `json:"browser"`
+	OS        string    `json:"os"`
+}
+
+var clickExportColumns = []string{"short_code", "clicked_at", "ip_address", "user_agent", "referer", "country", "city", "device", "browser", "os", "domain"}
+
+func (r clickExportRow) csvRecord() []string {
+	return []string{r.ShortCode, r.ClickedAt.UTC().Format(time.RFC3339Nano), r.IpAddress, r.UserAgent, r.Referer,
+		r.Country, r.City, r.Device, r.Browser, r.OS, r.Domain}
+}
+
+// ExportLinks streams the authenticated user's links with their click
+// counts and status. Query parameter: format (csv or ndjson).
+func (h *Handler) ExportLinks(c *gin.Context) {
+	user, format, ok := exportRequest(c)
+	if !ok {
+		return
+	}
+
+	hosts := h.domainHosts(user.Id)
+	streamExport(c, format, "links", linkExportColumns,
+		func(after store.ExportCursor) ([]store.ExportedLink, error) {
+			return h.exports.ExportLinks(user.Id, after, exportPageSize)
+		},
+		func(link store.ExportedLink) (store.ExportCursor, exportRow) {
+			return link.Cursor(), linkExportRow{
+				linkAddress: addressOf(link.ShortCode, hosts),
+				OriginalUrl: link.OriginalUrl,
+				CreatedAt:   link.CreatedAt,
+				Clicks:      link.Clicks,
+				Status:      link.Status,
+				UTM:         link.UTM,
+			}
+		})
+}
+
+// ExportClicks streams the raw clicks on the authenticated user's links.
+// Query parameters: format (csv or ndjson), from and to (RFC 3339 or
+// YYYY-MM-DD in UTC, default the last 30 days). The range may not reach
+// back further than the plan's analytics retention.
+func (h *Handler) ExportClicks(c *gin.Context) {
+	user, format, ok := exportRequest(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	to := now
+	if value := c.Query("to"); value != "" {
+		t, err := parseStatsTime(value, time.UTC, true)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "field": "to"})
+			return
+		}
+		to = t
+	}
+	tier := h.tiers.Tier(user.Id)
+	from := to.Add(-defaultStatsRange)
+	if value := c.Query("from"); value != "" {
+		t, err := parseStatsTime(value, time.UTC, false)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "field": "from"})
+			return
+		}
+		from = t
+	} else if oldest := now.Add(-plan.LimitsFor(tier).AnalyticsRetention()); from.Before(oldest) && oldest.Before(to) {
+		from = oldest
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to", "field": "from"})
+		return
+	}
+	if !h.writePlanError(c, plan.CheckRetention(tier, from, now)) {
+		return
+	}
+
+	hosts := h.domainHosts(user.Id)
+	streamExport(c, format, "clicks", clickExportColumns,
+		func(after store.ExportCursor) ([]store.ExportedClick, error) {
+			return h.exports.ExportClicks(user.Id, from, to, after, exportPageSize)
+		},
+		func(click store.ExportedClick) (store.ExportCursor, exportRow) {
+			address := addressOf(click.ShortCode, hosts)
+			return click.Cursor(), clickExportRow{
+				ShortCode: address.ShortCode,
+				Domain:    address.Domain,
+				ClickedAt: click.ClickedAt,
+				IpAddress: click.IpAddress,
+				UserAgent: click.UserAgent,
+				Referer:   click.Referer,
+				Country:   click.Country,
+				City:      click.City,
+				Device:    click.Device,
+				Browser:   click.Browser,
+				OS:        click.OS,
+			}
+		})
+}
+
+// Read the caller and format of an export request. Writes the error
+// response and returns false when the request is not valid.
+func exportRequest(c *gin.Context) (auth.User, string, bool) {
+	user, ok := auth.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return auth.User{}, "", false
+	}
+	format := c.DefaultQuery("format", exportCSV)
+	if format != exportCSV && format != exportNDJSON {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or ndjson", "field": "format"})
+		return auth.User{}, "", false
+	}
+	return user, format, true
+}
+
+// Write every page of an export to the response as it is read. The first
+// page is read before anything is sent so that store failures still get a
+// proper error response; later failures can only cut the stream short.
+func streamExport[T any](c *gin.Context, format string, name string, columns []string,
+	page func(after store.ExportCursor) ([]T, error), row func(T) (store.ExportCursor, exportRow)) {
+	rows, err := page(store.ExportCursor{})
+	switch {
+	case errors.Is(err, store.ErrRequiresDatabase):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		log.Printf("Error exporting %s: %v", name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export " + name})
+		return
+	}
+
+	filename := fmt.Sprintf("%s-%s.%s", name, time.Now().UTC().Format("20060102-150405"), format)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("Cache-Control", "no-store")
+	var write func(exportRow) error
+	var csvWriter *csv.Writer
+	if format == exportCSV {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		csvWriter = csv.NewWriter(c.Writer)
+		write = func(r exportRow) error {
+			record := r.csvRecord()
+			for i, value := range record {
+				record[i] = csvSafe(value)
+			}
+			return csvWriter.Write(record)
+		}
+		c.Status(http.StatusOK)
+		_ = csvWriter.Write(columns)
+	} else {
+		c.Header("Content-Type", "application/x-ndjson")
+		encoder := json.NewEncoder(c.Writer)
+		write = func(r exportRow) error { return encoder.Encode(r) }
+		c.Status(http.StatusOK)
+	}
+
+	count := 0
+	for len(rows) > 0 {
+		var cursor store.ExportCursor
+		for _, item := range rows {
+			var r exportRow
+			cursor, r = row(item)
+			if err := write(r); err != nil {
+				log.Printf("Error writing %s export: %v", name, err)
+				return
+			}
+		}
+		count += len(rows)
+		if csvWriter != nil {
+			csvWriter.Flush()
+		}
+		c.Writer.Flush()
+
+		if len(rows) < exportPageSize || c.Request.Context().Err() != nil {
+			break
+		}
+		if rows, err = page(cursor); err != nil {
+			// The status is out already; a cut short body is all that is left
+			log.Printf("Error exporting %s after %d rows: %v", name, count, err)
+			return
+		}
+	}
+	if csvWriter != nil {
+		csvWriter.Flush()
+	}
+	log.Printf("Exported %d %s", count, name)
+}
+
+// Spreadsheets run cells starting with these as formulas. Clicks carry
+// values chosen by whoever followed a link, so such cells are escaped.
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
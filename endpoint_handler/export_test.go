@@ -0,0 +1,160 @@
+package endpoint_handler
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"url-shortener/domains"
+	"url-shortener/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func getExport(r *gin.Engine, path string, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Authorization", "Bearer "+key)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestExportLinks(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	r := setupRouter(memoryStore)
+	key := issueAPIKey(t, memoryStore, "user-1")
+
+	// More than one page
+	total := 2*exportPageSize + 1
+	for i := 0; i < total; i++ {
+		assert.NoError(t, memoryStore.SaveLink(store.Link{ShortCode: fmt.Sprintf("code-%d", i), OriginalUrl: "https://example.com", UserId: "user-1"}))
+	}
+	assert.NoError(t, memoryStore.SaveLink(store.Link{ShortCode: "other", OriginalUrl: "https://example.com", UserId: "user-2"}))
+	assert.NoError(t, memoryStore.SetLinkActive("code-1", false))
+	assert.NoError(t, memoryStore.TrackUrlClick("code-0", "guest-user", "1.2.3.4", "agent", ""))
+
+	w := getExport(r, "/me/export/links", key)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, linkExportColumns, records[0])
+	assert.Len(t, records, total+1)
+	seen := make(map[string]bool)
+	for _, record := range records[1:] {
+		assert.False(t, seen[record[0]], "duplicate row %s", record[0])
+		seen[record[0]] = true
+		switch record[0] {
+		case "code-0":
+			assert.Equal(t, "1", record[3])
+		case "code-1":
+			assert.Equal(t, store.LinkStatusInactive, record[4])
+		case "other":
+			t.Error("exported another user's link")
+		}
+	}
+
+	w = getExport(r, "/me/export/links?format=ndjson", key)
+	assert.Equal(t, http.StatusOK, w.Code)
+	scanner := bufio.NewScanner(w.Body)
+	lines := 0
+	for scanner.Scan() {
+		var row linkExportRow
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &row))
+		lines++
+	}
+	assert.Equal(t, total, lines)
+
+	w = getExport(r, "/me/export/links?format=xml", key)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestExportLinksOnCustomDomain(t *testing.T) {
+	t.Setenv("BASE_URL", "http://short.test/")
+	memoryStore := store.NewMemoryStore()
+	resolver := domains.StaticResolver{}
+	r := setupTestRouter(memoryStore, nil, nil, resolver)
+	key := issueAPIKey(t, memoryStore, "user-1")
+
+	_, response := authorizedRequest(r, http.MethodPost, "/domains", key, `{"host": "go.example.com"}`)
+	domain := response["domain"].(map[string]interface{})
+	verification := domain["verification"].(map[string]interface{})
+	resolver[verification["name"].(string)] = []string{verification["value"].(string)}
+	code, _ := authorizedRequest(r, http.MethodPost, "/domains/"+domain["id"].(string)+"/verify", key, "")
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = authorizedRequest(r, http.MethodPost, "/create-short-url", key, `{"long_url": "https://example.com/branded", "alias": "launch", "domain": "go.example.com"}`)
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = authorizedRequest(r, http.MethodPost, "/create-short-url", key, `{"long_url": "https://example.com/plain", "alias": "launch"}`)
+	assert.Equal(t, http.StatusOK, code)
+
+	w := getExport(r, "/me/export/links", key)
+	assert.Equal(t, http.StatusOK, w.Code)
+	records, err := csv.NewReader(w.Body).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+	shortUrls := make(map[string]string)
+	for _, record := range records[1:] {
+		assert.Equal(t, "launch", record[0])
+		shortUrls[record[10]] = record[11]
+	}
+	assert.Equal(t, map[string]string{
+		"go.example.com": "https://go.example.com/launch",
+		"":               "http://short.test/launch",
+	}, shortUrls)
+
+	// Responses about the link name it the same way
+	code, response = authorizedRequest(r, http.MethodDelete, "/links/launch?domain=go.example.com", key, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "launch", response["short_code"])
+	assert.Equal(t, "https://go.example.com/launch", response["short_url"])
+}
+
+func TestExportClicks(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	r := setupRouter(memoryStore)
+	key := issueAPIKey(t, memoryStore, "user-1")
+	assert.NoError(t, memoryStore.SaveLink(store.Link{ShortCode: "mine", OriginalUrl: "https://example.com", UserId: "user-1"}))
+	assert.NoError(t, memoryStore.SaveLink(store.Link{ShortCode: "theirs", OriginalUrl: "https://example.com", UserId: "user-2"}))
+
+	now := time.Now()
+	_, err := memoryStore.WriteClicks([]store.Click{
+		{ShortCode: "mine", IpAddress: "1.1.1.1", Referer: "=HYPERLINK(\"http://evil\")", ClickedAt: now.Add(-time.Hour), Country: "DE"},
+		{ShortCode: "mine", IpAddress: "2.2.2.2", ClickedAt: now.Add(-10 * 24 * time.Hour)},
+		{ShortCode: "mine", IpAddress: "3.3.3.3", ClickedAt: now.Add(-40 * 24 * time.Hour)},
+		{ShortCode: "theirs", IpAddress: "4.4.4.4", ClickedAt: now.Add(-time.Hour)},
+	})
+	assert.NoError(t, err)
+
+	// The default range covers the last 30 days, oldest first
+	w := getExport(r, "/me/export/clicks", key)
+	assert.Equal(t, http.StatusOK, w.Code)
+	records, err := csv.NewReader(w.Body).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+	assert.Equal(t, "2.2.2.2", records[1][2])
+	assert.Equal(t, "1.1.1.1", records[2][2])
+	assert.Equal(t, "DE", records[2][5])
+	// Formulas are defused for spreadsheets
+	assert.True(t, strings.HasPrefix(records[2][4], "'="))
+
+	from := now.Add(-2 * 24 * time.Hour).UTC().Format(time.RFC3339)
+	w = getExport(r, "/me/export/clicks?format=ndjson&from="+from, key)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var row clickExportRow
+	assert.NoError(t, json.Unmarshal([]byte(strings.TrimSpace(w.Body.String())), &row))
+	assert.Equal(t, "=HYPERLINK(\"http://evil\")", row.Referer)
+
+	// Raw clicks are subject to the plan's retention
+	from = now.AddDate(0, 0, -60).Format(time.DateOnly)
+	w = getExport(r, "/me/export/clicks?from="+from, key)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "retention_exceeded")
+}
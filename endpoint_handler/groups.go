@@ -0,0 +1,424 @@
+package endpoint_handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"url-shortener/auth"
+	"url-shortener/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxGroupNameLength = 64
+
+// Links per page of a listing
+const (
+	defaultLinkPageSize = 50
+	maxLinkPageSize     = 200
+)
+
+// Request model for creating or renaming a tag or campaign
+type GroupRequest struct {
+	Name string `json:"name"`
+}
+
+// Request model for replacing the tags of a link
+type LinkTagsRequest struct {
+	TagIds []string `json:"tag_ids"`
+}
+
+// Request model for moving a link into a campaign. An empty or null
+// campaign_id takes the link out of its campaign.
+type LinkCampaignRequest struct {
+	CampaignId *string `json:"campaign_id"`
+}
+
+// Tags and campaigns of the authenticated user. The handlers for both are
+// the same apart from the kind of group.
+
+func (h *Handler) CreateTag(c *gin.Context)      { h.createGroup(c, store.GroupTag) }
+func (h *Handler) ListTags(c *gin.Context)       { h.listGroups(c, store.GroupTag) }
+func (h *Handler) RenameTag(c *gin.Context)      { h.renameGroup(c, store.GroupTag) }
+func (h *Handler) DeleteTag(c *gin.Context)      { h.deleteGroup(c, store.GroupTag) }
+func (h *Handler) TagStats(c *gin.Context)       { h.groupStats(c, store.GroupTag) }
+func (h *Handler) CreateCampaign(c *gin.Context) { h.createGroup(c, store.GroupCampaign) }
+func (h *Handler) ListCampaigns(c *gin.Context)  { h.listGroups(c, store.GroupCampaign) }
+func (h *Handler) RenameCampaign(c *gin.Context) { h.renameGroup(c, store.GroupCampaign) }
+func (h *Handler) DeleteCampaign(c *gin.Context) { h.deleteGroup(c, store.GroupCampaign) }
+func (h *Handler) CampaignStats(c *gin.Context)  { h.groupStats(c, store.GroupCampaign) }
+
+func (h *Handler) createGroup(c *gin.Context, kind string) {
+	user, _ := auth.CurrentUser(c)
+	name, ok := groupName(c)
+	if !ok {
+		return
+	}
+
+	group, err := h.groups.CreateGroup(kind, store.Group{UserId: user.Id, Name: name})
+	if !writeGroupError(c, kind, err) {
+		return
+	}
+	log.Printf("%s %s created for user %s", kind, group.Id, user.Id)
+	c.JSON(http.StatusCreated, gin.H{"message": kind + " created successfully", kind: group})
+}
+
+func (h *Handler) listGroups(c *gin.Context, kind string) {
+	user, _ := auth.CurrentUser(c)
+	groups, err := h.groups.ListGroups(kind, user.Id)
+	if !writeGroupError(c, kind, err) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{kind + "s": groups})
+}
+
+func (h *Handler) renameGroup(c *gin.Context, kind string) {
+	user, _ := auth.CurrentUser(c)
+	name, ok := groupName(c)
+	if !ok {
+		return
+	}
+
+	group, err := h.groups.RenameGroup(kind, user.Id, c.Param("id"), name)
+	if !writeGroupError(c, kind, err) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": kind + " renamed successfully", kind: group})
+}
+
+func (h *Handler) deleteGroup(c *gin.Context, kind string) {
+	user, _ := auth.CurrentUser(c)
+	err := h.groups.DeleteGroup(kind, user.Id, c.Param("id"))
+	if !writeGroupError(c, kind, err) {
+		return
+	}
+	log.Printf("%s %s deleted by user %s", kind, c.Param("id"), user.Id)
+	c.JSON(http.StatusOK, gin.H{"message": kind + " deleted successfully", "id": c.Param("id")})
+}
+
+// Click analytics of every link in a group, with the same parameters as
+// LinkStats and the links with the most clicks on top
+func (h *Handler) groupStats(c *gin.Context, kind string) {
+	user, _ := auth.CurrentUser(c)
+	now := time.Now()
+	query, field, err := parseStatsQuery(c, now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "field": field})
+		return
+	}
+
+	groups, err := h.groups.ListGroups(kind, user.Id)
+	if !writeGroupError(c, kind, err) {
+		return
+	}
+	group, found := findGroup(groups, c.Param("id"))
+	if !found {
+		writeGroupError(c, kind, store.ErrNotFound)
+		return
+	}
+	if kind == store.GroupTag {
+		query.TagId = group.Id
+	} else {
+		query.CampaignId = group.Id
+	}
+	h.serveStats(c, query, user.Id, now, gin.H{kind: group})
+}
+
+// SetLinkTags replaces the tags of a link. Only the owner's tags may be
+// used.
+func (h *Handler) SetLinkTags(c *gin.Context) {
+	var tagsRequest LinkTagsRequest
+	if err := c.ShouldBindJSON(&tagsRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	link, ok := h.ownedLink(c, c.Param("code"))
+	if !ok {
+		return
+	}
+	if !h.checkLinkGroups(c, link.UserId, tagsRequest.TagIds, "") {
+		return
+	}
+
+	err := h.groups.SetLinkTags(link.ShortCode, tagsRequest.TagIds)
+	if !h.writeLinkChangeError(c, link.ShortCode, err) {
+		return
+	}
+	c.JSON(http.StatusOK, h.withLinkAddress(gin.H{
+		"message": "tags updated successfully",
+		"tag_ids": uniqueIds(tagsRequest.TagIds),
+	}, link))
+}
+
+// SetLinkCampaign moves a link into one of the owner's campaigns, or out of
+// its campaign
+func (h *Handler) SetLinkCampaign(c *gin.Context) {
+	var campaignRequest LinkCampaignRequest
+	if err := c.ShouldBindJSON(&campaignRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	link, ok := h.ownedLink(c, c.Param("code"))
+	if !ok {
+		return
+	}
+	campaignId := ""
+	if campaignRequest.CampaignId != nil {
+		campaignId = *campaignRequest.CampaignId
+	}
+	if !h.checkLinkGroups(c, link.UserId, nil, campaignId) {
+		return
+	}
+
+	err := h.groups.SetLinkCampaign(link.ShortCode, campaignId)
+	if !h.writeLinkChangeError(c, link.ShortCode, err) {
+		return
+	}
+	c.JSON(http.StatusOK, h.withLinkAddress(gin.H{
+		"message":     "campaign updated successfully",
+		"campaign_id": campaignId,
+	}, link))
+}
+
+// A link in a listing
+type linkListRow struct {
+	linkAddress
+	OriginalUrl string    `json:"original_url"`
+	Title       string    `json:"title,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	Clicks      int64     `json:"clicks"`
+	Status      string    `json:"status"`
+	CampaignId  string    `json:"campaign_id,omitempty"`
+	TagIds      []string  `json:"tag_ids"`
+	store.UTM
+}
+
+// ListLinks pages through the authenticated user's links, newest first.
+// Query parameters: tag and campaign (IDs) to filter by, limit, and cursor
+// to continue from the next_cursor of the previous page.
+func (h *Handler) ListLinks(c *gin.Context) {
+	user, _ := auth.CurrentUser(c)
+	query := store.LinkListQuery{
+		UserId:     user.Id,
+		TagId:      c.Query("tag"),
+		CampaignId: c.Query("campaign"),
+		Limit:      defaultLinkPageSize,
+	}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxLinkPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxLinkPageSize), "field": "limit"})
+			return
+		}
+		query.Limit = limit
+	}
+	if value := c.Query("cursor"); value != "" {
+		cursor, err := decodeLinkCursor(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor", "field": "cursor"})
+			return
+		}
+		query.Before = cursor
+	}
+
+	links, err := h.lister.ListLinks(query)
+	if errors.Is(err, store.ErrRequiresDatabase) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Error listing links of user %s: %v", user.Id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list links"})
+		return
+	}
+
+	hosts := h.domainHosts(user.Id)
+	rows := make([]linkListRow, len(links))
+	for i, link := range links {
+		rows[i] = linkListRow{
+			linkAddress: addressOf(link.ShortCode, hosts),
+			OriginalUrl: link.OriginalUrl,
+			Title:       link.Title,
+			CreatedAt:   link.CreatedAt,
+			Clicks:      link.Clicks,
+			Status:      link.Status,
+			CampaignId:  link.CampaignId,
+			TagIds:      append([]string{}, link.TagIds...),
+			UTM:         link.UTM,
+		}
+	}
+	response := gin.H{"links": rows}
+	if len(links) == query.Limit {
+		response["next_cursor"] = encodeLinkCursor(links[len(links)-1].Cursor())
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// Cursors are opaque to clients: the creation time and code of the last
+// link of a page
+func encodeLinkCursor(cursor store.ExportCursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(cursor.Time.UnixNano(), 10) + ":" + cursor.Id))
+}
+
+func decodeLinkCursor(value string) (store.ExportCursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return store.ExportCursor{}, err
+	}
+	nanos, code, found := strings.Cut(string(decoded), ":")
+	if !found {
+		return store.ExportCursor{}, errors.New("cursor has no code")
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return store.ExportCursor{}, err
+	}
+	return store.ExportCursor{Time: time.Unix(0, n), Id: code}, nil
+}
+
+// Check that the tags and campaign a link is to be filed under belong to
+// ownerId. Writes the error response and returns false when they do not.
+func (h *Handler) checkLinkGroups(c *gin.Context, ownerId string, tagIds []string, campaignId string) bool {
+	field, err := h.ownerGroups(ownerId).check(tagIds, campaignId)
+	switch {
+	case err == nil:
+		return true
+	case field != "":
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "field": field})
+	default:
+		writeGroupError(c, store.GroupTag, err)
+	}
+	return false
+}
+
+// Returned when a link is filed under a group its owner does not have
+var errUnknownGroup = errors.New("unknown")
+
+// The tag and campaign IDs of one user, loaded on first use so that links
+// without groups cost nothing and a bulk request loads them once
+type groupIndex struct {
+	groups  store.GroupStore
+	ownerId string
+	ids     map[string]map[string]bool
+}
+
+func (h *Handler) ownerGroups(ownerId string) *groupIndex {
+	return &groupIndex{groups: h.groups, ownerId: ownerId, ids: make(map[string]map[string]bool)}
+}
+
+// What is wrong with filing a link under these groups. Errors about the
+// groups come with the offending field, store failures without.
+func (g *groupIndex) check(tagIds []string, campaignId string) (string, error) {
+	for _, id := range tagIds {
+		if err := g.lookup(store.GroupTag, id); err != nil {
+			return fieldOf(err, "tag_ids"), err
+		}
+	}
+	if campaignId != "" {
+		if err := g.lookup(store.GroupCampaign, campaignId); err != nil {
+			return fieldOf(err, "campaign_id"), err
+		}
+	}
+	return "", nil
+}
+
+func (g *groupIndex) lookup(kind string, id string) error {
+	ids, loaded := g.ids[kind]
+	if !loaded {
+		groups, err := g.groups.ListGroups(kind, g.ownerId)
+		if err != nil {
+			return err
+		}
+		ids = make(map[string]bool, len(groups))
+		for _, group := range groups {
+			ids[group.Id] = true
+		}
+		g.ids[kind] = ids
+	}
+	if !ids[id] {
+		return fmt.Errorf("%w %s %q", errUnknownGroup, kind, id)
+	}
+	return nil
+}
+
+func fieldOf(err error, field string) string {
+	if errors.Is(err, errUnknownGroup) {
+		return field
+	}
+	return ""
+}
+
+// File a saved link under the tags and campaign it was created with
+func (h *Handler) assignLinkGroups(shortCode string, tagIds []string, campaignId string) error {
+	if len(tagIds) > 0 {
+		if err := h.groups.SetLinkTags(shortCode, tagIds); err != nil {
+			return err
+		}
+	}
+	if campaignId != "" {
+		return h.groups.SetLinkCampaign(shortCode, campaignId)
+	}
+	return nil
+}
+
+// Read and check the name of a group from the request body. Writes the
+// error response and returns false when it is not valid.
+func groupName(c *gin.Context) (string, bool) {
+	var groupRequest GroupRequest
+	if err := c.ShouldBindJSON(&groupRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", false
+	}
+	name := strings.TrimSpace(groupRequest.Name)
+	if name == "" || len([]rune(name)) > maxGroupNameLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("name must be between 1 and %d characters", maxGroupNameLength), "field": "name"})
+		return "", false
+	}
+	return name, true
+}
+
+func findGroup(groups []store.Group, id string) (store.Group, bool) {
+	for _, group := range groups {
+		if group.Id == id {
+			return group, true
+		}
+	}
+	return store.Group{}, false
+}
+
+// IDs in order of first appearance, without repeats
+func uniqueIds(ids []string) []string {
+	seen := make(map[string]bool)
+	result := []string{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// Report a failed group operation. Returns true when there was nothing to
+// report.
+func writeGroupError(c *gin.Context, kind string, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, store.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": kind + " not found"})
+	case errors.Is(err, store.ErrGroupNameTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": "a " + kind + " with this name already exists", "field": "name"})
+	case errors.Is(err, store.ErrRequiresDatabase):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Error managing %ss: %v", kind, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update " + kind + "s"})
+	}
+	return false
+}
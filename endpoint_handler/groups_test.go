@@ -0,0 +1,168 @@
+package endpoint_handler
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"url-shortener/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func createGroup(t *testing.T, r *gin.Engine, key string, kind string, name string) string {
+	t.Helper()
+	code, response := authorizedRequest(r, http.MethodPost, "/"+kind+"s", key, fmt.Sprintf(`{"name": %q}`, name))
+	assert.Equal(t, http.StatusCreated, code)
+	return response[kind].(map[string]interface{})["id"].(string)
+}
+
+func TestGroupLifecycle(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	r := setupRouter(memoryStore)
+	key := issueAPIKey(t, memoryStore, "user-1")
+	otherKey := issueAPIKey(t, memoryStore, "user-2")
+
+	tagId := createGroup(t, r, key, store.GroupTag, "  launch ")
+	code, response := authorizedRequest(r, http.MethodPost, "/tags", key, `{"name": "launch"}`)
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, "name", response["field"])
+	code, _ = authorizedRequest(r, http.MethodPost, "/tags", key, `{"name": " "}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// Names are per user
+	createGroup(t, r, otherKey, store.GroupTag, "launch")
+
+	code, response = authorizedRequest(r, http.MethodPut, "/tags/"+tagId, key, `{"name": "relaunch"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "relaunch", response["tag"].(map[string]interface{})["name"])
+	code, _ = authorizedRequest(r, http.MethodPut, "/tags/"+tagId, otherKey, `{"name": "stolen"}`)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, response = authorizedRequest(r, http.MethodGet, "/tags", key, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, response["tags"], 1)
+
+	code, _ = authorizedRequest(r, http.MethodDelete, "/tags/"+tagId, otherKey, "")
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _ = authorizedRequest(r, http.MethodDelete, "/tags/"+tagId, key, "")
+	assert.Equal(t, http.StatusOK, code)
+	code, response = authorizedRequest(r, http.MethodGet, "/tags", key, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, response["tags"], 0)
+
+	code, _ = authorizedRequest(r, http.MethodGet, "/campaigns", "", "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+func TestAssignGroups(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	r := setupRouter(memoryStore)
+	key := issueAPIKey(t, memoryStore, "user-1")
+	otherKey := issueAPIKey(t, memoryStore, "user-2")
+	tagId := createGroup(t, r, key, store.GroupTag, "docs")
+	campaignId := createGroup(t, r, key, store.GroupCampaign, "spring")
+	otherTagId := createGroup(t, r, otherKey, store.GroupTag, "docs")
+
+	// On create
+	code, response := authorizedRequest(r, http.MethodPost, "/create-short-url", key, fmt.Sprintf(`{"long_url": "https://example.com/a", "alias": "filed", "tag_ids": [%q], "campaign_id": %q}`, tagId, campaignId))
+	assert.Equal(t, http.StatusOK, code)
+	code, response = authorizedRequest(r, http.MethodPost, "/create-short-url", key, fmt.Sprintf(`{"long_url": "https://example.com/b", "tag_ids": [%q]}`, otherTagId))
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "tag_ids", response["field"])
+	code, response = authorizedRequest(r, http.MethodPost, "/create-short-url", key, `{"long_url": "https://example.com/b", "campaign_id": "missing"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "campaign_id", response["field"])
+
+	// Later
+	authorizedRequest(r, http.MethodPost, "/create-short-url", key, `{"long_url": "https://example.com/c", "alias": "later"}`)
+	code, _ = authorizedRequest(r, http.MethodPut, "/links/later/tags", key, fmt.Sprintf(`{"tag_ids": [%q, %q]}`, tagId, tagId))
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = authorizedRequest(r, http.MethodPut, "/links/later/tags", otherKey, fmt.Sprintf(`{"tag_ids": [%q]}`, otherTagId))
+	assert.Equal(t, http.StatusForbidden, code)
+	code, _ = authorizedRequest(r, http.MethodPut, "/links/later/campaign", key, fmt.Sprintf(`{"campaign_id": %q}`, campaignId))
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = authorizedRequest(r, http.MethodPut, "/links/later/campaign", key, `{"campaign_id": null}`)
+	assert.Equal(t, http.StatusOK, code)
+
+	code, response = authorizedRequest(r, http.MethodGet, "/me/links?tag="+tagId, key, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, response["links"], 2)
+	code, response = authorizedRequest(r, http.MethodGet, "/me/links?campaign="+campaignId, key, "")
+	assert.Equal(t, http.StatusOK, code)
+	links := response["links"].([]interface{})
+	assert.Len(t, links, 1)
+	assert.Equal(t, "filed", links[0].(map[string]interface{})["short_code"])
+	assert.Equal(t, []interface{}{tagId}, links[0].(map[string]interface{})["tag_ids"])
+
+	// Deleting a campaign leaves its links in place
+	code, _ = authorizedRequest(r, http.MethodDelete, "/campaigns/"+campaignId, key, "")
+	assert.Equal(t, http.StatusOK, code)
+	code, response = authorizedRequest(r, http.MethodGet, "/me/links", key, "")
+	assert.Equal(t, http.StatusOK, code)
+	for _, link := range response["links"].([]interface{}) {
+		assert.Nil(t, link.(map[string]interface{})["campaign_id"])
+	}
+}
+
+func TestListLinksPages(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	r := setupRouter(memoryStore)
+	key := issueAPIKey(t, memoryStore, "user-1")
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, memoryStore.SaveLink(store.Link{ShortCode: fmt.Sprintf("page-%d", i), OriginalUrl: "https://example.com", UserId: "user-1"}))
+	}
+	assert.NoError(t, memoryStore.SaveLink(store.Link{ShortCode: "other", OriginalUrl: "https://example.com", UserId: "user-2"}))
+
+	seen := make(map[string]bool)
+	path := "/me/links?limit=2"
+	for pages := 0; path != ""; pages++ {
+		assert.Less(t, pages, 4)
+		code, response := authorizedRequest(r, http.MethodGet, path, key, "")
+		assert.Equal(t, http.StatusOK, code)
+		for _, link := range response["links"].([]interface{}) {
+			shortCode := link.(map[string]interface{})["short_code"].(string)
+			assert.False(t, seen[shortCode], "duplicate link %s", shortCode)
+			seen[shortCode] = true
+		}
+		path = ""
+		if cursor, ok := response["next_cursor"].(string); ok {
+			path = "/me/links?limit=2&cursor=" + cursor
+		}
+	}
+	assert.Len(t, seen, 5)
+	assert.False(t, seen["other"])
+
+	code, response := authorizedRequest(r, http.MethodGet, "/me/links?cursor=bogus!", key, "")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "cursor", response["field"])
+	code, _ = authorizedRequest(r, http.MethodGet, "/me/links?limit=0", key, "")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestGroupStats(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	r := setupRouter(memoryStore)
+	key := issueAPIKey(t, memoryStore, "user-1")
+	otherKey := issueAPIKey(t, memoryStore, "user-2")
+	campaignId := createGroup(t, r, key, store.GroupCampaign, "autumn")
+
+	for _, alias := range []string{"first", "second", "outside"} {
+		assert.NoError(t, memoryStore.SaveLink(store.Link{ShortCode: alias, OriginalUrl: "https://example.com", UserId: "user-1"}))
+	}
+	assert.NoError(t, memoryStore.SetLinkCampaign("first", campaignId))
+	assert.NoError(t, memoryStore.SetLinkCampaign("second", campaignId))
+	for _, shortCode := range []string{"first", "second", "second", "outside"} {
+		assert.NoError(t, memoryStore.TrackUrlClick(shortCode, "guest-user", "1.2.3.4", "agent", ""))
+	}
+
+	code, response := authorizedRequest(r, http.MethodGet, "/campaigns/"+campaignId+"/stats", key, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(3), response["total_clicks"])
+	topLinks := response["top_links"].([]interface{})
+	assert.Len(t, topLinks, 2)
+	assert.Equal(t, "autumn", response["campaign"].(map[string]interface{})["name"])
+
+	code, _ = authorizedRequest(r, http.MethodGet, "/campaigns/"+campaignId+"/stats", otherKey, "")
+	assert.Equal(t, http.StatusNotFound, code)
+}
@@ -1,24 +1,139 @@
 package endpoint_handler
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"log"
 	"os"
+	"time"
+	"url-shortener/auth"
+	"url-shortener/domains"
+	"url-shortener/metadata"
+	"url-shortener/plan"
+	"url-shortener/qr"
+	"url-shortener/screening"
 	shorturl "url-shortener/shorturl"
 	"url-shortener/store"
 
 	"github.com/gin-gonic/gin"
 )
 
+// Handler serves the HTTP endpoints on top of the configured store backend
+type Handler struct {
+	links     store.LinkStore
+	batches   store.LinkBatchSaver
+	versions  store.LinkVersionStore
+	clicks    store.ClickStore
+	stats     store.StatsStore
+	apiKeys   store.APIKeyStore
+	users     store.UserStore
+	usage     store.UsageStore
+	exports   store.ExportStore
+	groups    store.GroupStore
+	lister    store.LinkLister
+	presets   store.UTMPresetStore
+	domains   store.DomainStore
+	routes    *domainRoutes
+	verifier  *domains.Verifier
+	tiers     *plan.Resolver
+	reserved  *shorturl.ReservedWords
+	screener  *screening.Screener
+	qrCodes   *qr.Cache
+	describer *metadata.Queue
+
+	unlockAttempts *attemptLimiter
+}
+
+// Returned when a custom alias is on the reserved list
+var errAliasReserved = errors.New("alias is reserved")
+
+// Reported when screening refuses a destination
+const destinationBlockedMessage = "This destination is not allowed"
+
+// Initializing a handler on top of a store backend. Clicks are tracked
+// through clicks, which may be the store itself or a queue in front of it.
+// Codes in reserved are never handed out; it may be nil. Plan limits follow
+// the tiers resolved by tiers. Destinations are checked by screener, which
+// may be nil to allow everything, and described in the background by
+// describer, which may be nil to skip that.
+func New(storage store.Store, clicks store.ClickStore, reserved *shorturl.ReservedWords, tiers *plan.Resolver, screener *screening.Screener, describer *metadata.Queue, verifier *domains.Verifier) *Handler {
+	return &Handler{
+		links:          storage,
+		batches:        storage,
+		versions:       storage,
+		clicks:         clicks,
+		stats:          storage,
+		apiKeys:        storage,
+		users:          storage,
+		usage:          storage,
+		exports:        storage,
+		groups:         storage,
+		lister:         storage,
+		presets:        storage,
+		domains:        storage,
+		routes:         newDomainRoutes(storage),
+		verifier:       verifier,
+		tiers:          tiers,
+		reserved:       reserved,
+		screener:       screener,
+		qrCodes:        qr.NewCache(qr.DefaultCacheBytes),
+		describer:      describer,
+		unlockAttempts: newAttemptLimiter(maxUnlockAttempts, unlockWindow),
+	}
+}
+
 // Request model definition
 type UrlCreationRequest struct {
 	LongUrl  string `json:"long_url"`  // Original field
-	UserId   string `json:"user_id"`   // Original field
 	LongURL  string `json:"longUrl"`   // New frontend field (alternative)
-	UserID   string `json:"userId"`    // New frontend field (alternative)
+	Alias    string `json:"alias"`     // Optional custom short code
+
+	ExpiresAt *time.Time `json:"expires_at"` // Optional absolute expiry (RFC 3339)
+	ExpiresIn int64      `json:"expires_in"` // Optional lifetime in seconds
+	Password  string     `json:"password"`   // Optional password guarding the redirect
+
+	QR *qr.Request `json:"qr"` // Optional QR code of the short URL in the response
+
+	TagIds     []string `json:"tag_ids"`     // Optional tags of the owner to file the link under
+	CampaignId string   `json:"campaign_id"` // Optional campaign of the owner
+
+	// Optional UTM parameters added to the destination's query string, on
+	// their own or on top of one of the owner's saved presets
+	store.UTM
+	UTMPreset string `json:"utm_preset"`
+
+	Domain string `json:"domain"` // Optional verified custom domain to issue the link under
 }
 
-func CreateShortUrl(c *gin.Context) {
+// Work out when the requested link expires, if ever. Either an absolute time
+// or a lifetime may be given, not both, and the result must lie in the future.
+func (r UrlCreationRequest) expiry(now time.Time) (*time.Time, error) {
+	if r.ExpiresAt != nil && r.ExpiresIn != 0 {
+		return nil, errors.New("use either expires_at or expires_in, not both")
+	}
+	if r.ExpiresIn < 0 {
+		return nil, errors.New("expires_in must be a positive number of seconds")
+	}
+
+	var expiresAt time.Time
+	switch {
+	case r.ExpiresAt != nil:
+		expiresAt = *r.ExpiresAt
+	case r.ExpiresIn > 0:
+		expiresAt = now.Add(time.Duration(r.ExpiresIn) * time.Second)
+	default:
+		return nil, nil
+	}
+
+	if !expiresAt.After(now) {
+		return nil, errors.New("expiry must be in the future")
+	}
+	expiresAt = expiresAt.UTC()
+	return &expiresAt, nil
+}
+
+func (h *Handler) CreateShortUrl(c *gin.Context) {
 	var creationRequest UrlCreationRequest
 	if err := c.ShouldBindJSON(&creationRequest); err != nil {
 		log.Printf("Error binding JSON: %v", err)
@@ -30,34 +145,98 @@ func CreateShortUrl(c *gin.Context) {
 
 	// Handle both naming conventions
 	longUrl := creationRequest.LongUrl
-	userId := creationRequest.UserId
 	
 	if longUrl == "" {
 		longUrl = creationRequest.LongURL
 	}
 	
-	if userId == "" {
-		userId = creationRequest.UserID
-		// If still empty, use a default
-		if userId == "" {
-			userId = "guest-user"
-		}
+	// Links belong to the authenticated caller. Anyone else creates them as
+	// a guest, whatever user ID they send, so plans and quotas cannot be
+	// borrowed from another account.
+	userId := "guest-user"
+	if user, ok := auth.CurrentUser(c); ok {
+		userId = user.Id
 	}
-	
+
 	log.Printf("Processed values - longUrl: %s, userId: %s", longUrl, userId)
 	
 	// Validation
-	if longUrl == "" {
-		log.Printf("Error: URL is required")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "URL is required"})
+	creationRequest.LongUrl = longUrl
+	link, field, err := h.buildLink(creationRequest, userId, time.Now())
+	if err != nil {
+		log.Printf("Error: Invalid %s: %v", field, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "field": field})
 		return
 	}
 
-	shortUrl := shorturl.GenerateShortLink(longUrl, userId)
-	log.Printf("Generated short URL: %s", shortUrl)
-	
-	// Handle database save error
-	err := store.SaveUrlMapping(shortUrl, longUrl, userId)
+	// Malicious destinations are refused outright, suspicious ones are held
+	// for review
+	verdict := h.screener.Check(link.OriginalUrl)
+	if verdict.Action == screening.Block {
+		log.Printf("Blocked destination %s: %s", link.OriginalUrl, verdict.Reason)
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":  destinationBlockedMessage,
+			"code":   "destination_blocked",
+			"reason": verdict.Reason,
+			"field":  "long_url",
+		})
+		return
+	}
+	if verdict.Action == screening.Quarantine {
+		link.QuarantineReason = verdict.Reason
+	}
+
+	var qrOptions qr.Options
+	if creationRequest.QR != nil {
+		qrOptions, field, err = creationRequest.QR.Options()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "field": "qr." + field})
+			return
+		}
+	}
+
+	if !h.checkLinkGroups(c, userId, creationRequest.TagIds, creationRequest.CampaignId) {
+		return
+	}
+
+	domain, err := h.creationDomain(creationRequest.Domain, userId)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "field": "domain"})
+		return
+	}
+
+	if !h.checkLinkQuota(c, link) {
+		return
+	}
+
+	alias := creationRequest.Alias
+	expiresAt := link.ExpiresAt
+	var shortUrl string
+	if alias != "" {
+		shortUrl, err = h.claimAlias(alias, link, domain.Id)
+	} else {
+		shortUrl, err = h.allocateShortCode(link, domain.Id)
+	}
+	if errors.Is(err, errAliasReserved) {
+		log.Printf("Alias is reserved: %s", creationRequest.Alias)
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Alias is reserved",
+			"alias": creationRequest.Alias,
+		})
+		return
+	}
+	if errors.Is(err, store.ErrShortCodeTaken) {
+		log.Printf("Alias already taken: %s", creationRequest.Alias)
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Alias is already taken",
+			"alias": creationRequest.Alias,
+		})
+		return
+	}
+	if errors.Is(err, store.ErrRequiresDatabase) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Password-protected and quarantined links are temporarily unavailable"})
+		return
+	}
 	if err != nil {
 		log.Printf("Error saving URL mapping: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -66,9 +245,101 @@ func CreateShortUrl(c *gin.Context) {
 		})
 		return
 	}
+	log.Printf("Generated short URL: %s", shortUrl)
+	_, shortCode := store.SplitDomainCode(shortUrl)
+
+	if err := h.assignLinkGroups(shortUrl, creationRequest.TagIds, creationRequest.CampaignId); err != nil {
+		log.Printf("Error filing %s under its tags and campaign: %v", shortUrl, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Link created but its tags and campaign could not be saved",
+			"short_url": shortUrlOn(domain.Host, shortCode),
+		})
+		return
+	}
 
 	log.Printf("Successfully saved URL mapping for user %s", userId)
 
+	response := gin.H{
+		"message":   "short url created successfully",
+		"short_url": shortUrlOn(domain.Host, shortCode),
+	}
+	if domain.Host != "" {
+		response["domain"] = domain.Host
+	}
+	if expiresAt != nil {
+		response["expires_at"] = expiresAt
+	}
+	if link.IsProtected() {
+		response["password_protected"] = true
+	}
+	if !link.UTM.IsZero() {
+		response["long_url"] = link.OriginalUrl
+		response["utm"] = link.UTM
+	}
+	if creationRequest.QR != nil {
+		response["qr"] = h.qrResponse(shortUrlOn(domain.Host, shortCode), qrOptions)
+	}
+	if link.IsQuarantined() {
+		log.Printf("Short URL %s quarantined: %s", shortUrl, link.QuarantineReason)
+		response["message"] = "short url created and held for review"
+		response["status"] = "quarantined"
+		response["reason"] = link.QuarantineReason
+		c.JSON(http.StatusAccepted, response)
+		return
+	}
+	link.ShortCode = shortUrl
+	h.describe(link)
+	c.JSON(200, response)
+}
+
+// Fetch the title and description of a saved link's destination in the
+// background. Quarantined destinations are left alone until released.
+func (h *Handler) describe(link store.Link) {
+	if h.describer == nil || link.IsQuarantined() {
+		return
+	}
+	if !h.describer.Enqueue(link.ShortCode, link.OriginalUrl) {
+		log.Printf("Warning: Metadata queue full, not describing %s", link.ShortCode)
+	}
+}
+
+// Turn a creation request into a link owned by userId: the destination is
+// normalized and the expiry, password and alias are checked. On failure the
+// offending field is returned with the error.
+func (h *Handler) buildLink(request UrlCreationRequest, userId string, now time.Time) (store.Link, string, error) {
+	utm, field, err := h.requestUTM(request, userId)
+	if err != nil {
+		return store.Link{}, field, err
+	}
+	longUrl, err := shorturl.NormalizeUrl(withUTM(request.LongUrl, utm))
+	if err != nil {
+		return store.Link{}, "long_url", err
+	}
+
+	expiresAt, err := request.expiry(now)
+	if err != nil {
+		return store.Link{}, "expires_at", err
+	}
+
+	link := store.Link{OriginalUrl: longUrl, UserId: userId, ExpiresAt: expiresAt, UTM: utm}
+	if request.Password != "" {
+		link.PasswordHash, err = hashPassword(request.Password)
+		if err != nil {
+			return store.Link{}, "password", err
+		}
+	}
+
+	if request.Alias != "" {
+		if err := shorturl.ValidateAlias(request.Alias); err != nil {
+			return store.Link{}, "alias", err
+		}
+		link.CustomAlias = true
+	}
+	return link, "", nil
+}
+
+// Base of the short URLs handed out, ending in "/"
+func baseUrl() string {
 	// Use the correct host URL based on environment
 	host := os.Getenv("BASE_URL")
 	if host == "" {
@@ -79,30 +350,122 @@ func CreateShortUrl(c *gin.Context) {
 			host = "https://shrinkr-2k0u.onrender.com/"
 		}
 	}
-	
+
 	// Ensure host ends with "/"
 	if host[len(host)-1] != '/' {
 		host += "/"
 	}
+	return host
+}
 
-	c.JSON(200, gin.H{
-		"message":   "short url created successfully",
-		"short_url": host + shortUrl,
-	})
+// Save the mapping under the first candidate code that is free or already
+// points at the same URL for the same user and not reserved. Taken codes are
+// never overwritten. Returns the key the link was saved under on the domain.
+func (h *Handler) allocateShortCode(link store.Link, domainId string) (string, error) {
+	for attempt := 0; attempt < shorturl.MaxAttempts; attempt++ {
+		shortUrl := shorturl.GenerateShortLinkAttempt(link.OriginalUrl, link.UserId, attempt)
+		if h.reserved.IsReserved(shortUrl) {
+			log.Printf("Short code %s is reserved, retrying", shortUrl)
+			continue
+		}
+		link.ShortCode = store.DomainCode(domainId, shortUrl)
+		err := h.links.SaveLink(link)
+		if errors.Is(err, store.ErrShortCodeTaken) {
+			log.Printf("Short code collision on %s, retrying", shortUrl)
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return link.ShortCode, nil
+	}
+	return "", fmt.Errorf("no free short code after %d attempts", shorturl.MaxAttempts)
+}
+
+// Save the mapping under a user-chosen alias. Unlike generated codes there is
+// no retry: a taken alias is reported back as store.ErrShortCodeTaken. Only
+// the domain's own links count.
+func (h *Handler) claimAlias(alias string, link store.Link, domainId string) (string, error) {
+	if h.reserved.IsReserved(alias) {
+		return "", errAliasReserved
+	}
+	link.ShortCode = store.DomainCode(domainId, alias)
+	available, err := h.links.IsShortCodeAvailable(link.ShortCode)
+	if err != nil {
+		return "", err
+	}
+	if !available {
+		return "", store.ErrShortCodeTaken
+	}
+	if err := h.links.SaveLink(link); err != nil {
+		return "", err
+	}
+	return link.ShortCode, nil
 }
 
-func HandleShortUrlRedirect(c *gin.Context) {
+func (h *Handler) HandleShortUrlRedirect(c *gin.Context) {
 	shortUrl := c.Param("shortUrl")
 	log.Printf("Handling redirect request for short URL: %s", shortUrl)
-	
-	initialUrl := store.RetrieveInitialUrl(shortUrl)
-	
-	if initialUrl == "" {
+
+	link, ok := h.resolveLink(c, shortUrl)
+	if !ok {
+		return
+	}
+
+	// Protected links only reveal their destination after the password
+	if link.IsProtected() {
+		renderPasswordPrompt(c, http.StatusOK, shortUrl, "")
+		return
+	}
+
+	h.redirect(c, link, http.StatusFound)
+}
+
+// Look up a short code for redirecting, on the domain the request came in
+// on. Unknown and deactivated codes answer
+// 404, expired ones 410, quarantined ones and destinations that screening
+// no longer allows 403; in all cases the response is already written.
+func (h *Handler) resolveLink(c *gin.Context, shortUrl string) (store.Link, bool) {
+	shortUrl, ok := h.routedCode(c, shortUrl)
+	if !ok {
+		return store.Link{}, false
+	}
+	link, err := h.links.RetrieveLink(shortUrl)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.Printf("Warning: Failed to retrieve short URL %s: %v", shortUrl, err)
+	}
+	if err != nil || (!link.IsActive && !link.IsExpired(time.Now())) {
 		log.Printf("Short URL not found: %s", shortUrl)
 		c.JSON(http.StatusNotFound, gin.H{"error": "Short URL not found"})
-		return
+		return store.Link{}, false
 	}
-	
+
+	if link.IsExpired(time.Now()) {
+		log.Printf("Short URL has expired: %s", shortUrl)
+		c.JSON(http.StatusGone, gin.H{"error": "Short URL has expired"})
+		return store.Link{}, false
+	}
+
+	if link.IsQuarantined() {
+		log.Printf("Short URL is quarantined: %s", shortUrl)
+		c.JSON(http.StatusForbidden, gin.H{"error": "This link is under review"})
+		return store.Link{}, false
+	}
+	// Lists change after links are created, so the destination is checked
+	// again on every redirect
+	if verdict := h.screener.Recheck(link.OriginalUrl); verdict.Action != screening.Allow {
+		log.Printf("Short URL %s no longer passes screening: %s", shortUrl, verdict.Reason)
+		c.JSON(http.StatusForbidden, gin.H{"error": "This link has been blocked", "reason": verdict.Reason})
+		return store.Link{}, false
+	}
+	return link, true
+}
+
+// Track the click and send the client on to the link's destination
+func (h *Handler) redirect(c *gin.Context, link store.Link, status int) {
+	shortUrl := link.ShortCode
+	initialUrl := link.OriginalUrl
+
 	// Track the click before redirecting
 	ipAddress := c.ClientIP()
 	userAgent := c.GetHeader("User-Agent")
@@ -111,7 +474,7 @@ func HandleShortUrlRedirect(c *gin.Context) {
 	log.Printf("Tracking click for short URL: %s, IP: %s", shortUrl, ipAddress)
 	
 	// Track the click (don't fail if tracking fails)
-	err := store.TrackUrlClick(shortUrl, "guest-user", ipAddress, userAgent, referer)
+	err := h.clicks.TrackUrlClick(shortUrl, "guest-user", ipAddress, userAgent, referer)
 	if err != nil {
 		log.Printf("Warning: Failed to track click for %s: %v", shortUrl, err)
 		// Continue with redirect even if tracking fails
@@ -120,5 +483,5 @@ func HandleShortUrlRedirect(c *gin.Context) {
 	}
 	
 	log.Printf("Redirecting to: %s", initialUrl)
-	c.Redirect(302, initialUrl)
+	c.Redirect(status, initialUrl)
 }
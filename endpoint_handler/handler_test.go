@@ -0,0 +1,261 @@
+package endpoint_handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"url-shortener/auth"
+	"url-shortener/domains"
+	"url-shortener/metadata"
+	"url-shortener/plan"
+	"url-shortener/screening"
+	shorturl "url-shortener/shorturl"
+	"url-shortener/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupRouter(memoryStore *store.MemoryStore) *gin.Engine {
+	return setupScreenedRouter(memoryStore, nil)
+}
+
+func setupScreenedRouter(memoryStore *store.MemoryStore, screener *screening.Screener) *gin.Engine {
+	return setupTestRouter(memoryStore, screener, nil, nil)
+}
+
+func setupTestRouter(memoryStore *store.MemoryStore, screener *screening.Screener, describer *metadata.Queue, resolver domains.Resolver) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	reserved := shorturl.NewReservedWords("acme")
+	memoryStore.SaveUser(store.User{Id: "pro-user", SubscriptionTier: plan.Pro})
+	handler := New(memoryStore, memoryStore, reserved, plan.NewResolver(memoryStore, 0), screener, describer,
+		domains.NewVerifier(resolver))
+
+	r := gin.New()
+	r.Use(auth.APIKeys(memoryStore), auth.Sessions(memoryStore))
+	r.POST("/create-short-url", handler.CreateShortUrl)
+	r.GET("/:shortUrl", handler.HandleShortUrlRedirect)
+	r.GET("/:shortUrl/qr", handler.QRCode)
+	r.POST("/:shortUrl", handler.UnlockShortUrl)
+	r.PATCH("/links/:code", auth.Required(), handler.UpdateLink)
+	r.DELETE("/links/:code", auth.Required(), handler.DeleteLink)
+	r.GET("/links/:code/stats", auth.Required(), handler.LinkStats)
+	r.PUT("/links/:code/destination", auth.Required(), handler.UpdateDestination)
+	r.GET("/links/:code/versions", auth.Required(), handler.ListLinkVersions)
+	r.POST("/links/:code/rollback", auth.Required(), handler.RollbackDestination)
+	r.POST("/links/:code/release", auth.Required(), handler.ReleaseLink)
+	r.POST("/links/bulk", auth.Required(), handler.CreateLinksBulk)
+	r.GET("/me", auth.Required(), handler.Me)
+	r.GET("/me/usage", auth.Required(), handler.Usage)
+	r.GET("/me/export/links", auth.Required(), handler.ExportLinks)
+	r.GET("/me/export/clicks", auth.Required(), handler.ExportClicks)
+	r.GET("/me/links", auth.Required(), handler.ListLinks)
+	r.PUT("/links/:code/tags", auth.Required(), handler.SetLinkTags)
+	r.PUT("/links/:code/campaign", auth.Required(), handler.SetLinkCampaign)
+	tags := r.Group("/tags", auth.Required())
+	tags.POST("", handler.CreateTag)
+	tags.GET("", handler.ListTags)
+	tags.PUT("/:id", handler.RenameTag)
+	tags.DELETE("/:id", handler.DeleteTag)
+	tags.GET("/:id/stats", handler.TagStats)
+	campaigns := r.Group("/campaigns", auth.Required())
+	campaigns.POST("", handler.CreateCampaign)
+	campaigns.GET("", handler.ListCampaigns)
+	campaigns.PUT("/:id", handler.RenameCampaign)
+	campaigns.DELETE("/:id", handler.DeleteCampaign)
+	campaigns.GET("/:id/stats", handler.CampaignStats)
+	utmPresets := r.Group("/utm-presets", auth.Required())
+	utmPresets.POST("", handler.CreateUTMPreset)
+	utmPresets.GET("", handler.ListUTMPresets)
+	utmPresets.DELETE("/:id", handler.DeleteUTMPreset)
+	customDomains := r.Group("/domains", auth.Required())
+	customDomains.POST("", handler.CreateDomain)
+	customDomains.GET("", handler.ListDomains)
+	customDomains.POST("/:id/verify", handler.VerifyDomain)
+	customDomains.DELETE("/:id", handler.DeleteDomain)
+	apiKeys := r.Group("/api-keys", auth.Required())
+	apiKeys.POST("", handler.CreateAPIKey)
+	apiKeys.GET("", handler.ListAPIKeys)
+	apiKeys.DELETE("/:id", handler.RevokeAPIKey)
+	for _, route := range r.Routes() {
+		reserved.AddRoutePath(route.Path)
+	}
+	return r
+}
+
+func createShortUrl(t *testing.T, r *gin.Engine, body string) (int, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/create-short-url", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	_ = json.Unmarshal(w.Body.Bytes(), &response)
+	return w.Code, response
+}
+
+func TestCreateAndRedirect(t *testing.T) {
+	t.Setenv("BASE_URL", "http://short.test/")
+	memoryStore := store.NewMemoryStore()
+	r := setupRouter(memoryStore)
+
+	code, response := createShortUrl(t, r, `{"long_url": "https://example.com/page", "user_id": "user-1"}`)
+	assert.Equal(t, http.StatusOK, code)
+
+	shortUrl := response["short_url"].(string)
+	assert.True(t, strings.HasPrefix(shortUrl, "http://short.test/"))
+	shortCode := strings.TrimPrefix(shortUrl, "http://short.test/")
+
+	req := httptest.NewRequest(http.MethodGet, "/"+shortCode, nil)
+	req.Header.Set("User-Agent", "test-agent")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "https://example.com/page", w.Header().Get("Location"))
+	assert.Len(t, memoryStore.Clicks(shortCode), 1)
+}
+
+func TestCreateShortUrlRequiresUrl(t *testing.T) {
+	r := setupRouter(store.NewMemoryStore())
+
+	code, response := createShortUrl(t, r, `{"user_id": "user-1"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "URL is required", response["error"])
+}
+
+func TestCreateShortUrlValidatesUrl(t *testing.T) {
+	t.Setenv("BASE_URL", "http://short.test/")
+	memoryStore := store.NewMemoryStore()
+	r := setupRouter(memoryStore)
+
+	for _, longUrl := range []string{"javascript:alert(1)", "/relative", "https://user:pw@example.com", "https://exa mple.com"} {
+		code, response := createShortUrl(t, r, `{"long_url": "`+longUrl+`", "user_id": "user-1"}`)
+		assert.Equal(t, http.StatusBadRequest, code, longUrl)
+		assert.Equal(t, "long_url", response["field"], longUrl)
+	}
+
+	// Links are stored normalized and equivalent spellings share a code
+	_, first := createShortUrl(t, r, `{"long_url": "HTTPS://Bücher.Example:443/", "user_id": "user-1"}`)
+	_, second := createShortUrl(t, r, `{"long_url": "https://xn--bcher-kva.example/", "user_id": "user-1"}`)
+	assert.Equal(t, first["short_url"], second["short_url"])
+
+	shortCode := strings.TrimPrefix(first["short_url"].(string), "http://short.test/")
+	link, err := memoryStore.RetrieveLink(shortCode)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://xn--bcher-kva.example/", link.OriginalUrl)
+}
+
+func TestRedirectUnknownShortUrl(t *testing.T) {
+	r := setupRouter(store.NewMemoryStore())
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/unknown1", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestCreateShortUrlRetriesOnCollision(t *testing.T) {
+	t.Setenv("BASE_URL", "http://short.test/")
+	memoryStore := store.NewMemoryStore()
+	r := setupRouter(memoryStore)
+
+	// Someone else already owns the code the hash would produce
+	takenCode := shorturl.GenerateShortLink("https://example.com/mine", "user-1")
+	_ = memoryStore.SaveUrlMapping(takenCode, "https://example.com/theirs", "user-2")
+
+	code, response := createShortUrl(t, r, `{"long_url": "https://example.com/mine", "user_id": "user-1"}`)
+	assert.Equal(t, http.StatusOK, code)
+
+	shortCode := strings.TrimPrefix(response["short_url"].(string), "http://short.test/")
+	assert.NotEqual(t, takenCode, shortCode)
+	assert.Equal(t, "https://example.com/mine", memoryStore.RetrieveInitialUrl(shortCode))
+	assert.Equal(t, "https://example.com/theirs", memoryStore.RetrieveInitialUrl(takenCode))
+}
+
+func TestCreateShortUrlWithAlias(t *testing.T) {
+	t.Setenv("BASE_URL", "http://short.test/")
+	memoryStore := store.NewMemoryStore()
+	r := setupRouter(memoryStore)
+	key := issueAPIKey(t, memoryStore, "user-1")
+	otherKey := issueAPIKey(t, memoryStore, "user-2")
+
+	code, response := authorizedRequest(r, http.MethodPost, "/create-short-url", key, `{"long_url": "https://example.com/launch", "alias": "launch-2026"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "http://short.test/launch-2026", response["short_url"])
+	assert.Equal(t, "https://example.com/launch", memoryStore.RetrieveInitialUrl("launch-2026"))
+
+	code, response = authorizedRequest(r, http.MethodPost, "/create-short-url", otherKey, `{"long_url": "https://example.com/other", "alias": "launch-2026"}`)
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, "launch-2026", response["alias"])
+	assert.Equal(t, "https://example.com/launch", memoryStore.RetrieveInitialUrl("launch-2026"))
+
+	code, response = createShortUrl(t, r, `{"long_url": "https://example.com/other", "alias": "no/slashes"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "alias", response["field"])
+
+	// Guests cannot be counted against the alias quota
+	code, response = createShortUrl(t, r, `{"long_url": "https://example.com/other", "alias": "guest-alias"}`)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, "account_required", response["code"])
+	assert.Equal(t, "", memoryStore.RetrieveInitialUrl("guest-alias"))
+}
+
+func TestCreateShortUrlRejectsReservedAlias(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	r := setupRouter(memoryStore)
+	key := issueAPIKey(t, memoryStore, "user-1")
+
+	for _, alias := range []string{"create-short-url", "Health", "acme"} {
+		code, response := authorizedRequest(r, http.MethodPost, "/create-short-url", key, `{"long_url": "https://example.com", "alias": "`+alias+`"}`)
+		assert.Equal(t, http.StatusConflict, code, alias)
+		assert.Equal(t, "Alias is reserved", response["error"], alias)
+	}
+}
+
+func TestCreateShortUrlWithExpiry(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	r := setupRouter(memoryStore)
+	key := issueAPIKey(t, memoryStore, "pro-user")
+
+	code, response := authorizedRequest(r, http.MethodPost, "/create-short-url", key, `{"long_url": "https://example.com/sale", "alias": "flash-sale", "expires_in": 3600}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.NotNil(t, response["expires_at"])
+
+	link, err := memoryStore.RetrieveLink("flash-sale")
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), *link.ExpiresAt, time.Minute)
+
+	code, _ = authorizedRequest(r, http.MethodPost, "/create-short-url", key, `{"long_url": "https://example.com", "expires_at": "2001-01-01T00:00:00Z"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = authorizedRequest(r, http.MethodPost, "/create-short-url", key, `{"long_url": "https://example.com", "expires_at": "2999-01-01T00:00:00Z", "expires_in": 60}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestRedirectExpiredShortUrl(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	r := setupRouter(memoryStore)
+
+	expiresAt := time.Now().Add(50 * time.Millisecond)
+	assert.NoError(t, memoryStore.SaveLink(store.Link{ShortCode: "soon-gone", OriginalUrl: "https://example.com", ExpiresAt: &expiresAt}))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/soon-gone", nil))
+	assert.Equal(t, http.StatusFound, w.Code)
+
+	time.Sleep(60 * time.Millisecond)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/soon-gone", nil))
+	assert.Equal(t, http.StatusGone, w.Code)
+
+	// Still gone, not unknown, once the sweeper has deactivated it
+	count, _ := memoryStore.DeactivateExpiredLinks()
+	assert.Equal(t, 1, count)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/soon-gone", nil))
+	assert.Equal(t, http.StatusGone, w.Code)
+}
@@ -0,0 +1,148 @@
+package endpoint_handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"url-shortener/auth"
+	"url-shortener/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Request model for changing a link's settings
+type LinkUpdateRequest struct {
+	IsActive *bool `json:"is_active"`
+}
+
+// UpdateLink deactivates or reactivates a link. The cached destination is
+// dropped so the change applies to the very next redirect.
+func (h *Handler) UpdateLink(c *gin.Context) {
+	var updateRequest LinkUpdateRequest
+	if err := c.ShouldBindJSON(&updateRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if updateRequest.IsActive == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "is_active is required", "field": "is_active"})
+		return
+	}
+
+	link, ok := h.ownedLink(c, c.Param("code"))
+	if !ok {
+		return
+	}
+
+	err := h.links.SetLinkActive(link.ShortCode, *updateRequest.IsActive)
+	if !h.writeLinkChangeError(c, link.ShortCode, err) {
+		return
+	}
+
+	log.Printf("Link %s is now active=%t", link.ShortCode, *updateRequest.IsActive)
+	c.JSON(http.StatusOK, h.withLinkAddress(gin.H{
+		"message":   "link updated successfully",
+		"is_active": *updateRequest.IsActive,
+	}, link))
+}
+
+// DeleteLink soft-deletes a link. Its code keeps pointing nowhere and is
+// never handed out again.
+func (h *Handler) DeleteLink(c *gin.Context) {
+	link, ok := h.ownedLink(c, c.Param("code"))
+	if !ok {
+		return
+	}
+
+	err := h.links.DeleteLink(link.ShortCode)
+	if !h.writeLinkChangeError(c, link.ShortCode, err) {
+		return
+	}
+
+	log.Printf("Link %s deleted", link.ShortCode)
+	c.JSON(http.StatusOK, h.withLinkAddress(gin.H{"message": "link deleted successfully"}, link))
+}
+
+// ReleaseLink lets a quarantined link redirect. Only moderators and admins
+// may release links; the destination is still screened on every redirect.
+func (h *Handler) ReleaseLink(c *gin.Context) {
+	user, ok := auth.CurrentUser(c)
+	if !ok || !user.CanModerate() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only moderators may release links"})
+		return
+	}
+
+	shortCode, ok := h.managedCode(c, c.Param("code"))
+	if !ok {
+		return
+	}
+	err := h.links.ReleaseLink(shortCode)
+	if errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No quarantined link with this code"})
+		return
+	}
+	if !h.writeLinkChangeError(c, shortCode, err) {
+		return
+	}
+
+	log.Printf("Link %s released by %s", shortCode, user.Id)
+	link, err := h.links.LoadLink(shortCode)
+	if err == nil {
+		h.describe(link)
+	} else {
+		link = store.Link{ShortCode: shortCode}
+	}
+	c.JSON(http.StatusOK, h.withLinkAddress(gin.H{"message": "link released successfully"}, link))
+}
+
+// Look up a link on behalf of the authenticated user, who must own it unless
+// they are an admin. Writes the error response and returns false when the
+// link does not exist or belongs to someone else. Links on a custom domain
+// are addressed with its host in the domain query parameter.
+func (h *Handler) ownedLink(c *gin.Context, shortCode string) (store.Link, bool) {
+	shortCode, ok := h.managedCode(c, shortCode)
+	if !ok {
+		return store.Link{}, false
+	}
+	user, authenticated := auth.CurrentUser(c)
+	if !authenticated {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return store.Link{}, false
+	}
+
+	// The cache does not know who owns a link
+	link, err := h.links.LoadLink(shortCode)
+	if errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Short URL not found"})
+		return store.Link{}, false
+	}
+	if errors.Is(err, store.ErrRequiresDatabase) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return store.Link{}, false
+	}
+	if err != nil {
+		log.Printf("Error retrieving link %s: %v", shortCode, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load link"})
+		return store.Link{}, false
+	}
+	if link.UserId != user.Id && !user.IsAdmin() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not own this link"})
+		return store.Link{}, false
+	}
+	return link, true
+}
+
+// Report a failed link change. Returns true when there was nothing to report.
+func (h *Handler) writeLinkChangeError(c *gin.Context, shortCode string, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, store.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Short URL not found"})
+	case errors.Is(err, store.ErrRequiresDatabase):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Error changing link %s: %v", shortCode, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update link", "details": err.Error()})
+	}
+	return false
+}
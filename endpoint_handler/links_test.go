@@ -0,0 +1,115 @@
+package endpoint_handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"url-shortener/auth"
+	"url-shortener/domains"
+	"url-shortener/plan"
+	shorturl "url-shortener/shorturl"
+	"url-shortener/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// Answers lookups the way the Redis cache does: with the destination of a
+// live link and nothing else
+type cachedStore struct {
+	*store.MemoryStore
+}
+
+func (s cachedStore) RetrieveLink(shortCode string) (store.Link, error) {
+	link, err := s.MemoryStore.RetrieveLink(shortCode)
+	if err != nil || !link.IsActive || link.IsProtected() || link.IsQuarantined() {
+		return link, err
+	}
+	return store.Link{ShortCode: link.ShortCode, OriginalUrl: link.OriginalUrl, IsActive: true}, nil
+}
+
+func redirectStatus(r http.Handler, shortCode string) int {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+shortCode, nil))
+	return w.Code
+}
+
+func TestDeactivateAndReactivateLink(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	r := setupRouter(memoryStore)
+	key := issueAPIKey(t, memoryStore, "user-1")
+	other := issueAPIKey(t, memoryStore, "user-2")
+	authorizedRequest(r, http.MethodPost, "/create-short-url", key, `{"long_url": "https://example.com", "alias": "toggle-me"}`)
+
+	code, _ := authorizedRequest(r, http.MethodPatch, "/links/toggle-me", key, `{"is_active": false}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, http.StatusNotFound, redirectStatus(r, "toggle-me"))
+
+	code, _ = authorizedRequest(r, http.MethodPatch, "/links/toggle-me", key, `{"is_active": true}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, http.StatusFound, redirectStatus(r, "toggle-me"))
+
+	code, _ = authorizedRequest(r, http.MethodPatch, "/links/toggle-me", other, `{"is_active": false}`)
+	assert.Equal(t, http.StatusForbidden, code)
+	// The owner named in the body counts for nothing
+	code, _ = authorizedRequest(r, http.MethodPatch, "/links/toggle-me", "", `{"is_active": false, "user_id": "user-1"}`)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = authorizedRequest(r, http.MethodPatch, "/links/toggle-me", key, `{}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = authorizedRequest(r, http.MethodPatch, "/links/missing1", key, `{"is_active": false}`)
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestDeleteLink(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	r := setupRouter(memoryStore)
+	key := issueAPIKey(t, memoryStore, "user-1")
+	other := issueAPIKey(t, memoryStore, "user-2")
+	authorizedRequest(r, http.MethodPost, "/create-short-url", key, `{"long_url": "https://example.com", "alias": "delete-me"}`)
+
+	code, _ := authorizedRequest(r, http.MethodDelete, "/links/delete-me?user_id=user-1", "", "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = authorizedRequest(r, http.MethodDelete, "/links/delete-me", other, "")
+	assert.Equal(t, http.StatusForbidden, code)
+
+	code, _ = authorizedRequest(r, http.MethodDelete, "/links/delete-me", key, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, http.StatusNotFound, redirectStatus(r, "delete-me"))
+
+	// The code stays taken and cannot be reactivated
+	code, _ = authorizedRequest(r, http.MethodPost, "/create-short-url", other, `{"long_url": "https://example.com/new", "alias": "delete-me"}`)
+	assert.Equal(t, http.StatusConflict, code)
+	code, _ = authorizedRequest(r, http.MethodPatch, "/links/delete-me", key, `{"is_active": true}`)
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestManageCachedLink(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	memoryStore := store.NewMemoryStore()
+	memoryStore.SaveUser(store.User{Id: "pro-user", SubscriptionTier: plan.Pro})
+	cached := cachedStore{memoryStore}
+	handler := New(cached, cached, shorturl.NewReservedWords(), plan.NewResolver(memoryStore, 0), nil, nil, domains.NewVerifier(nil))
+	r := gin.New()
+	r.Use(auth.APIKeys(memoryStore))
+	r.GET("/:shortUrl", handler.HandleShortUrlRedirect)
+	r.PATCH("/links/:code", handler.UpdateLink)
+	r.GET("/links/:code/stats", handler.LinkStats)
+
+	assert.NoError(t, memoryStore.SaveLink(store.Link{ShortCode: "cached-me", OriginalUrl: "https://example.com", UserId: "pro-user"}))
+	assert.Equal(t, http.StatusFound, redirectStatus(r, "cached-me"))
+	key := issueAPIKey(t, memoryStore, "pro-user")
+
+	// Stats reach back as far as the owner's PRO plan allows
+	from := time.Now().UTC().AddDate(0, 0, -60).Format(time.DateOnly)
+	code, _ := authorizedRequest(r, http.MethodGet, "/links/cached-me/stats?from="+from, key, "")
+	assert.Equal(t, http.StatusOK, code)
+
+	code, _ = authorizedRequest(r, http.MethodPatch, "/links/cached-me", key, `{"is_active": false}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, http.StatusNotFound, redirectStatus(r, "cached-me"))
+
+	other := issueAPIKey(t, memoryStore, "user-2")
+	code, _ = authorizedRequest(r, http.MethodPatch, "/links/cached-me", other, `{"is_active": true}`)
+	assert.Equal(t, http.StatusForbidden, code)
+}
@@ -0,0 +1,23 @@
+package endpoint_handler
+
+import (
+	"net/http"
+	"url-shortener/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Me tells a client who it is authenticated as
+func (h *Handler) Me(c *gin.Context) {
+	user, _ := auth.CurrentUser(c)
+
+	method := "session"
+	if user.APIKeyId != "" {
+		method = "api_key"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"user_id":     user.Id,
+		"role":        user.Role,
+		"auth_method": method,
+	})
+}
@@ -0,0 +1,37 @@
+package endpoint_handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+	"url-shortener/metadata"
+	"url-shortener/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateDescribesDestination(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<head><title>Launch</title><meta name="description" content="All about the launch"></head>`)
+	}))
+	defer destination.Close()
+
+	memoryStore := store.NewMemoryStore()
+	fetcher := metadata.NewFetcher(metadata.Config{AllowAddress: func(netip.Addr) bool { return true }})
+	describer := metadata.NewQueue(fetcher, memoryStore, metadata.QueueConfig{})
+	defer describer.Close()
+	r := setupTestRouter(memoryStore, nil, describer, nil)
+	key := issueAPIKey(t, memoryStore, "user-1")
+
+	code, _ := authorizedRequest(r, http.MethodPost, "/create-short-url", key, `{"long_url": "`+destination.URL+`/launch", "alias": "launch"}`)
+	assert.Equal(t, http.StatusOK, code)
+
+	assert.Eventually(t, func() bool { return memoryStore.Metadata("launch") != nil }, 5*time.Second, 10*time.Millisecond)
+	described := memoryStore.Metadata("launch")
+	assert.Equal(t, "Launch", described.Title)
+	assert.Equal(t, "All about the launch", described.Description)
+}
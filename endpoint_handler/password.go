@@ -0,0 +1,181 @@
+package endpoint_handler
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Bounds for link passwords; bcrypt ignores anything past 72 bytes
+const (
+	minPasswordLength = 4
+	maxPasswordLength = 72
+)
+
+// Wrong passwords allowed per client and link within unlockWindow
+const (
+	maxUnlockAttempts = 5
+	unlockWindow      = 15 * time.Minute
+)
+
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return "", fmt.Errorf("password must be between %d and %d characters", minPasswordLength, maxPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Unlock request for a password-protected link, sent by the prompt form or as JSON
+type UnlockRequest struct {
+	Password string `form:"password" json:"password"`
+}
+
+// UnlockShortUrl checks the password of a protected link and redirects to
+// its destination when it matches
+func (h *Handler) UnlockShortUrl(c *gin.Context) {
+	shortUrl := c.Param("shortUrl")
+
+	link, ok := h.resolveLink(c, shortUrl)
+	if !ok {
+		return
+	}
+	if !link.IsProtected() {
+		h.redirect(c, link, http.StatusSeeOther)
+		return
+	}
+
+	attemptKey := c.ClientIP() + "|" + link.ShortCode
+	if allowed, retryAfter := h.unlockAttempts.allow(attemptKey); !allowed {
+		log.Printf("Too many password attempts for short URL %s from %s", shortUrl, c.ClientIP())
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		renderPasswordPrompt(c, http.StatusTooManyRequests, shortUrl, "Too many attempts. Please try again later.")
+		return
+	}
+
+	var unlockRequest UnlockRequest
+	_ = c.ShouldBind(&unlockRequest)
+
+	if bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(unlockRequest.Password)) != nil {
+		log.Printf("Wrong password for short URL: %s", shortUrl)
+		renderPasswordPrompt(c, http.StatusUnauthorized, shortUrl, "Incorrect password.")
+		return
+	}
+
+	h.unlockAttempts.reset(attemptKey)
+	c.Header("Cache-Control", "no-store")
+	h.redirect(c, link, http.StatusSeeOther)
+}
+
+var passwordPromptTemplate = template.Must(template.New("prompt").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Password required</title>
+<style>
+body { font-family: system-ui, sans-serif; display: flex; align-items: center; justify-content: center; min-height: 100vh; margin: 0; background: #f5f5f5; }
+form { background: #fff; padding: 2rem; border-radius: 8px; box-shadow: 0 1px 4px rgba(0,0,0,.1); width: 20rem; }
+input, button { width: 100%; box-sizing: border-box; padding: .6rem; margin-top: .75rem; font-size: 1rem; }
+.error { color: #b00020; }
+</style>
+</head>
+<body>
+<form method="POST" action="/{{.ShortCode}}">
+<h1>Password required</h1>
+<p>This link is protected. Enter the password to continue.</p>
+{{if .Message}}<p class="error">{{.Message}}</p>{{end}}
+<input type="password" name="password" autocomplete="current-password" autofocus required>
+<button type="submit">Continue</button>
+</form>
+</body>
+</html>
+`))
+
+// Serve the password form. It never contains the destination.
+func renderPasswordPrompt(c *gin.Context, status int, shortCode string, message string) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Status(status)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	err := passwordPromptTemplate.Execute(c.Writer, struct {
+		ShortCode string
+		Message   string
+	}{shortCode, message})
+	if err != nil {
+		log.Printf("Warning: Failed rendering password prompt: %v", err)
+	}
+}
+
+// attemptLimiter counts failed attempts per key in a fixed window
+type attemptLimiter struct {
+	mu       sync.Mutex
+	max      int
+	window   time.Duration
+	attempts map[string]*attemptWindow
+}
+
+// Number of tracked keys above which stale windows are swept
+const pruneThreshold = 1024
+
+type attemptWindow struct {
+	count   int
+	started time.Time
+}
+
+func newAttemptLimiter(max int, window time.Duration) *attemptLimiter {
+	return &attemptLimiter{
+		max:      max,
+		window:   window,
+		attempts: make(map[string]*attemptWindow),
+	}
+}
+
+// Record an attempt for key. Returns false and the time left in the window
+// once the key has used up its attempts.
+func (l *attemptLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	entry, ok := l.attempts[key]
+	if !ok || now.Sub(entry.started) >= l.window {
+		if len(l.attempts) >= pruneThreshold {
+			l.prune(now)
+		}
+		entry = &attemptWindow{started: now}
+		l.attempts[key] = entry
+	}
+	if entry.count >= l.max {
+		return false, entry.started.Add(l.window).Sub(now)
+	}
+	entry.count++
+	return true, 0
+}
+
+func (l *attemptLimiter) reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.attempts, key)
+}
+
+// Drop windows that have run out so the map does not grow without bound
+func (l *attemptLimiter) prune(now time.Time) {
+	for key, entry := range l.attempts {
+		if now.Sub(entry.started) >= l.window {
+			delete(l.attempts, key)
+		}
+	}
+}
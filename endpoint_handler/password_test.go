@@ -0,0 +1,74 @@
+package endpoint_handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"url-shortener/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func unlock(r http.Handler, shortCode string, password string) *httptest.ResponseRecorder {
+	form := url.Values{"password": {password}}
+	req := httptest.NewRequest(http.MethodPost, "/"+shortCode, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestPasswordProtectedShortUrl(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	r := setupRouter(memoryStore)
+	key := issueAPIKey(t, memoryStore, "pro-user")
+
+	code, response := authorizedRequest(r, http.MethodPost, "/create-short-url", key, `{"long_url": "https://example.com/secret-plans", "alias": "private", "password": "hunter22"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, true, response["password_protected"])
+
+	link, _ := memoryStore.RetrieveLink("private")
+	assert.NotEqual(t, "hunter22", link.PasswordHash)
+
+	// The prompt never reveals the destination
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/private", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `name="password"`)
+	assert.NotContains(t, w.Body.String(), "secret-plans")
+	assert.Empty(t, memoryStore.Clicks("private"))
+
+	w = unlock(r, "private", "wrong")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.NotContains(t, w.Body.String(), "secret-plans")
+
+	w = unlock(r, "private", "hunter22")
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "https://example.com/secret-plans", w.Header().Get("Location"))
+	assert.Len(t, memoryStore.Clicks("private"), 1)
+}
+
+func TestPasswordAttemptsAreLimited(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	r := setupRouter(memoryStore)
+	key := issueAPIKey(t, memoryStore, "pro-user")
+	authorizedRequest(r, http.MethodPost, "/create-short-url", key, `{"long_url": "https://example.com", "alias": "locked", "password": "hunter22"}`)
+
+	for i := 0; i < maxUnlockAttempts; i++ {
+		assert.Equal(t, http.StatusUnauthorized, unlock(r, "locked", "wrong").Code)
+	}
+
+	w := unlock(r, "locked", "hunter22")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+}
+
+func TestCreateShortUrlRejectsShortPassword(t *testing.T) {
+	r := setupRouter(store.NewMemoryStore())
+
+	code, response := createShortUrl(t, r, `{"long_url": "https://example.com", "password": "abc"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "password", response["field"])
+}
@@ -0,0 +1,84 @@
+package endpoint_handler
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"url-shortener/domains"
+	"url-shortener/qr"
+	"url-shortener/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// QR codes of a short URL never change, so clients may keep them for a day
+const qrMaxAge = "public, max-age=86400"
+
+// QRCode renders the short URL of a link as a QR code. Query parameters:
+// format (png or svg), size (pixels), level (error correction: L, M, Q or
+// H), margin (modules) and fg / bg (hex colors).
+func (h *Handler) QRCode(c *gin.Context) {
+	request, field, err := qr.RequestFromQuery(c.Request.URL.Query())
+	var options qr.Options
+	if err == nil {
+		options, field, err = request.Options()
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "field": field})
+		return
+	}
+
+	// Links that would not redirect get no code either
+	link, ok := h.resolveLink(c, c.Param("shortUrl"))
+	if !ok {
+		return
+	}
+	shortCode := link.ShortCode
+
+	// Links on a custom domain are only routed there, so the code points at
+	// the host the request came in on
+	content := baseUrl() + link.ShortCode
+	if domainId, code := store.SplitDomainCode(link.ShortCode); domainId != "" {
+		content = shortUrlOn(domains.RequestHost(c.Request.Host), code)
+	}
+	image, err := h.qrCodes.Render(content, options)
+	if errors.Is(err, qr.ErrTooSmall) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "field": "size"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error rendering QR code of %s: %v", shortCode, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render QR code"})
+		return
+	}
+
+	digest := sha256.Sum256([]byte(options.Key(content)))
+	etag := `"` + hex.EncodeToString(digest[:8]) + `"`
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", qrMaxAge)
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, options.ContentType(), image)
+}
+
+// The qr field of a create response: where to fetch the code of a short URL
+// and the code itself as a data URI. Rendering failures leave out the data
+// URI only.
+func (h *Handler) qrResponse(content string, options qr.Options) gin.H {
+	response := gin.H{
+		"format": options.Format,
+		"url":    content + "/qr?" + options.Query().Encode(),
+	}
+	image, err := h.qrCodes.Render(content, options)
+	if err != nil {
+		log.Printf("Warning: Failed rendering QR code of %s: %v", content, err)
+		return response
+	}
+	response["data_uri"] = "data:" + options.ContentType() + ";base64," + base64.StdEncoding.EncodeToString(image)
+	return response
+}
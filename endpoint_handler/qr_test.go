@@ -0,0 +1,103 @@
+package endpoint_handler
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"url-shortener/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQRCode(t *testing.T) {
+	t.Setenv("BASE_URL", "http://short.test/")
+	memoryStore := store.NewMemoryStore()
+	r := setupRouter(memoryStore)
+	assert.NoError(t, memoryStore.SaveLink(store.Link{ShortCode: "abc123", OriginalUrl: "https://example.com", IsActive: true}))
+
+	get := func(path string, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/abc123/qr?size=300", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	decoded, err := png.Decode(bytes.NewReader(w.Body.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, 300, decoded.Bounds().Dx())
+
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	assert.Equal(t, http.StatusNotModified, get("/abc123/qr?size=300", etag).Code)
+	assert.Equal(t, http.StatusOK, get("/abc123/qr?size=400", etag).Code)
+
+	w = get("/abc123/qr?format=svg&fg=c00", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/svg+xml", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), `fill="#cc0000"`)
+
+	assert.Equal(t, http.StatusNotFound, get("/missing/qr", "").Code)
+
+	// Links that do not redirect get no code
+	expiredAt := time.Now().Add(-time.Hour)
+	assert.NoError(t, memoryStore.SaveLink(store.Link{ShortCode: "off", OriginalUrl: "https://example.com"}))
+	assert.NoError(t, memoryStore.SetLinkActive("off", false))
+	assert.NoError(t, memoryStore.SaveLink(store.Link{ShortCode: "gone", OriginalUrl: "https://example.com", IsActive: true, ExpiresAt: &expiredAt}))
+	assert.NoError(t, memoryStore.SaveLink(store.Link{ShortCode: "held", OriginalUrl: "https://example.com", IsActive: true, QuarantineReason: "phishing"}))
+	assert.Equal(t, http.StatusNotFound, get("/off/qr", "").Code)
+	assert.Equal(t, http.StatusGone, get("/gone/qr", "").Code)
+	assert.Equal(t, http.StatusForbidden, get("/held/qr", "").Code)
+
+	w = get("/abc123/qr?level=Z", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var response map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "level", response["field"])
+}
+
+func TestCreateWithQRCode(t *testing.T) {
+	t.Setenv("BASE_URL", "http://short.test/")
+	memoryStore := store.NewMemoryStore()
+	r := setupRouter(memoryStore)
+	key := issueAPIKey(t, memoryStore, "user-1")
+
+	code, response := authorizedRequest(r, http.MethodPost, "/create-short-url", key, `{"long_url": "https://example.com/page", "alias": "with-qr", "qr": {"format": "svg", "size": 128}}`)
+	assert.Equal(t, http.StatusOK, code)
+	qrCode := response["qr"].(map[string]interface{})
+	assert.Equal(t, "svg", qrCode["format"])
+	assert.True(t, strings.HasPrefix(qrCode["url"].(string), "http://short.test/with-qr/qr?"))
+	dataURI := qrCode["data_uri"].(string)
+	assert.True(t, strings.HasPrefix(dataURI, "data:image/svg+xml;base64,"))
+	svg, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(dataURI, "data:image/svg+xml;base64,"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(svg), `width="128"`)
+
+	// The url asks for the same code
+	path := strings.TrimPrefix(qrCode["url"].(string), "http://short.test")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, svg, w.Body.Bytes())
+
+	code, response = createShortUrl(t, r, `{"long_url": "https://example.com/page", "qr": true}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "png", response["qr"].(map[string]interface{})["format"])
+
+	code, response = createShortUrl(t, r, `{"long_url": "https://example.com/other", "qr": {"size": 5}}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "qr.size", response["field"])
+	_, err = memoryStore.RetrieveLink("with-qr")
+	assert.NoError(t, err)
+}
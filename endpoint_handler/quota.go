@@ -0,0 +1,129 @@
+package endpoint_handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+	"url-shortener/auth"
+	"url-shortener/plan"
+	"url-shortener/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Check a new link against the plan of its owner. Guests get FREE features;
+// their links are not counted against any quota since guests are told
+// apart by IP address only, which the rate limits already cover. For the
+// same reason custom aliases, which have their own quota, need an account.
+// Writes the error response and returns false when the link is not allowed.
+func (h *Handler) checkLinkQuota(c *gin.Context, link store.Link) bool {
+	tier := h.tiers.Tier(link.UserId)
+	if !h.writePlanError(c, plan.CheckFeatures(tier, link)) {
+		return false
+	}
+	if link.UserId == "" || link.UserId == "guest-user" {
+		if link.CustomAlias {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Sign in to choose a custom alias",
+				"code":  "account_required",
+				"field": "alias",
+			})
+			return false
+		}
+		return true
+	}
+
+	usage, err := h.usage.LinkUsage(link.UserId, plan.PeriodStart(time.Now()))
+	if errors.Is(err, store.ErrRequiresDatabase) {
+		// Without PostgreSQL nothing is counted, which only happens in
+		// development setups
+		return true
+	}
+	if err != nil {
+		log.Printf("Error counting links of user %s: %v", link.UserId, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check plan limits"})
+		return false
+	}
+	return h.writePlanError(c, plan.CheckUsage(tier, usage, link))
+}
+
+// Report a plan violation: 402 for used up quotas, 403 for features and
+// data outside the plan. Returns true when there was nothing to report.
+func (h *Handler) writePlanError(c *gin.Context, err error) bool {
+	var quotaErr *plan.QuotaError
+	var featureErr *plan.FeatureError
+	var retentionErr *plan.RetentionError
+	switch {
+	case err == nil:
+		return true
+	case errors.As(err, &quotaErr):
+		c.JSON(http.StatusPaymentRequired, gin.H{
+			"error": err.Error(),
+			"code":  "quota_exceeded",
+			"quota": quotaErr.Quota,
+			"limit": quotaErr.Limit,
+			"used":  quotaErr.Used,
+			"tier":  quotaErr.Tier,
+		})
+	case errors.As(err, &featureErr):
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   err.Error(),
+			"code":    "feature_not_in_plan",
+			"feature": featureErr.Feature,
+			"tier":    featureErr.Tier,
+		})
+	case errors.As(err, &retentionErr):
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":          err.Error(),
+			"code":           "retention_exceeded",
+			"field":          "from",
+			"retention_days": retentionErr.Days,
+			"oldest":         retentionErr.Oldest,
+			"tier":           retentionErr.Tier,
+		})
+	default:
+		log.Printf("Error checking plan limits: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check plan limits"})
+	}
+	return false
+}
+
+// Usage reports the authenticated user's plan, its limits and how much of
+// the monthly quotas is used
+func (h *Handler) Usage(c *gin.Context) {
+	user, _ := auth.CurrentUser(c)
+	now := time.Now()
+
+	account, err := h.users.RetrieveUser(user.Id)
+	if errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrRequiresDatabase) {
+		account = store.User{Id: user.Id, SubscriptionTier: plan.Free}
+	} else if err != nil {
+		log.Printf("Error retrieving user %s: %v", user.Id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load usage"})
+		return
+	}
+
+	periodStart := plan.PeriodStart(now)
+	usage, err := h.usage.LinkUsage(user.Id, periodStart)
+	if errors.Is(err, store.ErrRequiresDatabase) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Error counting links of user %s: %v", user.Id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load usage"})
+		return
+	}
+
+	tier := plan.EffectiveTier(account, now)
+	c.JSON(http.StatusOK, gin.H{
+		"tier":                 tier,
+		"subscription_tier":    account.SubscriptionTier,
+		"subscription_expires": account.SubscriptionExpires,
+		"period_start":         periodStart,
+		"period_end":           periodStart.AddDate(0, 1, 0),
+		"limits":               plan.LimitsFor(tier),
+		"usage":                usage,
+	})
+}
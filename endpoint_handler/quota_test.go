@@ -0,0 +1,90 @@
+package endpoint_handler
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+	"url-shortener/plan"
+	"url-shortener/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeaturesFollowTier(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	r := setupRouter(memoryStore)
+	key := issueAPIKey(t, memoryStore, "user-1")
+
+	code, response := authorizedRequest(r, http.MethodPost, "/create-short-url", key, `{"long_url": "https://example.com", "password": "hunter22"}`)
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, "feature_not_in_plan", response["code"])
+	assert.Equal(t, "password", response["feature"])
+	assert.Equal(t, plan.Free, response["tier"])
+
+	code, response = createShortUrl(t, r, `{"long_url": "https://example.com", "expires_in": 60}`)
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, "expiry", response["feature"])
+
+	// A lapsed subscription falls back to FREE
+	expired := time.Now().Add(-time.Hour)
+	memoryStore.SaveUser(store.User{Id: "lapsed-user", SubscriptionTier: plan.Pro, SubscriptionExpires: &expired})
+	code, _ = authorizedRequest(r, http.MethodPost, "/create-short-url", issueAPIKey(t, memoryStore, "lapsed-user"), `{"long_url": "https://example.com", "expires_in": 60}`)
+	assert.Equal(t, http.StatusForbidden, code)
+
+	proKey := issueAPIKey(t, memoryStore, "pro-user")
+	code, _ = authorizedRequest(r, http.MethodPost, "/create-short-url", proKey, `{"long_url": "https://example.com", "expires_in": 60, "password": "hunter22"}`)
+	assert.Equal(t, http.StatusOK, code)
+
+	// Naming a paying user without their credentials gets a guest's plan
+	code, response = createShortUrl(t, r, `{"long_url": "https://example.com", "user_id": "pro-user", "expires_in": 60}`)
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, "expiry", response["feature"])
+}
+
+func TestQuotasFollowTier(t *testing.T) {
+	t.Setenv("BASE_URL", "http://short.test/")
+	memoryStore := store.NewMemoryStore()
+	r := setupRouter(memoryStore)
+	limits := plan.LimitsFor(plan.Free)
+	key := issueAPIKey(t, memoryStore, "user-1")
+
+	for i := 0; i < limits.CustomAliases; i++ {
+		code, _ := authorizedRequest(r, http.MethodPost, "/create-short-url", key, fmt.Sprintf(`{"long_url": "https://example.com", "alias": "alias-%d"}`, i))
+		assert.Equal(t, http.StatusOK, code)
+	}
+	code, response := authorizedRequest(r, http.MethodPost, "/create-short-url", key, `{"long_url": "https://example.com", "alias": "one-too-many"}`)
+	assert.Equal(t, http.StatusPaymentRequired, code)
+	assert.Equal(t, "quota_exceeded", response["code"])
+	assert.Equal(t, "custom_aliases", response["quota"])
+	assert.Equal(t, float64(limits.CustomAliases), response["limit"])
+
+	// Deleting an alias frees its slot
+	code, _ = authorizedRequest(r, http.MethodDelete, "/links/alias-0", key, "")
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = authorizedRequest(r, http.MethodPost, "/create-short-url", key, `{"long_url": "https://example.com", "alias": "one-more"}`)
+	assert.Equal(t, http.StatusOK, code)
+
+	for i := limits.CustomAliases + 1; i < limits.LinksPerMonth; i++ {
+		code, _ := authorizedRequest(r, http.MethodPost, "/create-short-url", key, fmt.Sprintf(`{"long_url": "https://example.com/%d"}`, i))
+		assert.Equal(t, http.StatusOK, code)
+	}
+	code, response = authorizedRequest(r, http.MethodPost, "/create-short-url", key, `{"long_url": "https://example.com/last"}`)
+	assert.Equal(t, http.StatusPaymentRequired, code)
+	assert.Equal(t, "links_per_month", response["quota"])
+
+	// Guests are not counted, even when they name a user
+	code, _ = createShortUrl(t, r, `{"long_url": "https://example.com/last"}`)
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = createShortUrl(t, r, `{"long_url": "https://example.com/last", "user_id": "user-1"}`)
+	assert.Equal(t, http.StatusOK, code)
+
+	memoryStore.SaveSession("user-session", store.Session{UserId: "user-1", Expires: time.Now().Add(time.Hour)})
+	code, response = authorizedRequest(r, http.MethodGet, "/me/usage", "user-session", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, plan.Free, response["tier"])
+	usage := response["usage"].(map[string]interface{})
+	assert.Equal(t, float64(limits.LinksPerMonth), usage["links_created"])
+	assert.Equal(t, float64(limits.CustomAliases), usage["custom_aliases"])
+	assert.Equal(t, float64(limits.LinksPerMonth), response["limits"].(map[string]interface{})["links_per_month"])
+}
@@ -0,0 +1,75 @@
+package endpoint_handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"url-shortener/auth"
+	"url-shortener/screening"
+	"url-shortener/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateScreensDestinations(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	r := setupScreenedRouter(memoryStore, screening.New(screening.Config{
+		Deny: screening.NewDomainList([]string{"malware.example"}),
+	}))
+
+	code, response := createShortUrl(t, r, `{"long_url": "https://cdn.malware.example/x", "user_id": "user-1"}`)
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, "destination_blocked", response["code"])
+	assert.Equal(t, "long_url", response["field"])
+
+	// A lookalike of a well-known domain is blocked too
+	code, response = createShortUrl(t, r, `{"long_url": "https://xn--l-7sba6dbr.com/login", "user_id": "user-1"}`)
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, "host name imitates paypal.com", response["reason"])
+
+	// Suspicious spellings are saved but held back
+	code, response = authorizedRequest(r, http.MethodPost, "/create-short-url", issueAPIKey(t, memoryStore, "user-1"),
+		`{"long_url": "https://xn--exmple-4nf.org/", "alias": "held"}`)
+	assert.Equal(t, http.StatusAccepted, code)
+	assert.Equal(t, "quarantined", response["status"])
+	assert.Equal(t, http.StatusForbidden, redirectStatus(r, "held"))
+
+	// Only moderators may release it
+	memoryStore.SaveSession("user-session", store.Session{UserId: "user-1", Role: auth.RoleUser, Expires: time.Now().Add(time.Hour)})
+	memoryStore.SaveSession("mod-session", store.Session{UserId: "mod-1", Role: auth.RoleModerator, Expires: time.Now().Add(time.Hour)})
+	code, _ = authorizedRequest(r, http.MethodPost, "/links/held/release", "user-session", "")
+	assert.Equal(t, http.StatusForbidden, code)
+	code, _ = authorizedRequest(r, http.MethodPost, "/links/held/release", "mod-session", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, http.StatusFound, redirectStatus(r, "held"))
+	code, _ = authorizedRequest(r, http.MethodPost, "/links/held/release", "mod-session", "")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestRedirectRechecksDestinations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deny.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("# nothing yet\n"), 0o644))
+	deny := screening.NewDomainList(nil)
+	assert.NoError(t, deny.LoadFile(path))
+
+	memoryStore := store.NewMemoryStore()
+	r := setupScreenedRouter(memoryStore, screening.New(screening.Config{Deny: deny}))
+
+	code, _ := authorizedRequest(r, http.MethodPost, "/create-short-url", issueAPIKey(t, memoryStore, "user-1"),
+		`{"long_url": "https://turned-bad.example/", "alias": "later"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, http.StatusFound, redirectStatus(r, "later"))
+
+	// Once the domain is listed the existing link stops resolving
+	assert.NoError(t, os.WriteFile(path, []byte("turned-bad.example\n"), 0o644))
+	assert.NoError(t, deny.Reload())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/later", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.True(t, strings.Contains(w.Body.String(), "deny list"))
+	assert.Len(t, memoryStore.Clicks("later"), 1)
+}
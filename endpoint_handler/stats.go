@@ -0,0 +1,181 @@
+package endpoint_handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"url-shortener/plan"
+	"url-shortener/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// Range covered when no from is given
+	defaultStatsRange = 30 * 24 * time.Hour
+	// Entries in each top list when no limit is given
+	defaultStatsLimit = 10
+	maxStatsLimit     = 100
+	// Upper bound on the points of one time series
+	maxStatsBuckets = 1000
+)
+
+// LinkStats reports the clicks of a link to its owner: totals, a time series
+// and the top referrers, countries, devices and browsers.
+//
+// Query parameters: from and to (RFC 3339 or YYYY-MM-DD), interval
+// (hour, day or week), tz (IANA time zone, default UTC) and limit.
+func (h *Handler) LinkStats(c *gin.Context) {
+	now := time.Now()
+	query, field, err := parseStatsQuery(c, now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "field": field})
+		return
+	}
+
+	link, ok := h.ownedLink(c, c.Param("code"))
+	if !ok {
+		return
+	}
+	query.ShortCode = link.ShortCode
+	h.serveStats(c, query, link.UserId, now, h.withLinkAddress(gin.H{}, link))
+}
+
+// Compute the stats of query for the links of ownerId and write them,
+// together with the fields of subject that say what they are about
+func (h *Handler) serveStats(c *gin.Context, query store.StatsQuery, ownerId string, now time.Time, subject gin.H) {
+	// Analytics reach back as far as the owner's plan allows. The default
+	// range is shortened to fit; an explicit from is rejected.
+	tier := h.tiers.Tier(ownerId)
+	if c.Query("from") == "" {
+		if oldest := now.Add(-plan.LimitsFor(tier).AnalyticsRetention()); query.From.Before(oldest) && oldest.Before(query.To) {
+			query.From = oldest
+		}
+	}
+	if !h.writePlanError(c, plan.CheckRetention(tier, query.From, now)) {
+		return
+	}
+
+	stats, err := h.stats.LinkStats(query)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Short URL not found"})
+		return
+	case errors.Is(err, store.ErrRequiresDatabase):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		log.Printf("Error computing stats of %v: %v", subject, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute stats", "details": err.Error()})
+		return
+	}
+
+	response := gin.H{
+		"from":          query.From,
+		"to":            query.To,
+		"interval":      query.Interval,
+		"timezone":      query.Location.String(),
+		"total_clicks":  stats.TotalClicks,
+		"unique_clicks": stats.UniqueClicks,
+		"series":        stats.Series,
+		"top_referrers": stats.Referrers,
+		"countries":     stats.Countries,
+		"devices":       stats.Devices,
+		"browsers":      stats.Browsers,
+	}
+	if stats.Links != nil {
+		hosts := h.domainHosts(ownerId)
+		topLinks := make([]topLinkRow, len(stats.Links))
+		for i, count := range stats.Links {
+			topLinks[i] = topLinkRow{linkAddress: addressOf(count.Value, hosts), Clicks: count.Clicks}
+		}
+		response["top_links"] = topLinks
+	}
+	for key, value := range subject {
+		response[key] = value
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// A link among the most clicked of a tag or campaign
+type topLinkRow struct {
+	linkAddress
+	Clicks int64 `json:"clicks"`
+}
+
+// Read the stats query parameters. On failure the offending parameter is
+// returned with the error.
+func parseStatsQuery(c *gin.Context, now time.Time) (store.StatsQuery, string, error) {
+	query := store.StatsQuery{
+		Interval: store.IntervalDay,
+		Location: time.UTC,
+		Limit:    defaultStatsLimit,
+	}
+
+	if tz := c.Query("tz"); tz != "" {
+		location, err := time.LoadLocation(tz)
+		if err != nil {
+			return query, "tz", fmt.Errorf("unknown time zone %q", tz)
+		}
+		query.Location = location
+	}
+
+	switch interval := c.DefaultQuery("interval", store.IntervalDay); interval {
+	case store.IntervalHour, store.IntervalDay, store.IntervalWeek:
+		query.Interval = interval
+	default:
+		return query, "interval", errors.New("interval must be hour, day or week")
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxStatsLimit {
+			return query, "limit", fmt.Errorf("limit must be between 1 and %d", maxStatsLimit)
+		}
+		query.Limit = n
+	}
+
+	query.To = now
+	if to := c.Query("to"); to != "" {
+		t, err := parseStatsTime(to, query.Location, true)
+		if err != nil {
+			return query, "to", err
+		}
+		query.To = t
+	}
+	query.From = query.To.Add(-defaultStatsRange)
+	if from := c.Query("from"); from != "" {
+		t, err := parseStatsTime(from, query.Location, false)
+		if err != nil {
+			return query, "from", err
+		}
+		query.From = t
+	}
+
+	if !query.From.Before(query.To) {
+		return query, "from", errors.New("from must be before to")
+	}
+	if query.SpansMoreBucketsThan(maxStatsBuckets) {
+		return query, "interval", fmt.Errorf("range spans more than %d %s buckets, use a larger interval", maxStatsBuckets, query.Interval)
+	}
+	return query, "", nil
+}
+
+// Parse an RFC 3339 time or a date in location. A date used as the end of
+// the range includes that whole day.
+func parseStatsTime(value string, location *time.Location, endOfRange bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	day, err := time.ParseInLocation(time.DateOnly, value, location)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither an RFC 3339 time nor a YYYY-MM-DD date", value)
+	}
+	if endOfRange {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day, nil
+}
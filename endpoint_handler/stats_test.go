@@ -0,0 +1,96 @@
+package endpoint_handler
+
+import (
+	"net/http"
+	"testing"
+	"time"
+	"url-shortener/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinkStats(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	r := setupRouter(memoryStore)
+	key := issueAPIKey(t, memoryStore, "user-1")
+	authorizedRequest(r, http.MethodPost, "/create-short-url", key, `{"long_url": "https://example.com", "alias": "stats-me"}`)
+
+	// A few days back, well within the FREE plan's analytics retention
+	day := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -5)
+	date := func(days int) string { return day.AddDate(0, 0, days).Format(time.DateOnly) }
+	click := func(at time.Duration, ip string, referer string, country string) store.Click {
+		return store.Click{ShortCode: "stats-me", ClickedAt: day.Add(at), IpAddress: ip, Referer: referer, Country: country, Device: "mobile"}
+	}
+	_, err := memoryStore.WriteClicks([]store.Click{
+		click(1*time.Hour, "10.0.0.1", "https://news.test/", "DE"),
+		click(2*time.Hour, "10.0.0.1", "https://news.test/", "DE"),
+		click(26*time.Hour, "10.0.0.2", "", "US"),
+		click(50*time.Hour, "10.0.0.3", "https://mail.test/", "DE"),
+		// Outside the range
+		click(-time.Hour, "10.0.0.4", "", "FR"),
+	})
+	assert.NoError(t, err)
+
+	code, response := authorizedRequest(r, http.MethodGet, "/links/stats-me/stats?from="+date(0)+"&to="+date(2), key, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(4), response["total_clicks"])
+	assert.Equal(t, float64(3), response["unique_clicks"])
+
+	series := response["series"].([]interface{})
+	assert.Len(t, series, 3)
+	assert.Equal(t, float64(2), series[0].(map[string]interface{})["clicks"])
+	assert.Equal(t, float64(1), series[0].(map[string]interface{})["unique_clicks"])
+	assert.Equal(t, float64(1), series[1].(map[string]interface{})["clicks"])
+
+	referrers := response["top_referrers"].([]interface{})
+	assert.Len(t, referrers, 2)
+	assert.Equal(t, "https://news.test/", referrers[0].(map[string]interface{})["value"])
+	countries := response["countries"].([]interface{})
+	assert.Equal(t, map[string]interface{}{"value": "DE", "clicks": float64(3)}, countries[0])
+
+	// Dates are read in the requested time zone: in New York the first two
+	// clicks still fall on the previous day
+	code, response = authorizedRequest(r, http.MethodGet, "/links/stats-me/stats?from="+date(-1)+"&to="+date(-1)+"&tz=America/New_York", key, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(3), response["total_clicks"])
+	assert.Len(t, response["series"], 1)
+	assert.Equal(t, "America/New_York", response["timezone"])
+
+	code, response = authorizedRequest(r, http.MethodGet, "/links/stats-me/stats?from="+date(0)+"T00:00:00Z&to="+date(0)+"T06:00:00Z&interval=hour&limit=1", key, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, response["series"], 6)
+	assert.Len(t, response["top_referrers"], 1)
+
+	// FREE analytics reach back 30 days
+	code, response = authorizedRequest(r, http.MethodGet, "/links/stats-me/stats?from="+date(-60), key, "")
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, "retention_exceeded", response["code"])
+	code, response = authorizedRequest(r, http.MethodGet, "/links/stats-me/stats?to="+date(0), key, "")
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestLinkStatsRejectsBadQueries(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	r := setupRouter(memoryStore)
+	key := issueAPIKey(t, memoryStore, "user-1")
+	authorizedRequest(r, http.MethodPost, "/create-short-url", key, `{"long_url": "https://example.com", "alias": "stats-me"}`)
+
+	for path, field := range map[string]string{
+		"/links/stats-me/stats?interval=month":                              "interval",
+		"/links/stats-me/stats?tz=Mars/Olympus":                             "tz",
+		"/links/stats-me/stats?from=yesterday":                              "from",
+		"/links/stats-me/stats?from=2026-03-05&to=2026-03-01":               "from",
+		"/links/stats-me/stats?limit=0":                                     "limit",
+		"/links/stats-me/stats?from=2020-01-01&to=2026-01-01&interval=hour": "interval",
+		"/links/stats-me/stats?from=0001-01-01&interval=hour":               "interval",
+	} {
+		code, response := authorizedRequest(r, http.MethodGet, path, key, "")
+		assert.Equal(t, http.StatusBadRequest, code, path)
+		assert.Equal(t, field, response["field"], path)
+	}
+
+	code, _ := authorizedRequest(r, http.MethodGet, "/links/stats-me/stats", issueAPIKey(t, memoryStore, "user-2"), "")
+	assert.Equal(t, http.StatusForbidden, code)
+	code, _ = authorizedRequest(r, http.MethodGet, "/links/missing1/stats", key, "")
+	assert.Equal(t, http.StatusNotFound, code)
+}
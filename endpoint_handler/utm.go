@@ -0,0 +1,192 @@
+package endpoint_handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"url-shortener/auth"
+	"url-shortener/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxUTMValueLength      = 256
+	maxUTMPresetNameLength = 64
+)
+
+// Request model for saving a UTM preset
+type UTMPresetRequest struct {
+	Name string `json:"name"`
+	store.UTM
+}
+
+// Trim the UTM values of a request and check their length. On failure the
+// offending field is returned with the error.
+func cleanUTM(utm store.UTM) (store.UTM, string, error) {
+	fields := []struct {
+		name  string
+		value *string
+	}{
+		{"utm_source", &utm.Source},
+		{"utm_medium", &utm.Medium},
+		{"utm_campaign", &utm.Campaign},
+		{"utm_term", &utm.Term},
+		{"utm_content", &utm.Content},
+	}
+	for _, field := range fields {
+		*field.value = strings.TrimSpace(*field.value)
+		if len(*field.value) > maxUTMValueLength {
+			return store.UTM{}, field.name, fmt.Errorf("%s must be at most %d characters", field.name, maxUTMValueLength)
+		}
+	}
+	return utm, "", nil
+}
+
+// The UTM parameters a new link gets: those of the request, with the unset
+// ones taken from the owner's preset if one is named
+func (h *Handler) requestUTM(request UrlCreationRequest, userId string) (store.UTM, string, error) {
+	utm, field, err := cleanUTM(request.UTM)
+	if err != nil || request.UTMPreset == "" {
+		return utm, field, err
+	}
+	preset, err := h.presets.RetrieveUTMPreset(userId, request.UTMPreset)
+	if errors.Is(err, store.ErrNotFound) {
+		return store.UTM{}, "utm_preset", fmt.Errorf("unknown UTM preset %q", request.UTMPreset)
+	}
+	if errors.Is(err, store.ErrRequiresDatabase) {
+		return store.UTM{}, "utm_preset", errors.New("UTM presets are temporarily unavailable")
+	}
+	if err != nil {
+		log.Printf("Error loading UTM preset %s of user %s: %v", request.UTMPreset, userId, err)
+		return store.UTM{}, "utm_preset", errors.New("failed to load UTM preset")
+	}
+	return utm.Or(preset.UTM), "", nil
+}
+
+// Add the UTM parameters to the query string of rawUrl. Parameters already
+// there are kept in place, except those the UTM values replace. URLs that
+// do not parse are returned as they are, for validation to reject.
+func withUTM(rawUrl string, utm store.UTM) string {
+	params := utm.Params()
+	parsed, err := url.Parse(strings.TrimSpace(rawUrl))
+	if len(params) == 0 || err != nil || parsed.Host == "" {
+		return rawUrl
+	}
+
+	replaced := make(map[string]bool, len(params))
+	for _, param := range params {
+		replaced[param[0]] = true
+	}
+	var query []string
+	if parsed.RawQuery != "" {
+		for _, pair := range strings.Split(parsed.RawQuery, "&") {
+			key, _, _ := strings.Cut(pair, "=")
+			if name, err := url.QueryUnescape(key); err == nil && replaced[name] {
+				continue
+			}
+			query = append(query, pair)
+		}
+	}
+	for _, param := range params {
+		query = append(query, param[0]+"="+url.QueryEscape(param[1]))
+	}
+	parsed.RawQuery = strings.Join(query, "&")
+	return parsed.String()
+}
+
+// The UTM parameters in the query string of rawUrl. Values too long to have
+// been set through the API are left out.
+func urlUTM(rawUrl string) store.UTM {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return store.UTM{}
+	}
+	query := parsed.Query()
+	value := func(name string) string {
+		value := strings.TrimSpace(query.Get(name))
+		if len(value) > maxUTMValueLength {
+			return ""
+		}
+		return value
+	}
+	return store.UTM{
+		Source:   value("utm_source"),
+		Medium:   value("utm_medium"),
+		Campaign: value("utm_campaign"),
+		Term:     value("utm_term"),
+		Content:  value("utm_content"),
+	}
+}
+
+// CreateUTMPreset saves a named set of UTM parameters for the
+// authenticated user
+func (h *Handler) CreateUTMPreset(c *gin.Context) {
+	user, _ := auth.CurrentUser(c)
+	var presetRequest UTMPresetRequest
+	if err := c.ShouldBindJSON(&presetRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name := strings.TrimSpace(presetRequest.Name)
+	if name == "" || len([]rune(name)) > maxUTMPresetNameLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("name must be between 1 and %d characters", maxUTMPresetNameLength), "field": "name"})
+		return
+	}
+	utm, field, err := cleanUTM(presetRequest.UTM)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "field": field})
+		return
+	}
+	if utm.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a preset needs at least one UTM parameter"})
+		return
+	}
+
+	preset, err := h.presets.CreateUTMPreset(store.UTMPreset{UserId: user.Id, Name: name, UTM: utm})
+	if !writeUTMPresetError(c, err) {
+		return
+	}
+	log.Printf("UTM preset %s created for user %s", preset.Id, user.Id)
+	c.JSON(http.StatusCreated, gin.H{"message": "UTM preset created successfully", "preset": preset})
+}
+
+func (h *Handler) ListUTMPresets(c *gin.Context) {
+	user, _ := auth.CurrentUser(c)
+	presets, err := h.presets.ListUTMPresets(user.Id)
+	if !writeUTMPresetError(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"presets": presets})
+}
+
+func (h *Handler) DeleteUTMPreset(c *gin.Context) {
+	user, _ := auth.CurrentUser(c)
+	err := h.presets.DeleteUTMPreset(user.Id, c.Param("id"))
+	if !writeUTMPresetError(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "UTM preset deleted successfully", "id": c.Param("id")})
+}
+
+// Report a failed preset operation. Returns true when there was nothing to
+// report.
+func writeUTMPresetError(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, store.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "UTM preset not found"})
+	case errors.Is(err, store.ErrUTMPresetNameTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "field": "name"})
+	case errors.Is(err, store.ErrRequiresDatabase):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Error managing UTM presets: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update UTM presets"})
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package endpoint_handler
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"url-shortener/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithUTM(t *testing.T) {
+	utm := store.UTM{Source: "newsletter", Medium: "email", Campaign: "spring sale"}
+	assert.Equal(t,
+		"https://example.com/shop?utm_source=newsletter&utm_medium=email&utm_campaign=spring+sale",
+		withUTM("https://example.com/shop", utm))
+	// Other parameters and the fragment stay as they were, UTM values given
+	// replace the old ones
+	assert.Equal(t,
+		"https://example.com/shop?id=7&b=%2F&utm_content=old&utm_source=newsletter&utm_medium=email&utm_campaign=spring+sale#top",
+		withUTM("https://example.com/shop?utm_source=old&id=7&b=%2F&utm_content=old#top", utm))
+	assert.Equal(t, "https://example.com/?a=1", withUTM("https://example.com/?a=1", store.UTM{}))
+	assert.Equal(t, "not a url", withUTM("not a url", utm))
+}
+
+func TestCreateShortUrlWithUTM(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	r := setupRouter(memoryStore)
+	key := issueAPIKey(t, memoryStore, "user-1")
+
+	code, response := authorizedRequest(r, http.MethodPost, "/create-short-url", key, `{"long_url": "https://example.com/?ref=x", "alias": "tracked",
+		"utm_source": " twitter ", "utm_medium": "social"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "https://example.com/?ref=x&utm_source=twitter&utm_medium=social", response["long_url"])
+	assert.Equal(t, "https://example.com/?ref=x&utm_source=twitter&utm_medium=social", redirectLocation(r, "tracked"))
+	link, err := memoryStore.RetrieveLink("tracked")
+	assert.NoError(t, err)
+	assert.Equal(t, store.UTM{Source: "twitter", Medium: "social"}, link.UTM)
+
+	code, response = createShortUrl(t, r, `{"long_url": "https://example.com", "user_id": "user-1", "utm_term": "`+
+		strings.Repeat("a", maxUTMValueLength+1)+`"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "utm_term", response["field"])
+}
+
+func TestDestinationChangeUpdatesUTM(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	r := setupRouter(memoryStore)
+	key := issueAPIKey(t, memoryStore, "user-1")
+	listedUTM := func() interface{} {
+		_, response := authorizedRequest(r, http.MethodGet, "/me/links", key, "")
+		return response["links"].([]interface{})[0].(map[string]interface{})["utm_source"]
+	}
+
+	code, _ := authorizedRequest(r, http.MethodPost, "/create-short-url", key, `{"long_url": "https://example.com/a", "alias": "moved",
+		"utm_source": "twitter", "utm_medium": "social"}`)
+	assert.Equal(t, http.StatusOK, code)
+
+	code, _ = authorizedRequest(r, http.MethodPut, "/links/moved/destination", key, `{"long_url": "https://example.com/b?utm_source=mastodon"}`)
+	assert.Equal(t, http.StatusOK, code)
+	link, _ := memoryStore.RetrieveLink("moved")
+	assert.Equal(t, store.UTM{Source: "mastodon"}, link.UTM)
+	assert.Equal(t, "mastodon", listedUTM())
+
+	code, _ = authorizedRequest(r, http.MethodPut, "/links/moved/destination", key, `{"long_url": "https://example.com/c"}`)
+	assert.Equal(t, http.StatusOK, code)
+	link, _ = memoryStore.RetrieveLink("moved")
+	assert.True(t, link.UTM.IsZero())
+	assert.Nil(t, listedUTM())
+
+	// Rolling back brings the parameters of that version back
+	code, _ = authorizedRequest(r, http.MethodPost, "/links/moved/rollback", key, `{"version": 0}`)
+	assert.Equal(t, http.StatusOK, code)
+	link, _ = memoryStore.RetrieveLink("moved")
+	assert.Equal(t, store.UTM{Source: "twitter", Medium: "social"}, link.UTM)
+}
+
+func TestUTMPresets(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	r := setupRouter(memoryStore)
+	key := issueAPIKey(t, memoryStore, "user-1")
+	otherKey := issueAPIKey(t, memoryStore, "user-2")
+
+	code, response := authorizedRequest(r, http.MethodPost, "/utm-presets", key,
+		`{"name": "newsletter", "utm_source": "newsletter", "utm_medium": "email"}`)
+	assert.Equal(t, http.StatusCreated, code)
+	presetId := response["preset"].(map[string]interface{})["id"].(string)
+
+	code, _ = authorizedRequest(r, http.MethodPost, "/utm-presets", key, `{"name": "newsletter", "utm_source": "other"}`)
+	assert.Equal(t, http.StatusConflict, code)
+	code, _ = authorizedRequest(r, http.MethodPost, "/utm-presets", key, `{"name": "empty"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// Values of the request win over the preset's
+	code, response = authorizedRequest(r, http.MethodPost, "/create-short-url", key, `{"long_url": "https://example.com",
+		"utm_preset": "`+presetId+`", "utm_medium": "digest", "utm_campaign": "may"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "https://example.com?utm_source=newsletter&utm_medium=digest&utm_campaign=may", response["long_url"])
+
+	// Presets are per user
+	code, response = authorizedRequest(r, http.MethodPost, "/create-short-url", otherKey, `{"long_url": "https://example.com", "utm_preset": "`+presetId+`"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "utm_preset", response["field"])
+	code, _ = authorizedRequest(r, http.MethodDelete, "/utm-presets/"+presetId, otherKey, "")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, response = authorizedRequest(r, http.MethodGet, "/utm-presets", key, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, response["presets"], 1)
+	code, _ = authorizedRequest(r, http.MethodDelete, "/utm-presets/"+presetId, key, "")
+	assert.Equal(t, http.StatusOK, code)
+	code, response = authorizedRequest(r, http.MethodGet, "/utm-presets", key, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, response["presets"], 0)
+}
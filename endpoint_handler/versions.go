@@ -0,0 +1,149 @@
+package endpoint_handler
+
+import (
+	"log"
+	"net/http"
+	"url-shortener/auth"
+	"url-shortener/screening"
+	shorturl "url-shortener/shorturl"
+	"url-shortener/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Request model for pointing a link at a new destination
+type DestinationUpdateRequest struct {
+	LongUrl string `json:"long_url"`
+}
+
+// Request model for restoring an earlier destination. Version 0 is the
+// destination the link was created with.
+type RollbackRequest struct {
+	Version *int `json:"version"`
+}
+
+// UpdateDestination points a link at a new destination. The new destination
+// is validated and screened like a new link's, and the change is recorded in
+// the link's version history. Requires authentication.
+func (h *Handler) UpdateDestination(c *gin.Context) {
+	var updateRequest DestinationUpdateRequest
+	if err := c.ShouldBindJSON(&updateRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	longUrl, err := shorturl.NormalizeUrl(updateRequest.LongUrl)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "field": "long_url"})
+		return
+	}
+
+	link, ok := h.ownedLink(c, c.Param("code"))
+	if !ok {
+		return
+	}
+	user, _ := auth.CurrentUser(c)
+	h.changeDestination(c, link, store.DestinationChange{NewUrl: longUrl, ChangedBy: user.Id}, "long_url")
+}
+
+// ListLinkVersions shows the destination history of a link to its owner,
+// newest change first. Requires authentication.
+func (h *Handler) ListLinkVersions(c *gin.Context) {
+	link, ok := h.ownedLink(c, c.Param("code"))
+	if !ok {
+		return
+	}
+
+	versions, err := h.versions.LinkVersions(link.ShortCode)
+	if !h.writeLinkChangeError(c, link.ShortCode, err) {
+		return
+	}
+	c.JSON(http.StatusOK, h.withLinkAddress(gin.H{
+		"current_url": link.OriginalUrl,
+		"versions":    versions,
+	}, link))
+}
+
+// RollbackDestination points a link back at the destination of an earlier
+// version. The rollback is a change of its own and shows up in the history.
+// Requires authentication.
+func (h *Handler) RollbackDestination(c *gin.Context) {
+	var rollbackRequest RollbackRequest
+	if err := c.ShouldBindJSON(&rollbackRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if rollbackRequest.Version == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "version is required", "field": "version"})
+		return
+	}
+
+	link, ok := h.ownedLink(c, c.Param("code"))
+	if !ok {
+		return
+	}
+	user, _ := auth.CurrentUser(c)
+
+	versions, err := h.versions.LinkVersions(link.ShortCode)
+	if !h.writeLinkChangeError(c, link.ShortCode, err) {
+		return
+	}
+	destination, found := store.DestinationAt(versions, *rollbackRequest.Version, link.OriginalUrl)
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No such version of this link", "field": "version"})
+		return
+	}
+	h.changeDestination(c, link, store.DestinationChange{
+		NewUrl:       destination,
+		ChangedBy:    user.Id,
+		RolledBackTo: rollbackRequest.Version,
+	}, "version")
+}
+
+// Screen and save a new destination for link and write the response.
+// Errors about the destination are reported on field.
+func (h *Handler) changeDestination(c *gin.Context, link store.Link, change store.DestinationChange, field string) {
+	if change.NewUrl == link.OriginalUrl {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The link already points to this destination", "field": field})
+		return
+	}
+
+	// Earlier versions are screened again too: lists change
+	verdict := h.screener.Check(change.NewUrl)
+	if verdict.Action == screening.Block {
+		log.Printf("Blocked destination %s for %s: %s", change.NewUrl, link.ShortCode, verdict.Reason)
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":  destinationBlockedMessage,
+			"code":   "destination_blocked",
+			"reason": verdict.Reason,
+			"field":  field,
+		})
+		return
+	}
+	if verdict.Action == screening.Quarantine {
+		change.QuarantineReason = verdict.Reason
+	}
+	change.UTM = urlUTM(change.NewUrl)
+
+	version, err := h.versions.ChangeDestination(link.ShortCode, change)
+	if !h.writeLinkChangeError(c, link.ShortCode, err) {
+		return
+	}
+	link.OriginalUrl = change.NewUrl
+	link.QuarantineReason = change.QuarantineReason
+	h.describe(link)
+
+	log.Printf("Link %s now points to %s (version %d by %s)", link.ShortCode, link.OriginalUrl, version.Version, version.ChangedBy)
+	response := h.withLinkAddress(gin.H{
+		"message":  "destination updated successfully",
+		"long_url": link.OriginalUrl,
+		"version":  version,
+	}, link)
+	if link.IsQuarantined() {
+		response["message"] = "destination updated and held for review"
+		response["status"] = "quarantined"
+		response["reason"] = link.QuarantineReason
+		c.JSON(http.StatusAccepted, response)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
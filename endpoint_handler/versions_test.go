@@ -0,0 +1,104 @@
+package endpoint_handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"url-shortener/screening"
+	"url-shortener/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func redirectLocation(r http.Handler, shortCode string) string {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+shortCode, nil))
+	return w.Header().Get("Location")
+}
+
+func TestDestinationVersions(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	r := setupRouter(memoryStore)
+	key := issueAPIKey(t, memoryStore, "user-1")
+	authorizedRequest(r, http.MethodPost, "/create-short-url", key, `{"long_url": "https://example.com/v0", "alias": "moving"}`)
+	assert.Equal(t, "https://example.com/v0", redirectLocation(r, "moving"))
+
+	// The owner is whoever the credentials belong to, never the body
+	code, _ := authorizedRequest(r, http.MethodPut, "/links/moving/destination", "", `{"long_url": "https://example.com/v1", "user_id": "user-1"}`)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = authorizedRequest(r, http.MethodGet, "/links/moving/versions?user_id=user-1", "", "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, response := authorizedRequest(r, http.MethodPut, "/links/moving/destination", key, `{"long_url": "https://example.com/v1"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(1), response["version"].(map[string]interface{})["version"])
+	assert.Equal(t, "https://example.com/v1", redirectLocation(r, "moving"))
+
+	code, _ = authorizedRequest(r, http.MethodPut, "/links/moving/destination", key, `{"long_url": "HTTPS://Example.com/v2"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "https://example.com/v2", redirectLocation(r, "moving"))
+
+	// Back to what the link was created with
+	code, response = authorizedRequest(r, http.MethodPost, "/links/moving/rollback", key, `{"version": 0}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "https://example.com/v0", response["long_url"])
+	assert.Equal(t, "https://example.com/v0", redirectLocation(r, "moving"))
+
+	code, _ = authorizedRequest(r, http.MethodPost, "/links/moving/rollback", key, `{"version": 1}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "https://example.com/v1", redirectLocation(r, "moving"))
+
+	req := httptest.NewRequest(http.MethodGet, "/links/moving/versions", nil)
+	req.Header.Set("Authorization", "Bearer "+key)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var history struct {
+		CurrentUrl string              `json:"current_url"`
+		Versions   []store.LinkVersion `json:"versions"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	assert.Equal(t, "https://example.com/v1", history.CurrentUrl)
+	assert.Len(t, history.Versions, 4)
+	newest := history.Versions[0]
+	assert.Equal(t, 4, newest.Version)
+	assert.Equal(t, "https://example.com/v0", newest.OldUrl)
+	assert.Equal(t, "https://example.com/v1", newest.NewUrl)
+	assert.Equal(t, "user-1", newest.ChangedBy)
+	assert.Equal(t, 1, *newest.RolledBackTo)
+	assert.Nil(t, history.Versions[3].RolledBackTo)
+}
+
+func TestDestinationChangeErrors(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	screener := screening.New(screening.Config{Deny: screening.NewDomainList([]string{"evil.example"})})
+	r := setupScreenedRouter(memoryStore, screener)
+	key := issueAPIKey(t, memoryStore, "user-1")
+	other := issueAPIKey(t, memoryStore, "user-2")
+	authorizedRequest(r, http.MethodPost, "/create-short-url", key, `{"long_url": "https://example.com", "alias": "guarded"}`)
+
+	code, _ := authorizedRequest(r, http.MethodPut, "/links/guarded/destination", other, `{"long_url": "https://example.org", "user_id": "user-1"}`)
+	assert.Equal(t, http.StatusForbidden, code)
+
+	code, response := authorizedRequest(r, http.MethodPut, "/links/guarded/destination", key, `{"long_url": "ftp://example.org"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "long_url", response["field"])
+
+	code, _ = authorizedRequest(r, http.MethodPut, "/links/guarded/destination", key, `{"long_url": "https://example.com"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, response = authorizedRequest(r, http.MethodPut, "/links/guarded/destination", key, `{"long_url": "https://login.evil.example"}`)
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, "destination_blocked", response["code"])
+	assert.Equal(t, "https://example.com", redirectLocation(r, "guarded"))
+
+	code, _ = authorizedRequest(r, http.MethodPost, "/links/guarded/rollback", key, `{"version": 3}`)
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _ = authorizedRequest(r, http.MethodPost, "/links/guarded/rollback", key, `{}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	versions, err := memoryStore.LinkVersions("guarded")
+	assert.NoError(t, err)
+	assert.Empty(t, versions)
+}
@@ -0,0 +1,43 @@
+import { NextRequest, NextResponse } from "next/server";
+import { buildApiUrl } from "@/lib/config";
+
+// Cookies NextAuth keeps the database session token in
+const sessionCookies = [
+  "__Secure-next-auth.session-token",
+  "__Host-next-auth.session-token",
+  "next-auth.session-token",
+];
+
+// The session cookie belongs to the frontend's host and never reaches the
+// API, so signed-in users create links through here: the token is passed on
+// in the header the API authenticates sessions by.
+export async function POST(request: NextRequest) {
+  const token = sessionCookies
+    .map(name => request.cookies.get(name)?.value)
+    .find(value => value);
+
+  if (!token) {
+    return NextResponse.json({ error: "Unauthorized" }, { status: 401 });
+  }
+
+  try {
+    const response = await fetch(buildApiUrl('/create-short-url'), {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+        'X-Session-Token': token,
+      },
+      body: await request.text(),
+    });
+
+    const data = await response.json();
+    return NextResponse.json(data, { status: response.status });
+
+  } catch (error) {
+    console.error("Error creating short URL:", error);
+    return NextResponse.json(
+      { error: "Failed to create short URL" },
+      { status: 502 }
+    );
+  }
+}
@@ -34,14 +34,16 @@ export default function UrlShortenerForm({ onSuccess, requireAuth = false }: Url
     setError('');
 
     try {
-      const response = await fetch(buildApiUrl('/create-short-url'), {
+      // Signed-in users go through the frontend's server, which passes their
+      // session on to the API; guests call the API directly
+      const endpoint = session ? '/api/urls/create' : buildApiUrl('/create-short-url');
+      const response = await fetch(endpoint, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
         body: JSON.stringify({
           longUrl: url,
-          userId: session?.user?.id || session?.user?.email || 'guest-user'
         }),
       });
 
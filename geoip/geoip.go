@@ -0,0 +1,146 @@
+package geoip
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+	"url-shortener/store"
+
+	"github.com/oschwald/maxminddb-golang/v2"
+)
+
+// How often the database file is checked for changes by default
+const ReloadInterval = time.Minute
+
+// The part of a GeoLite2/GeoIP2 City record we store with each click
+type cityRecord struct {
+	Country struct {
+		IsoCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+// Resolver looks up country and city for IP addresses in a local
+// MaxMind-format (MMDB) database. The file is reloaded when it changes on
+// disk, so a fresh database can be dropped in without a restart.
+type Resolver struct {
+	path string
+
+	mu      sync.RWMutex
+	reader  *maxminddb.Reader
+	modTime time.Time
+	size    int64
+}
+
+// Open the database at path
+func Open(path string) (*Resolver, error) {
+	resolver := &Resolver{path: path}
+	if err := resolver.Reload(); err != nil {
+		return nil, err
+	}
+	return resolver, nil
+}
+
+// Reload the database file. On failure the previous database stays in use.
+func (r *Resolver) Reload() error {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return fmt.Errorf("geoip database: %v", err)
+	}
+	// Read the whole file rather than mapping it, so that overwriting it in
+	// place cannot corrupt the database in use
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return fmt.Errorf("geoip database: %v", err)
+	}
+	reader, err := maxminddb.OpenBytes(data)
+	if err != nil {
+		return fmt.Errorf("geoip database: %v", err)
+	}
+
+	r.mu.Lock()
+	previous := r.reader
+	r.reader = reader
+	r.modTime = info.ModTime()
+	r.size = info.Size()
+	r.mu.Unlock()
+
+	if previous != nil {
+		previous.Close()
+	}
+	log.Printf("GeoIP database loaded from %s (%s)", r.path, reader.Metadata.DatabaseType)
+	return nil
+}
+
+// Whether the file on disk differs from the one loaded
+func (r *Resolver) changed() bool {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return !info.ModTime().Equal(r.modTime) || info.Size() != r.size
+}
+
+// Watch reloads the database whenever the file changes until the context is
+// cancelled
+func (r *Resolver) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			if err := r.Reload(); err != nil {
+				log.Printf("Warning: Failed reloading GeoIP database: %v", err)
+			}
+		}
+	}
+}
+
+// Lookup returns the ISO country code and English city name for an IP
+// address. Unknown, private and malformed addresses give empty strings.
+func (r *Resolver) Lookup(ipAddress string) (country string, city string) {
+	ip, err := netip.ParseAddr(ipAddress)
+	if err != nil {
+		return "", ""
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.reader == nil {
+		return "", ""
+	}
+
+	var record cityRecord
+	if err := r.reader.Lookup(ip.Unmap()).Decode(&record); err != nil {
+		return "", ""
+	}
+	return record.Country.IsoCode, record.City.Names["en"]
+}
+
+// EnrichClick fills in country and city from the click's IP address
+func (r *Resolver) EnrichClick(click *store.Click) {
+	click.Country, click.City = r.Lookup(click.IpAddress)
+}
+
+func (r *Resolver) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.reader != nil {
+		r.reader.Close()
+		r.reader = nil
+	}
+}
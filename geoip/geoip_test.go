@@ -0,0 +1,87 @@
+package geoip
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"url-shortener/store"
+
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+	"github.com/stretchr/testify/assert"
+)
+
+// Write a tiny City database mapping one network to a country and city
+func writeDatabase(t *testing.T, path string, network string, country string, city string) {
+	t.Helper()
+	tree, err := mmdbwriter.New(mmdbwriter.Options{DatabaseType: "GeoLite2-City", RecordSize: 24})
+	assert.NoError(t, err)
+
+	_, ipNet, err := net.ParseCIDR(network)
+	assert.NoError(t, err)
+	assert.NoError(t, tree.Insert(ipNet, mmdbtype.Map{
+		"country": mmdbtype.Map{"iso_code": mmdbtype.String(country)},
+		"city":    mmdbtype.Map{"names": mmdbtype.Map{"en": mmdbtype.String(city)}},
+	}))
+
+	file, err := os.Create(path)
+	assert.NoError(t, err)
+	defer file.Close()
+	_, err = tree.WriteTo(file)
+	assert.NoError(t, err)
+}
+
+func TestLookupAndEnrich(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	writeDatabase(t, path, "81.2.69.0/24", "GB", "London")
+
+	resolver, err := Open(path)
+	assert.NoError(t, err)
+	defer resolver.Close()
+
+	country, city := resolver.Lookup("81.2.69.142")
+	assert.Equal(t, "GB", country)
+	assert.Equal(t, "London", city)
+
+	country, city = resolver.Lookup("not-an-ip")
+	assert.Empty(t, country)
+	assert.Empty(t, city)
+
+	click := store.Click{IpAddress: "::ffff:81.2.69.1"}
+	resolver.EnrichClick(&click)
+	assert.Equal(t, "GB", click.Country)
+	assert.Equal(t, "London", click.City)
+}
+
+func TestReloadWhenFileChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	writeDatabase(t, path, "81.2.69.0/24", "GB", "London")
+
+	resolver, err := Open(path)
+	assert.NoError(t, err)
+	defer resolver.Close()
+	assert.False(t, resolver.changed())
+
+	writeDatabase(t, path, "81.2.69.0/24", "FR", "Paris")
+	later := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(path, later, later))
+	assert.True(t, resolver.changed())
+
+	assert.NoError(t, resolver.Reload())
+	country, city := resolver.Lookup("81.2.69.142")
+	assert.Equal(t, "FR", country)
+	assert.Equal(t, "Paris", city)
+
+	// A broken file keeps the previous database in use
+	assert.NoError(t, os.WriteFile(path, []byte("garbage"), 0o644))
+	assert.Error(t, resolver.Reload())
+	country, _ = resolver.Lookup("81.2.69.142")
+	assert.Equal(t, "FR", country)
+}
+
+func TestOpenMissingFile(t *testing.T) {
+	_, err := Open(filepath.Join(t.TempDir(), "missing.mmdb"))
+	assert.Error(t, err)
+}
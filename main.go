@@ -1,10 +1,26 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"url-shortener/auth"
+	"url-shortener/domains"
 	"url-shortener/endpoint_handler"
+	"url-shortener/geoip"
+	"url-shortener/metadata"
+	"url-shortener/plan"
+	"url-shortener/ratelimit"
+	"url-shortener/screening"
+	shorturl "url-shortener/shorturl"
 	"url-shortener/store"
+	"url-shortener/useragent"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"time"
@@ -17,6 +33,19 @@ func main() {
 	}
 	
 	r := gin.Default()
+
+	// Client IPs key the rate limits, password attempts and click analytics,
+	// so X-Forwarded-For is only believed when it comes from a proxy we run
+	// behind. Without TRUSTED_PROXIES the peer address is used as is.
+	var trustedProxies []string
+	if proxies := os.Getenv("TRUSTED_PROXIES"); proxies != "" {
+		for _, proxy := range strings.Split(proxies, ",") {
+			trustedProxies = append(trustedProxies, strings.TrimSpace(proxy))
+		}
+	}
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 	
 	// Get allowed origins from environment or use defaults
 	allowedOrigins := []string{
@@ -35,11 +64,97 @@ func main() {
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     allowedOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization", auth.SessionHeader},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 	
+	// Initialize store
+	storage := store.Open(os.Getenv("STORE_BACKEND"))
+	defer storage.Close()
+
+	// Background jobs run until the server shuts down
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	// Periodically mark expired links inactive
+	go store.RunExpirySweeper(backgroundCtx, storage, store.SweepInterval)
+
+	// Reserved short codes: registered routes plus a configurable list
+	reserved := shorturl.NewReservedWords(strings.Split(os.Getenv("RESERVED_SHORT_CODES"), ",")...)
+	if path := os.Getenv("RESERVED_SHORT_CODES_FILE"); path != "" {
+		if err := reserved.AddFile(path); err != nil {
+			log.Printf("Warning: Failed to load reserved short codes from %s: %v", path, err)
+		}
+	}
+
+	// Clicks are written in batches off the redirect path
+	clickConfig := store.DefaultClickQueueConfig
+	clickConfig.Enrichers = []store.ClickEnricher{useragent.Enricher{}}
+
+	// Resolve country and city of each click from a local MMDB file
+	if path := os.Getenv("GEOIP_DB_PATH"); path != "" {
+		resolver, err := geoip.Open(path)
+		if err != nil {
+			log.Printf("Warning: GeoIP enrichment disabled: %v", err)
+		} else {
+			defer resolver.Close()
+			go resolver.Watch(backgroundCtx, geoip.ReloadInterval)
+			clickConfig.Enrichers = append(clickConfig.Enrichers, resolver)
+		}
+	}
+
+	clickQueue := store.NewClickQueue(storage, clickConfig)
+	defer clickQueue.Close()
+
+	// Subscription tiers decide rate limits, quotas and features
+	tiers := plan.NewResolver(storage, plan.CacheDuration)
+
+	// Destinations are screened against domain lists, a local threat list
+	// and lookalike checks. List files are reloaded when they change.
+	denyDomains := screening.NewDomainList(strings.Split(os.Getenv("SCREENING_DENY_DOMAINS"), ","))
+	if path := os.Getenv("SCREENING_DENY_FILE"); path != "" {
+		if err := denyDomains.LoadFile(path); err != nil {
+			log.Printf("Warning: Failed to load screening deny list: %v", err)
+		}
+		go denyDomains.Watch(backgroundCtx, screening.ReloadInterval)
+	}
+	allowDomains := screening.NewDomainList(strings.Split(os.Getenv("SCREENING_ALLOW_DOMAINS"), ","))
+	if path := os.Getenv("SCREENING_ALLOW_FILE"); path != "" {
+		if err := allowDomains.LoadFile(path); err != nil {
+			log.Printf("Warning: Failed to load screening allow list: %v", err)
+		}
+		go allowDomains.Watch(backgroundCtx, screening.ReloadInterval)
+	}
+	screeningConfig := screening.Config{Deny: denyDomains, Allow: allowDomains}
+	if domains := os.Getenv("SCREENING_PROTECTED_DOMAINS"); domains != "" {
+		screeningConfig.Protected = append(strings.Split(domains, ","), screening.DefaultProtectedDomains...)
+	}
+	if path := os.Getenv("THREAT_LIST_PATH"); path != "" {
+		threats, err := screening.LoadThreatList(path)
+		if err != nil {
+			log.Printf("Warning: Threat list screening disabled: %v", err)
+		} else {
+			go threats.Watch(backgroundCtx, screening.ReloadInterval)
+			screeningConfig.Threats = threats
+		}
+	}
+	screener := screening.New(screeningConfig)
+
+	// Titles and descriptions of new destinations are fetched in the
+	// background; METADATA_FETCH=off disables it
+	var describer *metadata.Queue
+	if os.Getenv("METADATA_FETCH") != "off" {
+		describer = metadata.NewQueue(metadata.NewFetcher(metadata.DefaultConfig), storage, metadata.DefaultQueueConfig)
+		defer describer.Close()
+	}
+
+	handler := endpoint_handler.New(storage, clickQueue, reserved, tiers, screener, describer, domains.NewVerifier(nil))
+
+	// Requests with an API key act as the key's owner, browser requests as
+	// the user signed in to the frontend
+	r.Use(auth.APIKeys(storage), auth.Sessions(storage))
+
 	r.GET("/", func(c *gin.Context) {
 		c.JSON(200, gin.H{
 			"message": "Welcome to the URL Shortener API",
@@ -47,16 +162,198 @@ func main() {
 		})
 	})
 
-	r.POST("/create-short-url", func(c *gin.Context) {
-		endpoint_handler.CreateShortUrl(c)
+	r.GET("/metrics", func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"click_queue":    clickQueue.Stats(),
+			"metadata_queue": describer.Stats(),
+		})
 	})
 
-	r.GET("/:shortUrl", func(c *gin.Context) {
-		endpoint_handler.HandleShortUrlRedirect(c)
+	// Rate limits follow the client's subscription tier. Counts are shared
+	// between instances through Redis and kept in memory while it is down.
+	var limiter ratelimit.Limiter = ratelimit.NewMemoryLimiter()
+	if service, ok := storage.(*store.StorageService); ok {
+		limiter = ratelimit.WithFallback(ratelimit.NewRedisLimiter(service.RedisClient()), limiter)
+	}
+
+	r.POST("/create-short-url", ratelimit.Middleware(limiter, tiers, ratelimit.Create), func(c *gin.Context) {
+		handler.CreateShortUrl(c)
 	})
 
-	// Initialize store
-	store.InitializeStore()
+	// A bulk request counts as one create against the rate limit; its size
+	// is capped by the plan instead
+	r.POST("/links/bulk", auth.Required(), ratelimit.Middleware(limiter, tiers, ratelimit.Create), func(c *gin.Context) {
+		handler.CreateLinksBulk(c)
+	})
+
+	r.GET("/:shortUrl", ratelimit.Middleware(limiter, tiers, ratelimit.Redirect), func(c *gin.Context) {
+		handler.HandleShortUrlRedirect(c)
+	})
+
+	r.POST("/:shortUrl", func(c *gin.Context) {
+		handler.UnlockShortUrl(c)
+	})
+
+	r.GET("/:shortUrl/qr", ratelimit.Middleware(limiter, tiers, ratelimit.Redirect), func(c *gin.Context) {
+		handler.QRCode(c)
+	})
+
+	r.PATCH("/links/:code", auth.Required(), func(c *gin.Context) {
+		handler.UpdateLink(c)
+	})
+
+	r.DELETE("/links/:code", auth.Required(), func(c *gin.Context) {
+		handler.DeleteLink(c)
+	})
+
+	// Destination edits are recorded so the owner can roll them back
+	r.PUT("/links/:code/destination", auth.Required(), func(c *gin.Context) {
+		handler.UpdateDestination(c)
+	})
+
+	r.GET("/links/:code/versions", auth.Required(), func(c *gin.Context) {
+		handler.ListLinkVersions(c)
+	})
+
+	r.POST("/links/:code/rollback", auth.Required(), func(c *gin.Context) {
+		handler.RollbackDestination(c)
+	})
+
+	r.GET("/links/:code/stats", auth.Required(), func(c *gin.Context) {
+		handler.LinkStats(c)
+	})
+
+	// Moderators release links held back by screening
+	r.POST("/links/:code/release", auth.Required(), func(c *gin.Context) {
+		handler.ReleaseLink(c)
+	})
+
+	r.GET("/me", auth.Required(), func(c *gin.Context) {
+		handler.Me(c)
+	})
+
+	r.GET("/me/usage", auth.Required(), func(c *gin.Context) {
+		handler.Usage(c)
+	})
+
+	r.GET("/me/export/links", auth.Required(), func(c *gin.Context) {
+		handler.ExportLinks(c)
+	})
+
+	r.GET("/me/export/clicks", auth.Required(), func(c *gin.Context) {
+		handler.ExportClicks(c)
+	})
+
+	r.GET("/me/links", auth.Required(), func(c *gin.Context) {
+		handler.ListLinks(c)
+	})
+
+	// Links are filed under any number of tags and at most one campaign
+	r.PUT("/links/:code/tags", auth.Required(), func(c *gin.Context) {
+		handler.SetLinkTags(c)
+	})
+
+	r.PUT("/links/:code/campaign", auth.Required(), func(c *gin.Context) {
+		handler.SetLinkCampaign(c)
+	})
+
+	tags := r.Group("/tags", auth.Required())
+
+	tags.POST("", func(c *gin.Context) {
+		handler.CreateTag(c)
+	})
+
+	tags.GET("", func(c *gin.Context) {
+		handler.ListTags(c)
+	})
+
+	tags.PUT("/:id", func(c *gin.Context) {
+		handler.RenameTag(c)
+	})
+
+	tags.DELETE("/:id", func(c *gin.Context) {
+		handler.DeleteTag(c)
+	})
+
+	tags.GET("/:id/stats", func(c *gin.Context) {
+		handler.TagStats(c)
+	})
+
+	campaigns := r.Group("/campaigns", auth.Required())
+
+	campaigns.POST("", func(c *gin.Context) {
+		handler.CreateCampaign(c)
+	})
+
+	campaigns.GET("", func(c *gin.Context) {
+		handler.ListCampaigns(c)
+	})
+
+	campaigns.PUT("/:id", func(c *gin.Context) {
+		handler.RenameCampaign(c)
+	})
+
+	campaigns.DELETE("/:id", func(c *gin.Context) {
+		handler.DeleteCampaign(c)
+	})
+
+	campaigns.GET("/:id/stats", func(c *gin.Context) {
+		handler.CampaignStats(c)
+	})
+
+	// Key management needs an authenticated user
+	apiKeys := r.Group("/api-keys", auth.Required())
+
+	apiKeys.POST("", func(c *gin.Context) {
+		handler.CreateAPIKey(c)
+	})
+
+	apiKeys.GET("", func(c *gin.Context) {
+		handler.ListAPIKeys(c)
+	})
+
+	apiKeys.DELETE("/:id", func(c *gin.Context) {
+		handler.RevokeAPIKey(c)
+	})
+
+	// Saved UTM parameters for new links
+	utmPresets := r.Group("/utm-presets", auth.Required())
+
+	utmPresets.POST("", func(c *gin.Context) {
+		handler.CreateUTMPreset(c)
+	})
+
+	utmPresets.GET("", func(c *gin.Context) {
+		handler.ListUTMPresets(c)
+	})
+
+	utmPresets.DELETE("/:id", func(c *gin.Context) {
+		handler.DeleteUTMPreset(c)
+	})
+
+	// Custom domains links are issued under once their TXT record checks out
+	customDomains := r.Group("/domains", auth.Required())
+
+	customDomains.POST("", func(c *gin.Context) {
+		handler.CreateDomain(c)
+	})
+
+	customDomains.GET("", func(c *gin.Context) {
+		handler.ListDomains(c)
+	})
+
+	customDomains.POST("/:id/verify", func(c *gin.Context) {
+		handler.VerifyDomain(c)
+	})
+
+	customDomains.DELETE("/:id", func(c *gin.Context) {
+		handler.DeleteDomain(c)
+	})
+
+	// Every top-level route segment is off limits for short codes
+	for _, route := range r.Routes() {
+		reserved.AddRoutePath(route.Path)
+	}
 
 	// Get port from environment or use default
 	port := os.Getenv("PORT")
@@ -64,8 +361,24 @@ func main() {
 		port = "9808"
 	}
 
-	err := r.Run(":" + port)
-	if err != nil {
-		panic(fmt.Sprintf("Failed to start the web server - Error: %v", err))
+	server := &http.Server{Addr: ":" + port, Handler: r}
+	go func() {
+		err := server.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			panic(fmt.Sprintf("Failed to start the web server - Error: %v", err))
+		}
+	}()
+
+	// Wait for a shutdown signal, then let in-flight requests finish before
+	// the deferred cleanup flushes queued clicks and closes the store
+	signalCtx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+	<-signalCtx.Done()
+	log.Println("Shutting down the web server...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Warning: Web server did not shut down cleanly: %v", err)
 	}
 }
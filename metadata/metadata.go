@@ -0,0 +1,140 @@
+// Package metadata describes link destinations: it fetches the page a link
+// points to and reads its title, description, Open Graph tags and favicon.
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"time"
+	"url-shortener/store"
+
+	"golang.org/x/net/html/charset"
+)
+
+// Returned when a destination resolves to an address that is not public
+var ErrForbiddenAddress = errors.New("destination address is not public")
+
+// Returned for destinations that are not HTML pages
+var ErrNotHTML = errors.New("destination is not an HTML page")
+
+// Limits of a single fetch
+type Config struct {
+	Timeout      time.Duration // Whole fetch, redirects and body included
+	MaxBytes     int64         // Body read at most; the head of a page is near its start
+	MaxRedirects int
+	UserAgent    string
+
+	// Addresses the fetcher may connect to, IsPublic when nil. Tests allow
+	// loopback to fetch from httptest servers.
+	AllowAddress func(netip.Addr) bool
+}
+
+var DefaultConfig = Config{
+	Timeout:      5 * time.Second,
+	MaxBytes:     512 << 10,
+	MaxRedirects: 3,
+	UserAgent:    "Mozilla/5.0 (compatible; ShortLinkBot/1.0; link preview)",
+}
+
+// Fetcher reads the metadata of destination pages
+type Fetcher struct {
+	config Config
+	client *http.Client
+}
+
+func NewFetcher(config Config) *Fetcher {
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultConfig.Timeout
+	}
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = DefaultConfig.MaxBytes
+	}
+	if config.MaxRedirects <= 0 {
+		config.MaxRedirects = DefaultConfig.MaxRedirects
+	}
+	if config.UserAgent == "" {
+		config.UserAgent = DefaultConfig.UserAgent
+	}
+	if config.AllowAddress == nil {
+		config.AllowAddress = IsPublic
+	}
+
+	dialer := &net.Dialer{
+		Timeout: config.Timeout,
+		Control: dialControl(config.AllowAddress),
+	}
+	transport := &http.Transport{
+		// No proxy: it would connect on the fetcher's behalf, past the
+		// address check
+		Proxy:                  nil,
+		DialContext:            dialer.DialContext,
+		TLSHandshakeTimeout:    config.Timeout,
+		ResponseHeaderTimeout:  config.Timeout,
+		MaxResponseHeaderBytes: 64 << 10,
+		DisableKeepAlives:      true,
+	}
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   config.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > config.MaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", config.MaxRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+	return &Fetcher{config: config, client: client}
+}
+
+// Fetch reads the metadata of the page at destination. Only the head of
+// the page is parsed; links in it are made absolute.
+func (f *Fetcher) Fetch(ctx context.Context, destination string) (store.LinkMetadata, error) {
+	target, err := url.Parse(destination)
+	if err != nil {
+		return store.LinkMetadata{}, err
+	}
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return store.LinkMetadata{}, fmt.Errorf("unsupported scheme %q", target.Scheme)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, destination, nil)
+	if err != nil {
+		return store.LinkMetadata{}, err
+	}
+	req.Header.Set("User-Agent", f.config.UserAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return store.LinkMetadata{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return store.LinkMetadata{}, fmt.Errorf("destination answered %s", resp.Status)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return store.LinkMetadata{}, fmt.Errorf("%w: %s", ErrNotHTML, contentType)
+	}
+
+	body, err := charset.NewReader(io.LimitReader(resp.Body, f.config.MaxBytes), contentType)
+	if err != nil {
+		return store.LinkMetadata{}, err
+	}
+	head, err := parseHead(body, resp.Request.URL)
+	if err != nil {
+		return store.LinkMetadata{}, err
+	}
+	return head.metadata(destination, time.Now()), nil
+}
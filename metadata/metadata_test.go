@@ -0,0 +1,165 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+	"url-shortener/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Lets tests fetch from httptest servers while everything else stays refused
+func allowLoopback(addr netip.Addr) bool {
+	return addr.IsLoopback() || IsPublic(addr)
+}
+
+func TestIsPublic(t *testing.T) {
+	for address, public := range map[string]bool{
+		"93.184.216.34":    true,
+		"2606:4700::1111":  true,
+		"127.0.0.1":        false,
+		"::1":              false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"192.168.1.1":      false,
+		"169.254.169.254":  false, // Cloud metadata services
+		"100.64.0.1":       false,
+		"0.0.0.0":          false,
+		"fd00::1":          false,
+		"fe80::1":          false,
+		"::ffff:127.0.0.1": false,
+		"64:ff9b::a00:1":   false,
+		"255.255.255.255":  false,
+	} {
+		assert.Equal(t, public, IsPublic(netip.MustParseAddr(address)), address)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, `<!doctype html><html><head>
+				<base href="/assets/">
+				<title>  Plain
+				title </title>
+				<meta name="description" content="Plain description">
+				<meta property="og:title" content="Open Graph &amp; title">
+				<meta property="og:image" content="cover.png">
+				<meta property="og:site_name" content="Example">
+				<link rel="apple-touch-icon" href="touch.png">
+				<link rel="shortcut icon" href="/favicon.png">
+				</head><body><meta property="og:description" content="In the body"></body></html>`)
+		case "/latin1":
+			w.Header().Set("Content-Type", "text/html; charset=iso-8859-1")
+			w.Write([]byte("<title>Caf\xe9</title>"))
+		case "/moved":
+			http.Redirect(w, r, "/latin1", http.StatusFound)
+		case "/json":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{}`)
+		}
+	}))
+	defer server.Close()
+	fetcher := NewFetcher(Config{AllowAddress: allowLoopback})
+
+	metadata, err := fetcher.Fetch(context.Background(), server.URL+"/page")
+	assert.NoError(t, err)
+	assert.Equal(t, server.URL+"/page", metadata.OriginalUrl)
+	assert.Equal(t, "Open Graph & title", metadata.Title)
+	assert.Equal(t, "Plain description", metadata.Description)
+	assert.Equal(t, server.URL+"/assets/cover.png", metadata.ImageUrl)
+	assert.Equal(t, "Example", metadata.SiteName)
+	assert.Equal(t, server.URL+"/favicon.png", metadata.FaviconUrl)
+	assert.False(t, metadata.FetchedAt.IsZero())
+
+	metadata, err = fetcher.Fetch(context.Background(), server.URL+"/moved")
+	assert.NoError(t, err)
+	assert.Equal(t, "Café", metadata.Title)
+	assert.Equal(t, server.URL+"/favicon.ico", metadata.FaviconUrl)
+
+	_, err = fetcher.Fetch(context.Background(), server.URL+"/json")
+	assert.ErrorIs(t, err, ErrNotHTML)
+}
+
+func TestFetchRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/internal" {
+			http.Redirect(w, r, "http://10.0.0.1/admin", http.StatusFound)
+			return
+		}
+		fmt.Fprint(w, "<title>Local</title>")
+	}))
+	defer server.Close()
+
+	_, err := NewFetcher(Config{}).Fetch(context.Background(), server.URL)
+	assert.ErrorIs(t, err, ErrForbiddenAddress)
+
+	// Redirects are checked too
+	_, err = NewFetcher(Config{AllowAddress: allowLoopback}).Fetch(context.Background(), server.URL+"/internal")
+	assert.ErrorIs(t, err, ErrForbiddenAddress)
+
+	_, err = NewFetcher(Config{}).Fetch(context.Background(), "file:///etc/passwd")
+	assert.Error(t, err)
+}
+
+func TestFetchLimits(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/large":
+			fmt.Fprint(w, "<head><!--"+strings.Repeat("x", 64<<10)+"--><title>Too far</title></head>")
+		case "/slow":
+			time.Sleep(500 * time.Millisecond)
+			fmt.Fprint(w, "<title>Late</title>")
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+	fetcher := NewFetcher(Config{AllowAddress: allowLoopback, Timeout: 100 * time.Millisecond, MaxBytes: 4 << 10})
+
+	metadata, err := fetcher.Fetch(context.Background(), server.URL+"/large")
+	assert.NoError(t, err)
+	assert.Empty(t, metadata.Title)
+
+	_, err = fetcher.Fetch(context.Background(), server.URL+"/slow")
+	assert.Error(t, err)
+
+	_, err = fetcher.Fetch(context.Background(), server.URL+"/loop")
+	assert.ErrorContains(t, err, "redirects")
+}
+
+func TestQueue(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<title>Described</title>")
+	}))
+	defer server.Close()
+
+	memoryStore := store.NewMemoryStore()
+	assert.NoError(t, memoryStore.SaveLink(store.Link{ShortCode: "abc123", OriginalUrl: server.URL}))
+	queue := NewQueue(NewFetcher(Config{AllowAddress: allowLoopback}), memoryStore, QueueConfig{})
+	defer queue.Close()
+
+	assert.True(t, queue.Enqueue("abc123", server.URL))
+	// Not stored: the link points somewhere else
+	assert.True(t, queue.Enqueue("missing", server.URL))
+	assert.Eventually(t, func() bool {
+		stats := queue.Stats()
+		return stats.Fetched+stats.Failed == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, "Described", memoryStore.Metadata("abc123").Title)
+	assert.Equal(t, int64(1), queue.Stats().Failed)
+
+	var none *Queue
+	assert.False(t, none.Enqueue("abc123", server.URL))
+}
@@ -0,0 +1,192 @@
+package metadata
+
+import (
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+	"url-shortener/store"
+
+	"golang.org/x/net/html"
+)
+
+// Longest values kept; pages sometimes stuff whole articles into tags
+const (
+	maxTitleLength       = 300
+	maxDescriptionLength = 1000
+	maxUrlLength         = 2048
+)
+
+// What the head of a page says about it
+type pageHead struct {
+	base *url.URL // Links are relative to this, the page or its <base>
+
+	title         string
+	description   string
+	ogTitle       string
+	ogDescription string
+	ogImage       string
+	ogSiteName    string
+	favicon       string
+	faviconRank   int // How good a favicon the one found is, 0 for none
+}
+
+// Read the head of an HTML page. Parsing stops at the body, so the tags
+// pages put in their body and the rest of a long page are never looked at.
+func parseHead(r io.Reader, pageUrl *url.URL) (pageHead, error) {
+	head := pageHead{base: pageUrl}
+	tokenizer := html.NewTokenizer(r)
+	inTitle := false
+	haveBase := false
+
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			if err := tokenizer.Err(); !errors.Is(err, io.EOF) {
+				return head, err
+			}
+			return head, nil
+
+		case html.TextToken:
+			if inTitle {
+				head.title += string(tokenizer.Text())
+			}
+
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "head":
+				return head, nil
+			}
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttributes := tokenizer.TagName()
+			attributes := make(map[string]string)
+			for hasAttributes {
+				var key, value []byte
+				key, value, hasAttributes = tokenizer.TagAttr()
+				attributes[string(key)] = string(value)
+			}
+
+			switch string(name) {
+			case "body":
+				return head, nil
+			case "title":
+				inTitle = head.title == ""
+			case "base":
+				if href, ok := attributes["href"]; ok && !haveBase {
+					if resolved, err := head.base.Parse(href); err == nil {
+						head.base = resolved
+						haveBase = true
+					}
+				}
+			case "meta":
+				head.readMeta(attributes)
+			case "link":
+				head.readLink(attributes)
+			}
+		}
+	}
+}
+
+func (h *pageHead) readMeta(attributes map[string]string) {
+	content := attributes["content"]
+	// Open Graph uses property, but name is common enough in the wild
+	key := strings.ToLower(attributes["property"])
+	if key == "" {
+		key = strings.ToLower(attributes["name"])
+	}
+
+	setOnce := func(field *string) {
+		if *field == "" {
+			*field = content
+		}
+	}
+	switch key {
+	case "description":
+		setOnce(&h.description)
+	case "og:title":
+		setOnce(&h.ogTitle)
+	case "og:description":
+		setOnce(&h.ogDescription)
+	case "og:image", "og:image:url", "og:image:secure_url":
+		setOnce(&h.ogImage)
+	case "og:site_name":
+		setOnce(&h.ogSiteName)
+	}
+}
+
+func (h *pageHead) readLink(attributes map[string]string) {
+	href := attributes["href"]
+	if href == "" {
+		return
+	}
+	rank := 0
+	for _, rel := range strings.Fields(strings.ToLower(attributes["rel"])) {
+		switch rel {
+		case "icon":
+			rank = max(rank, 2)
+		case "apple-touch-icon":
+			rank = max(rank, 1)
+		}
+	}
+	if rank > h.faviconRank {
+		h.favicon = href
+		h.faviconRank = rank
+	}
+}
+
+// The metadata to store: Open Graph values win over the plain ones, and
+// pages without a declared favicon get the conventional /favicon.ico
+func (h pageHead) metadata(destination string, fetchedAt time.Time) store.LinkMetadata {
+	title := h.ogTitle
+	if strings.TrimSpace(title) == "" {
+		title = h.title
+	}
+	description := h.ogDescription
+	if strings.TrimSpace(description) == "" {
+		description = h.description
+	}
+	favicon := h.resolve(h.favicon)
+	if favicon == "" {
+		favicon = h.resolve("/favicon.ico")
+	}
+
+	return store.LinkMetadata{
+		OriginalUrl: destination,
+		Title:       cleanText(title, maxTitleLength),
+		Description: cleanText(description, maxDescriptionLength),
+		ImageUrl:    h.resolve(h.ogImage),
+		SiteName:    cleanText(h.ogSiteName, maxTitleLength),
+		FaviconUrl:  favicon,
+		FetchedAt:   fetchedAt,
+	}
+}
+
+// An absolute http(s) URL for a link of the page, empty when there is none
+func (h pageHead) resolve(reference string) string {
+	reference = strings.TrimSpace(reference)
+	if reference == "" {
+		return ""
+	}
+	resolved, err := h.base.Parse(reference)
+	if err != nil || (resolved.Scheme != "http" && resolved.Scheme != "https") || resolved.Host == "" {
+		return ""
+	}
+	if value := resolved.String(); len(value) <= maxUrlLength {
+		return value
+	}
+	return ""
+}
+
+// Collapse whitespace and cut to at most limit characters
+func cleanText(value string, limit int) string {
+	value = strings.Join(strings.Fields(value), " ")
+	if runes := []rune(value); len(runes) > limit {
+		return strings.TrimSpace(string(runes[:limit-1])) + "…"
+	}
+	return value
+}
@@ -0,0 +1,168 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"url-shortener/store"
+)
+
+// Sizing of the background fetcher
+type QueueConfig struct {
+	Capacity int // Links waiting before new ones are dropped
+	Workers  int // Pages fetched concurrently
+}
+
+var DefaultQueueConfig = QueueConfig{
+	Capacity: 1000,
+	Workers:  4,
+}
+
+// Counters describing the metadata fetcher since start
+type QueueStats struct {
+	Enqueued int64 `json:"enqueued"`
+	Dropped  int64 `json:"dropped"`
+	Fetched  int64 `json:"fetched"`
+	Failed   int64 `json:"failed"`
+	Pending  int   `json:"pending"`
+	Capacity int   `json:"capacity"`
+}
+
+type job struct {
+	shortCode   string
+	destination string
+}
+
+// Queue describes saved links in the background. Creating a link only puts
+// it on a bounded queue; workers fetch the destination and store what they
+// find. Metadata is a nicety, so links are dropped rather than waited on
+// when the queue is full, and a failed fetch is not retried.
+type Queue struct {
+	fetcher  *Fetcher
+	metadata store.MetadataStore
+	config   QueueConfig
+	jobs     chan job
+	wg       sync.WaitGroup
+
+	// Cancels fetches in flight on Close
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.RWMutex
+	closed bool
+
+	enqueued atomic.Int64
+	dropped  atomic.Int64
+	fetched  atomic.Int64
+	failed   atomic.Int64
+}
+
+// Initializing a metadata queue and starting its workers
+func NewQueue(fetcher *Fetcher, metadata store.MetadataStore, config QueueConfig) *Queue {
+	if config.Capacity <= 0 {
+		config.Capacity = DefaultQueueConfig.Capacity
+	}
+	if config.Workers <= 0 {
+		config.Workers = DefaultQueueConfig.Workers
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &Queue{
+		fetcher:  fetcher,
+		metadata: metadata,
+		config:   config,
+		jobs:     make(chan job, config.Capacity),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	for i := 0; i < config.Workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+	return q
+}
+
+// Enqueue asks for the destination of a link to be described, without ever
+// blocking. Returns false when the link was dropped. A nil Queue drops
+// everything.
+func (q *Queue) Enqueue(shortCode string, destination string) bool {
+	if q == nil {
+		return false
+	}
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		q.dropped.Add(1)
+		return false
+	}
+	select {
+	case q.jobs <- job{shortCode: shortCode, destination: destination}:
+		q.enqueued.Add(1)
+		return true
+	default:
+		q.dropped.Add(1)
+		return false
+	}
+}
+
+// Close stops accepting links, abandons the ones still waiting and cancels
+// the fetches in flight
+func (q *Queue) Close() {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	close(q.jobs)
+	q.mu.Unlock()
+
+	q.cancel()
+	q.wg.Wait()
+	log.Printf("Metadata queue stopped: %+v", q.Stats())
+}
+
+// Stats of a nil Queue are all zero
+func (q *Queue) Stats() QueueStats {
+	if q == nil {
+		return QueueStats{}
+	}
+	return QueueStats{
+		Enqueued: q.enqueued.Load(),
+		Dropped:  q.dropped.Load(),
+		Fetched:  q.fetched.Load(),
+		Failed:   q.failed.Load(),
+		Pending:  len(q.jobs),
+		Capacity: q.config.Capacity,
+	}
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+	for job := range q.jobs {
+		if q.ctx.Err() != nil {
+			continue
+		}
+		q.describe(job)
+	}
+}
+
+func (q *Queue) describe(job job) {
+	metadata, err := q.fetcher.Fetch(q.ctx, job.destination)
+	if err == nil {
+		err = q.metadata.SaveLinkMetadata(job.shortCode, metadata)
+	}
+	switch {
+	case err == nil:
+		q.fetched.Add(1)
+	case errors.Is(err, store.ErrNotFound):
+		// Deleted or pointed elsewhere while the page was fetched
+		q.failed.Add(1)
+	default:
+		log.Printf("Warning: Failed describing %s (%s) | Error: %v", job.shortCode, job.destination, err)
+		q.failed.Add(1)
+	}
+}
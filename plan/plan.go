@@ -0,0 +1,172 @@
+package plan
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+	"url-shortener/store"
+)
+
+// Values of users.subscription_tier
+const (
+	Free       = "FREE"
+	Pro        = "PRO"
+	Enterprise = "ENTERPRISE"
+)
+
+// Quota value meaning no cap
+const Unlimited = -1
+
+// Limits are what a subscription tier allows
+type Limits struct {
+	CreatesPerMinute   int `json:"creates_per_minute"`
+	RedirectsPerMinute int `json:"redirects_per_minute"`
+
+	LinksPerMonth int  `json:"links_per_month"`
+	CustomAliases int  `json:"custom_aliases"`
+	Expiry        bool `json:"expiry"`
+	Password      bool `json:"password"`
+	// How far back click analytics reach
+	AnalyticsRetentionDays int `json:"analytics_retention_days"`
+	// Most links created by one bulk request
+	BulkItems int `json:"bulk_items"`
+}
+
+var tiers = map[string]Limits{
+	Free: {
+		CreatesPerMinute:       10,
+		RedirectsPerMinute:     120,
+		LinksPerMonth:          50,
+		CustomAliases:          5,
+		AnalyticsRetentionDays: 30,
+		BulkItems:              20,
+	},
+	Pro: {
+		CreatesPerMinute:       60,
+		RedirectsPerMinute:     600,
+		LinksPerMonth:          1000,
+		CustomAliases:          100,
+		Expiry:                 true,
+		Password:               true,
+		AnalyticsRetentionDays: 365,
+		BulkItems:              500,
+	},
+	Enterprise: {
+		CreatesPerMinute:       300,
+		RedirectsPerMinute:     3000,
+		LinksPerMonth:          Unlimited,
+		CustomAliases:          Unlimited,
+		Expiry:                 true,
+		Password:               true,
+		AnalyticsRetentionDays: 3 * 365,
+		BulkItems:              5000,
+	},
+}
+
+// AnalyticsRetention is the oldest click analytics can reach back to
+func (l Limits) AnalyticsRetention() time.Duration {
+	return time.Duration(l.AnalyticsRetentionDays) * 24 * time.Hour
+}
+
+// EffectiveTier is the tier a user is billed at: their subscription tier
+// until subscription_expires passes, FREE after that or if it is unknown
+func EffectiveTier(user store.User, now time.Time) string {
+	if _, known := tiers[user.SubscriptionTier]; !known {
+		return Free
+	}
+	if user.SubscriptionExpires != nil && !now.Before(*user.SubscriptionExpires) {
+		return Free
+	}
+	return user.SubscriptionTier
+}
+
+// Start of the calendar month (UTC) monthly quotas are counted from
+func PeriodStart(now time.Time) time.Time {
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// LimitsFor returns the limits of a tier. Unknown tiers get FREE limits.
+func LimitsFor(tier string) Limits {
+	if limits, ok := tiers[tier]; ok {
+		return limits
+	}
+	return tiers[Free]
+}
+
+// How long a user's tier is remembered by default
+const CacheDuration = time.Minute
+
+type cachedTier struct {
+	tier    string
+	expires time.Time
+}
+
+// Resolver looks up the subscription tier of users. Tiers are cached
+// briefly since they are needed on hot paths such as redirects.
+type Resolver struct {
+	users store.UserStore
+	ttl   time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedTier
+}
+
+func NewResolver(users store.UserStore, ttl time.Duration) *Resolver {
+	return &Resolver{
+		users: users,
+		ttl:   ttl,
+		cache: make(map[string]cachedTier),
+	}
+}
+
+// Tier of a user. Anonymous and unknown users, and any lookup failure, give
+// FREE.
+func (r *Resolver) Tier(userId string) string {
+	if userId == "" || userId == "guest-user" {
+		return Free
+	}
+
+	now := time.Now()
+	r.mu.Lock()
+	cached, ok := r.cache[userId]
+	r.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.tier
+	}
+
+	tier := Free
+	expires := now.Add(r.ttl)
+	user, err := r.users.RetrieveUser(userId)
+	switch {
+	case err == nil:
+		tier = EffectiveTier(user, now)
+		// Drop to FREE right when the subscription runs out
+		if user.SubscriptionExpires != nil && tier != Free && user.SubscriptionExpires.Before(expires) {
+			expires = *user.SubscriptionExpires
+		}
+	case errors.Is(err, store.ErrNotFound), errors.Is(err, store.ErrRequiresDatabase):
+	default:
+		// Not cached, so the next request tries again
+		log.Printf("Warning: Failed looking up tier of user %s: %v", userId, err)
+		return tier
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.cache) > 10000 {
+		r.prune(now)
+	}
+	r.cache[userId] = cachedTier{tier: tier, expires: expires}
+	return tier
+}
+
+// Drop expired entries
+func (r *Resolver) prune(now time.Time) {
+	for userId, cached := range r.cache {
+		if !now.Before(cached.expires) {
+			delete(r.cache, userId)
+		}
+	}
+}
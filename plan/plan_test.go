@@ -0,0 +1,67 @@
+package plan
+
+import (
+	"testing"
+	"time"
+	"url-shortener/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolverTier(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	memoryStore.SaveUser(store.User{Id: "pro-user", SubscriptionTier: Pro})
+	memoryStore.SaveUser(store.User{Id: "odd-user", SubscriptionTier: "PLATINUM"})
+	resolver := NewResolver(memoryStore, time.Minute)
+
+	assert.Equal(t, Pro, resolver.Tier("pro-user"))
+	assert.Equal(t, Free, resolver.Tier("odd-user"))
+	assert.Equal(t, Free, resolver.Tier("missing-user"))
+	assert.Equal(t, Free, resolver.Tier("guest-user"))
+
+	// Tiers are cached
+	memoryStore.SaveUser(store.User{Id: "pro-user", SubscriptionTier: Enterprise})
+	assert.Equal(t, Pro, resolver.Tier("pro-user"))
+	assert.Equal(t, Enterprise, NewResolver(memoryStore, time.Minute).Tier("pro-user"))
+}
+
+func TestLimitsFor(t *testing.T) {
+	assert.Equal(t, tiers[Free], LimitsFor(""))
+	assert.Greater(t, LimitsFor(Pro).CreatesPerMinute, LimitsFor(Free).CreatesPerMinute)
+	assert.Greater(t, LimitsFor(Enterprise).RedirectsPerMinute, LimitsFor(Pro).RedirectsPerMinute)
+}
+
+func TestEffectiveTier(t *testing.T) {
+	now := time.Now()
+	later, earlier := now.Add(time.Hour), now.Add(-time.Hour)
+
+	assert.Equal(t, Pro, EffectiveTier(store.User{SubscriptionTier: Pro}, now))
+	assert.Equal(t, Pro, EffectiveTier(store.User{SubscriptionTier: Pro, SubscriptionExpires: &later}, now))
+	assert.Equal(t, Free, EffectiveTier(store.User{SubscriptionTier: Pro, SubscriptionExpires: &earlier}, now))
+	assert.Equal(t, Free, EffectiveTier(store.User{SubscriptionTier: ""}, now))
+}
+
+func TestResolverDropsLapsedSubscription(t *testing.T) {
+	memoryStore := store.NewMemoryStore()
+	expires := time.Now().Add(50 * time.Millisecond)
+	memoryStore.SaveUser(store.User{Id: "pro-user", SubscriptionTier: Pro, SubscriptionExpires: &expires})
+	resolver := NewResolver(memoryStore, time.Hour)
+
+	assert.Equal(t, Pro, resolver.Tier("pro-user"))
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, Free, resolver.Tier("pro-user"))
+}
+
+func TestCheckUsage(t *testing.T) {
+	limits := LimitsFor(Free)
+	full := store.LinkUsage{LinksCreated: int64(limits.LinksPerMonth)}
+	assert.Error(t, CheckUsage(Free, full, store.Link{}))
+	assert.NoError(t, CheckUsage(Enterprise, full, store.Link{}))
+
+	aliases := store.LinkUsage{CustomAliases: int64(limits.CustomAliases)}
+	assert.NoError(t, CheckUsage(Free, aliases, store.Link{}))
+	err := CheckUsage(Free, aliases, store.Link{CustomAlias: true})
+	var quotaErr *QuotaError
+	assert.ErrorAs(t, err, &quotaErr)
+	assert.Equal(t, "custom_aliases", quotaErr.Quota)
+}
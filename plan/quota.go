@@ -0,0 +1,82 @@
+package plan
+
+import (
+	"fmt"
+	"time"
+	"url-shortener/store"
+)
+
+// QuotaError reports a quota the user has used up
+type QuotaError struct {
+	Quota string // links_per_month or custom_aliases
+	Limit int
+	Used  int64
+	Tier  string
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s quota of the %s plan reached (%d of %d used)", e.Quota, e.Tier, e.Used, e.Limit)
+}
+
+// FeatureError reports a feature the user's tier does not include
+type FeatureError struct {
+	Feature string // expiry or password
+	Tier    string
+}
+
+func (e *FeatureError) Error() string {
+	return fmt.Sprintf("%s is not available on the %s plan", e.Feature, e.Tier)
+}
+
+// RetentionError reports analytics requested from before the retention
+// period of the user's tier
+type RetentionError struct {
+	Oldest time.Time
+	Days   int
+	Tier   string
+}
+
+func (e *RetentionError) Error() string {
+	return fmt.Sprintf("the %s plan keeps analytics for %d days, from must not be before %s",
+		e.Tier, e.Days, e.Oldest.Format(time.RFC3339))
+}
+
+// CheckFeatures reports the first setting of a new link that the tier does
+// not include
+func CheckFeatures(tier string, link store.Link) error {
+	limits := LimitsFor(tier)
+	if link.IsProtected() && !limits.Password {
+		return &FeatureError{Feature: "password", Tier: tier}
+	}
+	if link.ExpiresAt != nil && !limits.Expiry {
+		return &FeatureError{Feature: "expiry", Tier: tier}
+	}
+	return nil
+}
+
+// CheckUsage reports a quota that creating the link would exceed
+func CheckUsage(tier string, usage store.LinkUsage, link store.Link) error {
+	limits := LimitsFor(tier)
+	if exceeds(limits.LinksPerMonth, usage.LinksCreated) {
+		return &QuotaError{Quota: "links_per_month", Limit: limits.LinksPerMonth, Used: usage.LinksCreated, Tier: tier}
+	}
+	if link.CustomAlias && exceeds(limits.CustomAliases, usage.CustomAliases) {
+		return &QuotaError{Quota: "custom_aliases", Limit: limits.CustomAliases, Used: usage.CustomAliases, Tier: tier}
+	}
+	return nil
+}
+
+func exceeds(limit int, used int64) bool {
+	return limit != Unlimited && used >= int64(limit)
+}
+
+// CheckRetention reports analytics requested from before the tier's
+// retention period
+func CheckRetention(tier string, from time.Time, now time.Time) error {
+	limits := LimitsFor(tier)
+	oldest := now.Add(-limits.AnalyticsRetention())
+	if from.Before(oldest) {
+		return &RetentionError{Oldest: oldest, Days: limits.AnalyticsRetentionDays, Tier: tier}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package qr
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Memory rendered codes may take up by default
+const DefaultCacheBytes = 32 << 20
+
+type cacheEntry struct {
+	key   string
+	image []byte
+}
+
+// Cache keeps recently rendered codes, dropping the least recently used
+// ones once they take up more than the configured number of bytes. A short
+// link's code never changes, so entries need no expiry.
+type Cache struct {
+	maxBytes int
+
+	mu      sync.Mutex
+	bytes   int
+	order   *list.List // Most recently used first
+	entries map[string]*list.Element
+}
+
+func NewCache(maxBytes int) *Cache {
+	return &Cache{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// Render returns the cached code for content and options, rendering and
+// caching it when there is none. A nil Cache always renders.
+func (c *Cache) Render(content string, options Options) ([]byte, error) {
+	if c == nil {
+		return Render(content, options)
+	}
+	key := options.Key(content)
+
+	c.mu.Lock()
+	if element, ok := c.entries[key]; ok {
+		c.order.MoveToFront(element)
+		c.mu.Unlock()
+		return element.Value.(*cacheEntry).image, nil
+	}
+	c.mu.Unlock()
+
+	// Rendered outside the lock; concurrent misses for one key render twice
+	image, err := Render(content, options)
+	if err != nil {
+		return nil, err
+	}
+	c.add(key, image)
+	return image, nil
+}
+
+func (c *Cache) add(key string, image []byte) {
+	if len(image) > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; ok {
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, image: image})
+	c.bytes += len(image)
+	for c.bytes > c.maxBytes {
+		oldest := c.order.Back()
+		entry := c.order.Remove(oldest).(*cacheEntry)
+		delete(c.entries, entry.key)
+		c.bytes -= len(entry.image)
+	}
+}
+
+// Len is the number of cached codes
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
@@ -0,0 +1,275 @@
+package qr
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/url"
+	"strconv"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// Output formats
+const (
+	PNG = "png"
+	SVG = "svg"
+)
+
+const (
+	DefaultSize   = 256
+	MinSize       = 64
+	MaxSize       = 2048
+	DefaultMargin = 4 // The quiet zone the QR specification asks for
+	MaxMargin     = 16
+)
+
+// Error-correction levels by name: the share of the code that can be
+// damaged and still read
+var levels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,     // 7%
+	"M": qrcode.Medium,  // 15%
+	"Q": qrcode.High,    // 25%
+	"H": qrcode.Highest, // 30%
+}
+
+// Options of a rendered code. Use Request.Options to get valid ones.
+type Options struct {
+	Format     string
+	Size       int // Width and height in pixels
+	Level      string
+	Margin     int // Quiet zone in modules
+	Foreground color.RGBA
+	Background color.RGBA
+}
+
+// Request is how clients ask for a code, as query parameters of the QR
+// endpoint or as the qr field of a create request. Empty fields take the
+// defaults.
+type Request struct {
+	Format     string `json:"format"`
+	Size       int    `json:"size"`
+	Level      string `json:"level"`
+	Margin     *int   `json:"margin"`
+	Foreground string `json:"fg"`
+	Background string `json:"bg"`
+}
+
+// UnmarshalJSON also accepts true, which asks for a code with the defaults
+func (r *Request) UnmarshalJSON(data []byte) error {
+	if string(data) == "true" {
+		*r = Request{}
+		return nil
+	}
+	type plain Request
+	return json.Unmarshal(data, (*plain)(r))
+}
+
+// RequestFromQuery reads a request from query parameters. On failure the
+// offending parameter is returned with the error.
+func RequestFromQuery(query url.Values) (Request, string, error) {
+	request := Request{
+		Format:     query.Get("format"),
+		Level:      query.Get("level"),
+		Foreground: query.Get("fg"),
+		Background: query.Get("bg"),
+	}
+	if value := query.Get("size"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil {
+			return request, "size", errors.New("size must be a number of pixels")
+		}
+		request.Size = size
+	}
+	if value := query.Get("margin"); value != "" {
+		margin, err := strconv.Atoi(value)
+		if err != nil {
+			return request, "margin", errors.New("margin must be a number of modules")
+		}
+		request.Margin = &margin
+	}
+	return request, "", nil
+}
+
+// Options validates a request and fills in the defaults. On failure the
+// offending field is returned with the error.
+func (r Request) Options() (Options, string, error) {
+	options := Options{
+		Format:     PNG,
+		Size:       DefaultSize,
+		Level:      "M",
+		Margin:     DefaultMargin,
+		Foreground: color.RGBA{A: 0xff},
+		Background: color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+	}
+
+	switch format := strings.ToLower(r.Format); format {
+	case "":
+	case PNG, SVG:
+		options.Format = format
+	default:
+		return options, "format", errors.New("format must be png or svg")
+	}
+	if r.Size != 0 {
+		if r.Size < MinSize || r.Size > MaxSize {
+			return options, "size", fmt.Errorf("size must be between %d and %d pixels", MinSize, MaxSize)
+		}
+		options.Size = r.Size
+	}
+	if r.Level != "" {
+		level := strings.ToUpper(r.Level)
+		if _, ok := levels[level]; !ok {
+			return options, "level", errors.New("level must be L, M, Q or H")
+		}
+		options.Level = level
+	}
+	if r.Margin != nil {
+		if *r.Margin < 0 || *r.Margin > MaxMargin {
+			return options, "margin", fmt.Errorf("margin must be between 0 and %d modules", MaxMargin)
+		}
+		options.Margin = *r.Margin
+	}
+
+	var err error
+	if r.Foreground != "" {
+		if options.Foreground, err = parseColor(r.Foreground); err != nil {
+			return options, "fg", err
+		}
+	}
+	if r.Background != "" {
+		if options.Background, err = parseColor(r.Background); err != nil {
+			return options, "bg", err
+		}
+	}
+	if options.Foreground == options.Background {
+		return options, "fg", errors.New("fg and bg must differ")
+	}
+	return options, "", nil
+}
+
+// Parse a hex color: RGB or RRGGBB, with or without the leading #
+func parseColor(value string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(value, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	n, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 6 || err != nil {
+		return color.RGBA{}, fmt.Errorf("%q is not a hex color such as 1a2b3c", value)
+	}
+	return color.RGBA{R: uint8(n >> 16), G: uint8(n >> 8), B: uint8(n), A: 0xff}, nil
+}
+
+// Key identifies a rendered code in caches
+func (o Options) Key(content string) string {
+	return fmt.Sprintf("%s|%d|%s|%d|%s|%s|%s", o.Format, o.Size, o.Level, o.Margin,
+		hexColor(o.Foreground), hexColor(o.Background), content)
+}
+
+// Query parameters that ask for a code with these options
+func (o Options) Query() url.Values {
+	return url.Values{
+		"format": {o.Format},
+		"size":   {strconv.Itoa(o.Size)},
+		"level":  {o.Level},
+		"margin": {strconv.Itoa(o.Margin)},
+		"fg":     {strings.TrimPrefix(hexColor(o.Foreground), "#")},
+		"bg":     {strings.TrimPrefix(hexColor(o.Background), "#")},
+	}
+}
+
+// ContentType of the rendered code
+func (o Options) ContentType() string {
+	if o.Format == SVG {
+		return "image/svg+xml"
+	}
+	return "image/png"
+}
+
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// ErrTooSmall is returned when a code has more modules than the image has
+// pixels
+var ErrTooSmall = errors.New("size is too small for this code, use a larger size or margin 0")
+
+// Render encodes content as a QR code image
+func Render(content string, options Options) ([]byte, error) {
+	code, err := qrcode.New(content, levels[options.Level])
+	if err != nil {
+		return nil, err
+	}
+	code.DisableBorder = true
+	modules := code.Bitmap()
+
+	if options.Format == SVG {
+		return renderSVG(modules, options), nil
+	}
+	return renderPNG(modules, options)
+}
+
+// Scale the modules to whole pixels and center them; the remainder goes to
+// the margin
+func renderPNG(modules [][]bool, options Options) ([]byte, error) {
+	total := len(modules) + 2*options.Margin
+	scale := options.Size / total
+	if scale < 1 {
+		return nil, ErrTooSmall
+	}
+	offset := (options.Size-total*scale)/2 + options.Margin*scale
+
+	palette := color.Palette{options.Background, options.Foreground}
+	img := image.NewPaletted(image.Rect(0, 0, options.Size, options.Size), palette)
+	for y, row := range modules {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			for py := offset + y*scale; py < offset+(y+1)*scale; py++ {
+				for px := offset + x*scale; px < offset+(x+1)*scale; px++ {
+					img.SetColorIndex(px, py, 1)
+				}
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(&out, img); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// One path in module units, a horizontal run of dark modules per segment.
+// Vectors scale freely, so the size only sets the nominal dimensions.
+func renderSVG(modules [][]bool, options Options) []byte {
+	total := len(modules) + 2*options.Margin
+	var path strings.Builder
+	for y, row := range modules {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			fmt.Fprintf(&path, "M%d %dh%dv1h-%dz", start+options.Margin, y+options.Margin, x-start, x-start)
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(&out, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		options.Size, options.Size, total, total)
+	fmt.Fprintf(&out, `<rect width="%d" height="%d" fill="%s"/>`, total, total, hexColor(options.Background))
+	fmt.Fprintf(&out, `<path d="%s" fill="%s"/></svg>`+"\n", path.String(), hexColor(options.Foreground))
+	return out.Bytes()
+}
@@ -0,0 +1,122 @@
+package qr
+
+import (
+	"bytes"
+	"encoding/json"
+	"image/color"
+	"image/png"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestOptions(t *testing.T) {
+	options, _, err := Request{}.Options()
+	assert.NoError(t, err)
+	assert.Equal(t, PNG, options.Format)
+	assert.Equal(t, DefaultSize, options.Size)
+	assert.Equal(t, "M", options.Level)
+	assert.Equal(t, DefaultMargin, options.Margin)
+
+	request, _, err := RequestFromQuery(url.Values{"format": {"SVG"}, "size": {"512"}, "level": {"h"}, "margin": {"0"}, "fg": {"#0a0"}, "bg": {"ffeedd"}})
+	assert.NoError(t, err)
+	options, _, err = request.Options()
+	assert.NoError(t, err)
+	assert.Equal(t, Options{
+		Format:     SVG,
+		Size:       512,
+		Level:      "H",
+		Margin:     0,
+		Foreground: color.RGBA{G: 0xaa, A: 0xff},
+		Background: color.RGBA{R: 0xff, G: 0xee, B: 0xdd, A: 0xff},
+	}, options)
+
+	for field, query := range map[string]url.Values{
+		"format": {"format": {"gif"}},
+		"size":   {"size": {"10000"}},
+		"level":  {"level": {"X"}},
+		"margin": {"margin": {"-1"}},
+		"fg":     {"fg": {"black"}},
+		"bg":     {"fg": {"fff"}, "bg": {"#FFFFFF"}},
+	} {
+		request, badField, err := RequestFromQuery(query)
+		if err == nil {
+			_, badField, err = request.Options()
+		}
+		assert.Error(t, err, field)
+		if field == "bg" {
+			field = "fg" // Equal colors are reported on fg
+		}
+		assert.Equal(t, field, badField)
+	}
+
+	var fromJSON struct {
+		QR *Request `json:"qr"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(`{"qr": true}`), &fromJSON))
+	assert.Equal(t, &Request{}, fromJSON.QR)
+	assert.NoError(t, json.Unmarshal([]byte(`{"qr": {"format": "svg", "margin": 2}}`), &fromJSON))
+	assert.Equal(t, SVG, fromJSON.QR.Format)
+	assert.Equal(t, 2, *fromJSON.QR.Margin)
+}
+
+func TestRender(t *testing.T) {
+	options, _, _ := Request{Size: 300, Foreground: "123456"}.Options()
+	image, err := Render("https://short.test/abc123", options)
+	assert.NoError(t, err)
+
+	decoded, err := png.Decode(bytes.NewReader(image))
+	assert.NoError(t, err)
+	assert.Equal(t, 300, decoded.Bounds().Dx())
+	assert.Equal(t, 300, decoded.Bounds().Dy())
+	// 33 modules of 9 pixels: the finder pattern starts after the 4 module
+	// margin and 1 pixel left over
+	white := color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	assert.Equal(t, white, color.RGBAModel.Convert(decoded.At(0, 0)))
+	assert.Equal(t, white, color.RGBAModel.Convert(decoded.At(36, 36)))
+	assert.Equal(t, color.RGBA{R: 0x12, G: 0x34, B: 0x56, A: 0xff}, color.RGBAModel.Convert(decoded.At(37, 37)))
+
+	options.Format = SVG
+	image, err = Render("https://short.test/abc123", options)
+	assert.NoError(t, err)
+	svg := string(image)
+	assert.True(t, strings.Contains(svg, `width="300"`))
+	assert.True(t, strings.Contains(svg, `fill="#123456"`))
+	// 25 modules (version 2) plus the margin on both sides
+	assert.True(t, strings.Contains(svg, `viewBox="0 0 33 33"`))
+
+	options, _, _ = Request{Format: PNG, Size: MinSize, Level: "H"}.Options()
+	_, err = Render("https://short.test/"+strings.Repeat("x", 300), options)
+	assert.ErrorIs(t, err, ErrTooSmall)
+}
+
+func TestCache(t *testing.T) {
+	options, _, _ := Request{}.Options()
+	first, err := Render("https://short.test/a", options)
+	assert.NoError(t, err)
+
+	// Room for two codes
+	cache := NewCache(2*len(first) + len(first)/2)
+	cached, err := cache.Render("https://short.test/a", options)
+	assert.NoError(t, err)
+	assert.Equal(t, first, cached)
+	_, _ = cache.Render("https://short.test/b", options)
+	_, _ = cache.Render("https://short.test/a", options)
+	_, _ = cache.Render("https://short.test/c", options)
+	assert.Equal(t, 2, cache.Len())
+
+	// b was the least recently used
+	cache.mu.Lock()
+	_, hasA := cache.entries[options.Key("https://short.test/a")]
+	_, hasB := cache.entries[options.Key("https://short.test/b")]
+	cache.mu.Unlock()
+	assert.True(t, hasA)
+	assert.False(t, hasB)
+
+	var none *Cache
+	image, err := none.Render("https://short.test/a", options)
+	assert.NoError(t, err)
+	assert.Equal(t, first, image)
+}
@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+	"url-shortener/auth"
+	"url-shortener/plan"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Action is a rate limited kind of request with a per-minute limit that
+// depends on the client's subscription tier
+type Action struct {
+	Name      string
+	PerMinute func(limits plan.Limits) int
+}
+
+var (
+	Create = Action{
+		Name:      "create",
+		PerMinute: func(limits plan.Limits) int { return limits.CreatesPerMinute },
+	}
+	Redirect = Action{
+		Name:      "redirect",
+		PerMinute: func(limits plan.Limits) int { return limits.RedirectsPerMinute },
+	}
+)
+
+// Who a request is counted against: its API key, its user, or else its IP
+// address
+func clientKey(c *gin.Context) (key string, userId string) {
+	user, ok := auth.CurrentUser(c)
+	switch {
+	case ok && user.APIKeyId != "":
+		return "key:" + user.APIKeyId, user.Id
+	case ok:
+		return "user:" + user.Id, user.Id
+	default:
+		return "ip:" + c.ClientIP(), ""
+	}
+}
+
+// Middleware limits an action per client. It must run after the
+// authentication middleware. Requests are let through if the limiter fails.
+func Middleware(limiter Limiter, tiers *plan.Resolver, action Action) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, userId := clientKey(c)
+		limit := Limit{
+			Requests: action.PerMinute(plan.LimitsFor(tiers.Tier(userId))),
+			Window:   time.Minute,
+		}
+
+		result, err := limiter.Allow(action.Name+":"+key, limit, time.Now())
+		if err != nil {
+			log.Printf("Error checking rate limit: %v", err)
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Requests, int(limit.Window.Seconds())))
+		c.Header("RateLimit-Limit", fmt.Sprint(result.Limit))
+		c.Header("RateLimit-Remaining", fmt.Sprint(result.Remaining))
+		c.Header("RateLimit-Reset", fmt.Sprint(ceilSeconds(result.Reset)))
+		if !result.Allowed {
+			c.Header("Retry-After", fmt.Sprint(ceilSeconds(result.Reset)))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error":       "Rate limit exceeded, please try again later",
+				"retry_after": ceilSeconds(result.Reset),
+			})
+			return
+		}
+		c.Next()
+	}
+}
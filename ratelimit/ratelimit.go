@@ -0,0 +1,203 @@
+package ratelimit
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// Limit allows Requests per sliding Window
+type Limit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// Result of counting one request against a limit
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Until the oldest counted request leaves the window, which frees a slot
+	Reset time.Duration
+}
+
+// Limiter counts requests per key in a sliding window
+type Limiter interface {
+	Allow(key string, limit Limit, now time.Time) (Result, error)
+}
+
+// Sliding window log in a sorted set scored by request time in ms. Members
+// are only added while under the limit, so rejected requests do not extend
+// a client's lockout.
+var slidingWindowScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - window)
+local count = redis.call("ZCARD", KEYS[1])
+local allowed = 0
+if count < limit then
+	redis.call("ZADD", KEYS[1], now, ARGV[4])
+	redis.call("PEXPIRE", KEYS[1], window)
+	count = count + 1
+	allowed = 1
+end
+local oldest = redis.call("ZRANGE", KEYS[1], 0, 0, "WITHSCORES")
+local reset = window
+if oldest[2] then
+	reset = tonumber(oldest[2]) + window - now
+end
+return {allowed, count, reset}
+`)
+
+// RedisLimiter shares counts between all instances using the same Redis
+type RedisLimiter struct {
+	client   *redis.Client
+	sequence atomic.Uint64
+}
+
+func NewRedisLimiter(client *redis.Client) *RedisLimiter {
+	return &RedisLimiter{client: client}
+}
+
+func (l *RedisLimiter) Allow(key string, limit Limit, now time.Time) (Result, error) {
+	nowMs := now.UnixMilli()
+	member := fmt.Sprintf("%d-%d", now.UnixNano(), l.sequence.Add(1))
+	values, err := slidingWindowScript.Run(l.client, []string{"ratelimit:" + key},
+		nowMs, limit.Window.Milliseconds(), limit.Requests, member).Result()
+	if err != nil {
+		return Result{}, err
+	}
+
+	reply, ok := values.([]interface{})
+	if !ok || len(reply) != 3 {
+		return Result{}, fmt.Errorf("unexpected rate limit reply: %v", values)
+	}
+	allowed, _ := reply[0].(int64)
+	count, _ := reply[1].(int64)
+	reset, _ := reply[2].(int64)
+	return Result{
+		Allowed:   allowed == 1,
+		Limit:     limit.Requests,
+		Remaining: max(limit.Requests-int(count), 0),
+		Reset:     time.Duration(reset) * time.Millisecond,
+	}, nil
+}
+
+// MemoryLimiter counts requests in process memory. Each instance counts on
+// its own, so it is only exact with a single instance.
+type MemoryLimiter struct {
+	mu       sync.Mutex
+	requests map[string][]time.Time
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{requests: make(map[string][]time.Time)}
+}
+
+func (l *MemoryLimiter) Allow(key string, limit Limit, now time.Time) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.requests) > 10000 {
+		l.prune(now, limit.Window)
+	}
+
+	// Drop the requests that left the window
+	times := l.requests[key]
+	start := now.Add(-limit.Window)
+	kept := 0
+	for kept < len(times) && !times[kept].After(start) {
+		kept++
+	}
+	times = times[kept:]
+
+	allowed := len(times) < limit.Requests
+	if allowed {
+		times = append(times, now)
+	}
+	if len(times) == 0 {
+		delete(l.requests, key)
+	} else {
+		l.requests[key] = times
+	}
+
+	reset := limit.Window
+	if len(times) > 0 {
+		reset = times[0].Add(limit.Window).Sub(now)
+	}
+	return Result{
+		Allowed:   allowed,
+		Limit:     limit.Requests,
+		Remaining: max(limit.Requests-len(times), 0),
+		Reset:     reset,
+	}, nil
+}
+
+// Forget clients whose requests all left the window
+func (l *MemoryLimiter) prune(now time.Time, window time.Duration) {
+	for key, times := range l.requests {
+		if len(times) == 0 || !times[len(times)-1].After(now.Add(-window)) {
+			delete(l.requests, key)
+		}
+	}
+}
+
+// How long the fallback is used before the primary limiter is tried again
+const RetryInterval = 10 * time.Second
+
+// FallbackLimiter uses the primary limiter and switches to the fallback when
+// it fails, e.g. while Redis is down. The primary is retried every
+// RetryInterval rather than on every request, so requests do not wait for
+// connection timeouts.
+type FallbackLimiter struct {
+	primary  Limiter
+	fallback Limiter
+
+	mu      sync.Mutex
+	retryAt time.Time // Zero while the primary works
+}
+
+func WithFallback(primary Limiter, fallback Limiter) *FallbackLimiter {
+	return &FallbackLimiter{primary: primary, fallback: fallback}
+}
+
+func (l *FallbackLimiter) Allow(key string, limit Limit, now time.Time) (Result, error) {
+	l.mu.Lock()
+	failing := !l.retryAt.IsZero()
+	skipPrimary := failing && now.Before(l.retryAt)
+	l.mu.Unlock()
+	if skipPrimary {
+		return l.fallback.Allow(key, limit, now)
+	}
+
+	result, err := l.primary.Allow(key, limit, now)
+
+	l.mu.Lock()
+	if err == nil {
+		l.retryAt = time.Time{}
+	} else {
+		l.retryAt = now.Add(RetryInterval)
+	}
+	l.mu.Unlock()
+
+	switch {
+	case err == nil && failing:
+		log.Println("Rate limiter recovered, counting in Redis again")
+	case err != nil && !failing:
+		log.Printf("Warning: Rate limiter failed, counting in memory: %v", err)
+	}
+	if err != nil {
+		return l.fallback.Allow(key, limit, now)
+	}
+	return result, nil
+}
+
+// Whole seconds for headers, rounded up so clients never retry too early
+func ceilSeconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,127 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"url-shortener/auth"
+	"url-shortener/plan"
+	"url-shortener/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryLimiterSlidingWindow(t *testing.T) {
+	limiter := NewMemoryLimiter()
+	limit := Limit{Requests: 3, Window: time.Minute}
+	start := time.Now()
+
+	for i := 0; i < 3; i++ {
+		result, _ := limiter.Allow("client", limit, start.Add(time.Duration(i)*10*time.Second))
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 2-i, result.Remaining)
+	}
+
+	result, _ := limiter.Allow("client", limit, start.Add(30*time.Second))
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+	assert.Equal(t, 30*time.Second, result.Reset)
+
+	// Other clients are counted separately
+	result, _ = limiter.Allow("other", limit, start.Add(30*time.Second))
+	assert.True(t, result.Allowed)
+
+	// The first request leaves the window after a minute, freeing one slot
+	result, _ = limiter.Allow("client", limit, start.Add(61*time.Second))
+	assert.True(t, result.Allowed)
+	result, _ = limiter.Allow("client", limit, start.Add(62*time.Second))
+	assert.False(t, result.Allowed)
+}
+
+func TestFallbackWhenRedisIsDown(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: 0})
+	defer client.Close()
+	limiter := WithFallback(NewRedisLimiter(client), NewMemoryLimiter())
+	limit := Limit{Requests: 1, Window: time.Minute}
+
+	result, err := limiter.Allow("client", limit, time.Now())
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	result, err = limiter.Allow("client", limit, time.Now())
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+}
+
+func TestMiddlewareFollowsTier(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	memoryStore := store.NewMemoryStore()
+	memoryStore.SaveUser(store.User{Id: "pro-user", SubscriptionTier: plan.Pro})
+	memoryStore.SaveSession("pro-session", store.Session{UserId: "pro-user", Expires: time.Now().Add(time.Hour)})
+
+	r := gin.New()
+	r.Use(auth.APIKeys(memoryStore), auth.Sessions(memoryStore))
+	r.POST("/create", Middleware(NewMemoryLimiter(), plan.NewResolver(memoryStore, time.Minute), Create), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	create := func(session string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/create", nil)
+		if session != "" {
+			req.Header.Set(auth.SessionHeader, session)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	freeLimit := plan.LimitsFor(plan.Free).CreatesPerMinute
+	for i := 0; i < freeLimit; i++ {
+		assert.Equal(t, http.StatusOK, create("").Code)
+	}
+	w := create("")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	// The signed-in PRO user has their own, larger allowance
+	w = create("pro-session")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "60", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "59", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "60;w=60", w.Header().Get("RateLimit-Policy"))
+}
+
+func TestMiddlewareIgnoresForwardedForFromUntrustedPeers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	memoryStore := store.NewMemoryStore()
+
+	r := gin.New()
+	assert.NoError(t, r.SetTrustedProxies([]string{"10.0.0.0/8"}))
+	r.POST("/create", Middleware(NewMemoryLimiter(), plan.NewResolver(memoryStore, time.Minute), Create), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	create := func(peer string, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodPost, "/create", nil)
+		req.RemoteAddr = peer + ":40000"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// A client talking to us directly cannot pose as someone new each time
+	freeLimit := plan.LimitsFor(plan.Free).CreatesPerMinute
+	for i := 0; i < freeLimit; i++ {
+		assert.Equal(t, http.StatusOK, create("203.0.113.7", fmt.Sprintf("198.51.100.%d", i)))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, create("203.0.113.7", "198.51.100.250"))
+
+	// Behind the trusted proxy every client has a limit of its own
+	assert.Equal(t, http.StatusOK, create("10.1.2.3", "198.51.100.1"))
+	assert.Equal(t, http.StatusOK, create("10.1.2.3", "198.51.100.2"))
+}
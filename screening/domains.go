@@ -0,0 +1,92 @@
+package screening
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// DomainList matches host names against a set of domains, subdomains
+// included. Domains come from configuration and optionally from a file that
+// is reloaded when it changes.
+type DomainList struct {
+	static map[string]bool
+	file   *watchedFile
+
+	mu       sync.RWMutex
+	fromFile map[string]bool
+}
+
+// NewDomainList holds the given domains. Internationalized domains must be
+// given in their punycode form.
+func NewDomainList(domains []string) *DomainList {
+	list := &DomainList{static: make(map[string]bool)}
+	for _, domain := range domains {
+		if domain = normalizeDomain(domain); domain != "" {
+			list.static[domain] = true
+		}
+	}
+	return list
+}
+
+// LoadFile adds the domains listed in a file, one per line. Blank lines and
+// lines starting with # are skipped. Reload and Watch reread the file.
+func (l *DomainList) LoadFile(path string) error {
+	l.file = newWatchedFile(path, "domain list", l.parse)
+	return l.file.Reload()
+}
+
+func (l *DomainList) parse(data []byte) (string, error) {
+	domains := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.ContainsAny(line, " \t/") {
+			return "", fmt.Errorf("invalid domain %q", line)
+		}
+		domains[normalizeDomain(line)] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	l.mu.Lock()
+	l.fromFile = domains
+	l.mu.Unlock()
+	return fmt.Sprintf("%d domains", len(domains)), nil
+}
+
+// Reload the file given to LoadFile. On failure the previous domains stay
+// in use.
+func (l *DomainList) Reload() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	return l.file.Reload()
+}
+
+// Contains reports whether host is one of the domains or a subdomain of one
+func (l *DomainList) Contains(host string) bool {
+	if l == nil {
+		return false
+	}
+	host = normalizeDomain(host)
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for {
+		if l.static[host] || l.fromFile[host] {
+			return true
+		}
+		dot := strings.IndexByte(host, '.')
+		if dot < 0 {
+			return false
+		}
+		host = host[dot+1:]
+	}
+}
@@ -0,0 +1,118 @@
+package screening
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/idna"
+)
+
+// Domains commonly imitated by phishing links. Hosts that look like one of
+// these without being it are blocked.
+var DefaultProtectedDomains = []string{
+	"amazon.com",
+	"apple.com",
+	"facebook.com",
+	"github.com",
+	"google.com",
+	"instagram.com",
+	"microsoft.com",
+	"netflix.com",
+	"paypal.com",
+}
+
+// Characters that render (nearly) like a Latin letter or a digit that
+// stands in for one. Based on the Unicode confusables data for the scripts
+// most used in IDN spoofing.
+var confusables = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'с': 'c', 'ԁ': 'd', 'е': 'e', 'һ': 'h', 'і': 'i',
+	'ј': 'j', 'к': 'k', 'ӏ': 'l', 'м': 'm', 'п': 'n', 'о': 'o', 'р': 'p',
+	'ԛ': 'q', 'г': 'r', 'ѕ': 's', 'т': 't', 'ц': 'u', 'ѵ': 'v', 'ԝ': 'w',
+	'х': 'x', 'у': 'y', 'ү': 'y',
+	// Greek
+	'α': 'a', 'β': 'b', 'ϲ': 'c', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k',
+	'ν': 'v', 'ο': 'o', 'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x', 'γ': 'y',
+	// Latin look-alikes outside ASCII
+	'ı': 'i', 'ɩ': 'i', 'ł': 'l', 'ɡ': 'g', 'ö': 'o', 'ó': 'o', 'ò': 'o',
+	'á': 'a', 'à': 'a', 'ä': 'a', 'é': 'e', 'è': 'e', 'í': 'i', 'ú': 'u',
+	// Digits standing in for letters
+	'0': 'o', '1': 'l',
+}
+
+// Scripts a label may not mix
+var scripts = []*unicode.RangeTable{unicode.Latin, unicode.Cyrillic, unicode.Greek, unicode.Armenian, unicode.Han, unicode.Arabic, unicode.Hebrew}
+
+// Flag hosts that imitate a protected domain, or whose labels are spelled
+// in a way only used to deceive: mixed scripts, or a foreign script made
+// only of letters that look Latin.
+func checkLookalike(host string, protected []string) Verdict {
+	unicodeHost, err := idna.Punycode.ToUnicode(host)
+	if err != nil {
+		unicodeHost = host
+	}
+
+	skeleton := skeletonOf(unicodeHost)
+	for _, domain := range protected {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			continue
+		}
+		if skeleton == domain || strings.HasSuffix(skeleton, "."+domain) {
+			return Verdict{Action: Block, Reason: "host name imitates " + domain}
+		}
+	}
+
+	for _, label := range strings.Split(unicodeHost, ".") {
+		used := labelScripts(label)
+		if len(used) > 1 {
+			return Verdict{Action: Quarantine, Reason: "host name mixes scripts"}
+		}
+		if len(used) == 1 && used[0] != unicode.Latin && isASCII(skeletonOf(label)) {
+			return Verdict{Action: Quarantine, Reason: "host name is spelled with look-alike characters"}
+		}
+	}
+	return allowed()
+}
+
+// Map every confusable character to the ASCII one it imitates
+func skeletonOf(s string) string {
+	return strings.Map(func(r rune) rune {
+		if ascii, ok := confusables[r]; ok {
+			return ascii
+		}
+		return r
+	}, strings.ToLower(s))
+}
+
+// The scripts of the letters in a label
+func labelScripts(label string) []*unicode.RangeTable {
+	var used []*unicode.RangeTable
+	for _, r := range label {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		for _, script := range scripts {
+			if !unicode.Is(script, r) {
+				continue
+			}
+			found := false
+			for _, seen := range used {
+				found = found || seen == script
+			}
+			if !found {
+				used = append(used, script)
+			}
+			break
+		}
+	}
+	return used
+}
+
+func isASCII(s string) bool {
+	for _, r := range s {
+		if r > unicode.MaxASCII {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,130 @@
+package screening
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Action is what happens to a link whose destination was screened
+type Action int
+
+const (
+	// The destination looks fine
+	Allow Action = iota
+	// The link is saved but does not redirect until a moderator releases it
+	Quarantine
+	// The link is refused, or stops resolving if it already exists
+	Block
+)
+
+func (a Action) String() string {
+	switch a {
+	case Quarantine:
+		return "quarantine"
+	case Block:
+		return "block"
+	default:
+		return "allow"
+	}
+}
+
+// Verdict of screening one destination
+type Verdict struct {
+	Action Action
+	// Why the destination was not allowed, empty when it was
+	Reason string
+}
+
+func allowed() Verdict {
+	return Verdict{Action: Allow}
+}
+
+// Config of a Screener. Every part is optional.
+type Config struct {
+	// Domains whose links are blocked, subdomains included
+	Deny *DomainList
+	// Domains that are never blocked by the deny list or the lookalike
+	// checks. The threat list still applies to them.
+	Allow *DomainList
+	// Hash prefixes of known malicious URLs
+	Threats *ThreatList
+	// Well-known domains that lookalike hosts are compared against. nil
+	// means DefaultProtectedDomains.
+	Protected []string
+}
+
+// Screener decides whether links may point at a destination. A nil
+// Screener allows everything.
+type Screener struct {
+	deny      *DomainList
+	allow     *DomainList
+	threats   *ThreatList
+	protected []string
+}
+
+func New(config Config) *Screener {
+	protected := config.Protected
+	if protected == nil {
+		protected = DefaultProtectedDomains
+	}
+	normalized := make([]string, 0, len(protected))
+	for _, domain := range protected {
+		if domain = normalizeDomain(domain); domain != "" {
+			normalized = append(normalized, domain)
+		}
+	}
+	return &Screener{
+		deny:      config.Deny,
+		allow:     config.Allow,
+		threats:   config.Threats,
+		protected: normalized,
+	}
+}
+
+// Check screens a normalized destination URL for a new link. The most
+// severe finding wins: the threat list first, then the deny list, then
+// lookalike hosts.
+func (s *Screener) Check(rawUrl string) Verdict {
+	return s.check(rawUrl, true)
+}
+
+// Recheck screens the destination of an existing link against the lists,
+// which change over time. Lookalike checks are left out: their outcome for
+// a host does not change, and a moderator may have released the link.
+func (s *Screener) Recheck(rawUrl string) Verdict {
+	return s.check(rawUrl, false)
+}
+
+func (s *Screener) check(rawUrl string, lookalikes bool) Verdict {
+	if s == nil {
+		return allowed()
+	}
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return allowed()
+	}
+	host := normalizeDomain(parsed.Hostname())
+	if host == "" {
+		return allowed()
+	}
+
+	if verdict := s.threats.Check(parsed); verdict.Action != Allow {
+		return verdict
+	}
+	if s.allow.Contains(host) {
+		return allowed()
+	}
+	if s.deny.Contains(host) {
+		return Verdict{Action: Block, Reason: "domain is on the deny list"}
+	}
+	if !lookalikes || net.ParseIP(host) != nil {
+		return allowed()
+	}
+	return checkLookalike(host, s.protected)
+}
+
+// Lowercase a domain and drop the trailing dot of fully qualified names
+func normalizeDomain(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
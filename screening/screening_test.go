@@ -0,0 +1,171 @@
+package screening
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Build a fetch response listing the SHA-256 prefixes of the expressions
+func threatListJSON(t *testing.T, threatType string, prefixSize int, expressions ...string) []byte {
+	t.Helper()
+	var raw []byte
+	var prefixes [][]byte
+	for _, expression := range expressions {
+		hash := sha256.Sum256([]byte(expression))
+		raw = append(raw, hash[:prefixSize]...)
+		prefixes = append(prefixes, hash[:prefixSize])
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return bytes.Compare(prefixes[i], prefixes[j]) < 0 })
+	checksum := sha256.New()
+	for _, prefix := range prefixes {
+		checksum.Write(prefix)
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"listUpdateResponses": []interface{}{map[string]interface{}{
+			"threatType":      threatType,
+			"threatEntryType": "URL",
+			"platformType":    "ANY_PLATFORM",
+			"responseType":    "FULL_UPDATE",
+			"additions": []interface{}{map[string]interface{}{
+				"compressionType": "RAW",
+				"rawHashes": map[string]interface{}{
+					"prefixSize": prefixSize,
+					"rawHashes":  base64.StdEncoding.EncodeToString(raw),
+				},
+			}},
+			"newClientState": "state",
+			"checksum":       map[string]string{"sha256": base64.StdEncoding.EncodeToString(checksum.Sum(nil))},
+		}},
+	})
+	assert.NoError(t, err)
+	return data
+}
+
+func TestURLExpressions(t *testing.T) {
+	u, _ := url.Parse("http://a.b.c/1/2.html?param=1")
+	assert.ElementsMatch(t, []string{
+		"a.b.c/1/2.html?param=1", "a.b.c/1/2.html", "a.b.c/", "a.b.c/1/",
+		"b.c/1/2.html?param=1", "b.c/1/2.html", "b.c/", "b.c/1/",
+	}, urlExpressions(u))
+
+	u, _ = url.Parse("http://1.2.3.4/")
+	assert.Equal(t, []string{"1.2.3.4/"}, urlExpressions(u))
+}
+
+func TestThreatList(t *testing.T) {
+	full, err := ParseThreatList(threatListJSON(t, "MALWARE", 32, "evil.example/"))
+	assert.NoError(t, err)
+	screener := New(Config{Threats: full})
+
+	// The whole domain is listed, so every page and subdomain matches
+	verdict := screener.Check("https://www.evil.example/download/payload.exe")
+	assert.Equal(t, Block, verdict.Action)
+	assert.Contains(t, verdict.Reason, "MALWARE")
+	assert.Equal(t, Allow, screener.Check("https://good.example/").Action)
+
+	// Short prefixes are not conclusive
+	short, err := ParseThreatList(threatListJSON(t, "SOCIAL_ENGINEERING", 4, "phish.example/login/"))
+	assert.NoError(t, err)
+	screener = New(Config{Threats: short})
+	assert.Equal(t, Quarantine, screener.Check("https://phish.example/login/index.html").Action)
+	assert.Equal(t, Allow, screener.Check("https://phish.example/about").Action)
+
+	// Corrupt lists are refused
+	data := threatListJSON(t, "MALWARE", 4, "a.example/")
+	var file map[string]interface{}
+	assert.NoError(t, json.Unmarshal(data, &file))
+	file["listUpdateResponses"].([]interface{})[0].(map[string]interface{})["checksum"] = map[string]string{"sha256": "AAAA"}
+	data, _ = json.Marshal(file)
+	_, err = ParseThreatList(data)
+	assert.ErrorContains(t, err, "checksum")
+
+	_, err = ParseThreatList([]byte(`{"listUpdateResponses":[{"responseType":"PARTIAL_UPDATE"}]}`))
+	assert.Error(t, err)
+}
+
+func TestThreatListReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "threats.json")
+	assert.NoError(t, os.WriteFile(path, threatListJSON(t, "MALWARE", 32, "old.example/"), 0o644))
+	list, err := LoadThreatList(path)
+	assert.NoError(t, err)
+	screener := New(Config{Threats: list})
+	assert.Equal(t, Allow, screener.Check("https://new.example/").Action)
+
+	// Newly listed domains are picked up, a broken file is ignored
+	assert.NoError(t, os.WriteFile(path, threatListJSON(t, "MALWARE", 32, "old.example/", "new.example/"), 0o644))
+	assert.NoError(t, list.Reload())
+	assert.Equal(t, Block, screener.Check("https://new.example/").Action)
+
+	assert.NoError(t, os.WriteFile(path, []byte("not json"), 0o644))
+	assert.Error(t, list.Reload())
+	assert.Equal(t, Block, screener.Check("https://new.example/").Action)
+}
+
+func TestDomainLists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deny.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("# Known bad\nbad.example\n\nEVIL.example.\n"), 0o644))
+	deny := NewDomainList([]string{"spam.example"})
+	assert.NoError(t, deny.LoadFile(path))
+
+	screener := New(Config{
+		Deny:  deny,
+		Allow: NewDomainList([]string{"ok.bad.example"}),
+	})
+	assert.Equal(t, Block, screener.Check("https://bad.example/").Action)
+	assert.Equal(t, Block, screener.Check("https://www.evil.example/page").Action)
+	assert.Equal(t, Block, screener.Check("https://spam.example/").Action)
+	assert.Equal(t, Allow, screener.Check("https://notbad.example/").Action)
+	assert.Equal(t, Allow, screener.Check("https://ok.bad.example/").Action)
+
+	assert.NoError(t, os.WriteFile(path, []byte("bad.example\n"), 0o644))
+	assert.NoError(t, deny.Reload())
+	assert.Equal(t, Allow, screener.Check("https://evil.example/").Action)
+}
+
+func TestLookalikes(t *testing.T) {
+	screener := New(Config{})
+
+	for _, rawUrl := range []string{
+		"https://www.google.com/",
+		"https://docs.github.com/en",
+		"https://example.com/",
+		"https://müller.de/",
+		"https://xn--mller-kva.de/",
+		"https://例え.jp/",
+		"http://192.168.0.1/",
+	} {
+		assert.Equal(t, Allow, screener.Check(rawUrl).Action, rawUrl)
+	}
+
+	// раураl.com, Cyrillic but for the l
+	verdict := screener.Check("https://xn--l-7sba6dbr.com/")
+	assert.Equal(t, Block, verdict.Action)
+	assert.Equal(t, "host name imitates paypal.com", verdict.Reason)
+
+	assert.Equal(t, Block, screener.Check("https://g00gle.com/").Action)
+	assert.Equal(t, Block, screener.Check("https://login.xn--pple-43d.com/").Action) // аpple.com
+
+	// Deceptive spellings of other domains are held for review
+	assert.Equal(t, Quarantine, screener.Check("https://xn--exmple-4nf.org/").Action) // exаmple.org, mixed
+	assert.Equal(t, Quarantine, screener.Check("https://xn--n1aahb.org/").Action)     // сосо.org, all Cyrillic
+
+	// Allowed domains skip the heuristics, not the threat list
+	screener = New(Config{Allow: NewDomainList([]string{"g00gle.com"})})
+	assert.Equal(t, Allow, screener.Check("https://g00gle.com/").Action)
+
+	// Existing links are only checked against the lists again
+	assert.Equal(t, Allow, New(Config{}).Recheck("https://xn--exmple-4nf.org/").Action)
+
+	var none *Screener
+	assert.Equal(t, Allow, none.Check("https://xn--l-7sba6dbr.com/").Action)
+}
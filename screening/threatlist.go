@@ -0,0 +1,258 @@
+package screening
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ThreatList holds hash prefixes of malicious URLs, loaded from a local file
+// in the format of the Safe Browsing v4 threatListUpdates:fetch response.
+// Only full updates with raw (uncompressed) hashes are read.
+//
+// Destinations match when the SHA-256 of one of their URL expressions starts
+// with a listed prefix. Full 32-byte hashes identify a URL for certain and
+// block it; shorter prefixes can collide with harmless URLs and without the
+// full-hash API that cannot be settled here, so they quarantine instead.
+type ThreatList struct {
+	file *watchedFile
+
+	mu sync.RWMutex
+	// Threat type by prefix, for each prefix length present
+	prefixes map[int]map[string]string
+}
+
+// Parts of the fetch response that are read
+type threatListFile struct {
+	ListUpdateResponses []struct {
+		ThreatType   string `json:"threatType"`
+		ResponseType string `json:"responseType"`
+		Additions    []struct {
+			CompressionType string `json:"compressionType"`
+			RawHashes       *struct {
+				PrefixSize int    `json:"prefixSize"`
+				RawHashes  string `json:"rawHashes"`
+			} `json:"rawHashes"`
+		} `json:"additions"`
+		Checksum *struct {
+			Sha256 string `json:"sha256"`
+		} `json:"checksum"`
+	} `json:"listUpdateResponses"`
+}
+
+// LoadThreatList reads the threat list at path. Reload and Watch reread it.
+func LoadThreatList(path string) (*ThreatList, error) {
+	list := &ThreatList{}
+	list.file = newWatchedFile(path, "threat list", list.parse)
+	if err := list.file.Reload(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// ParseThreatList reads a threat list from memory
+func ParseThreatList(data []byte) (*ThreatList, error) {
+	list := &ThreatList{}
+	if _, err := list.parse(data); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (l *ThreatList) parse(data []byte) (string, error) {
+	var file threatListFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return "", fmt.Errorf("invalid JSON: %v", err)
+	}
+	if len(file.ListUpdateResponses) == 0 {
+		return "", errors.New("no listUpdateResponses")
+	}
+
+	prefixes := make(map[int]map[string]string)
+	total := 0
+	for i, response := range file.ListUpdateResponses {
+		if response.ResponseType != "" && response.ResponseType != "FULL_UPDATE" {
+			return "", fmt.Errorf("list %d: only FULL_UPDATE responses are supported, got %s", i, response.ResponseType)
+		}
+		threatType := response.ThreatType
+		if threatType == "" {
+			threatType = "THREAT"
+		}
+
+		var listed [][]byte
+		for _, addition := range response.Additions {
+			if addition.CompressionType != "" && addition.CompressionType != "RAW" {
+				return "", fmt.Errorf("list %d: %s compression is not supported", i, addition.CompressionType)
+			}
+			if addition.RawHashes == nil {
+				continue
+			}
+			size := addition.RawHashes.PrefixSize
+			if size < 4 || size > sha256.Size {
+				return "", fmt.Errorf("list %d: invalid prefix size %d", i, size)
+			}
+			hashes, err := base64.StdEncoding.DecodeString(addition.RawHashes.RawHashes)
+			if err != nil {
+				return "", fmt.Errorf("list %d: invalid rawHashes: %v", i, err)
+			}
+			if len(hashes)%size != 0 {
+				return "", fmt.Errorf("list %d: rawHashes is not a multiple of the prefix size", i)
+			}
+			for start := 0; start < len(hashes); start += size {
+				listed = append(listed, hashes[start:start+size])
+			}
+		}
+
+		if response.Checksum != nil && response.Checksum.Sha256 != "" {
+			if err := verifyChecksum(listed, response.Checksum.Sha256); err != nil {
+				return "", fmt.Errorf("list %d: %v", i, err)
+			}
+		}
+
+		for _, prefix := range listed {
+			if prefixes[len(prefix)] == nil {
+				prefixes[len(prefix)] = make(map[string]string)
+			}
+			prefixes[len(prefix)][string(prefix)] = threatType
+		}
+		total += len(listed)
+	}
+
+	l.mu.Lock()
+	l.prefixes = prefixes
+	l.mu.Unlock()
+	return fmt.Sprintf("%d hash prefixes", total), nil
+}
+
+// The checksum is the SHA-256 of all prefixes of a list, sorted and
+// concatenated
+func verifyChecksum(prefixes [][]byte, expected string) error {
+	sorted := make([][]byte, len(prefixes))
+	copy(sorted, prefixes)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i], sorted[j]) < 0 })
+
+	digest := sha256.New()
+	for _, prefix := range sorted {
+		digest.Write(prefix)
+	}
+	if base64.StdEncoding.EncodeToString(digest.Sum(nil)) != expected {
+		return errors.New("checksum mismatch")
+	}
+	return nil
+}
+
+// Reload the threat list file. On failure the previous list stays in use.
+func (l *ThreatList) Reload() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	return l.file.Reload()
+}
+
+// Watch reloads the threat list whenever the file changes until the context
+// is cancelled
+func (l *ThreatList) Watch(ctx context.Context, interval time.Duration) {
+	if l != nil && l.file != nil {
+		l.file.Watch(ctx, interval)
+	}
+}
+
+// Check looks up every expression of a URL
+func (l *ThreatList) Check(u *url.URL) Verdict {
+	if l == nil {
+		return allowed()
+	}
+	hashes := make([][sha256.Size]byte, 0, 30)
+	for _, expression := range urlExpressions(u) {
+		hashes = append(hashes, sha256.Sum256([]byte(expression)))
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	verdict := allowed()
+	for size, listed := range l.prefixes {
+		for _, hash := range hashes {
+			threatType, ok := listed[string(hash[:size])]
+			if !ok {
+				continue
+			}
+			if size == sha256.Size {
+				return Verdict{Action: Block, Reason: "destination is on the threat list (" + threatType + ")"}
+			}
+			verdict = Verdict{Action: Quarantine, Reason: "destination matches a threat list prefix (" + threatType + ")"}
+		}
+	}
+	return verdict
+}
+
+// The host suffix / path prefix expressions Safe Browsing hashes for a URL:
+// the exact host and up to four of its parent domains, combined with the
+// exact path with and without the query and up to four leading path
+// segments.
+func urlExpressions(u *url.URL) []string {
+	host := normalizeDomain(u.Hostname())
+	for strings.Contains(host, "..") {
+		host = strings.ReplaceAll(host, "..", ".")
+	}
+	host = strings.TrimPrefix(host, ".")
+
+	hosts := []string{host}
+	if net.ParseIP(host) == nil {
+		labels := strings.Split(host, ".")
+		if len(labels) > 5 {
+			labels = labels[len(labels)-5:]
+		}
+		for i := range labels {
+			suffix := strings.Join(labels[i:], ".")
+			// The top-level domain alone is never an expression
+			if i == len(labels)-1 || suffix == host {
+				continue
+			}
+			hosts = append(hosts, suffix)
+		}
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	var paths []string
+	if u.RawQuery != "" {
+		paths = append(paths, path+"?"+u.RawQuery)
+	}
+	paths = append(paths, path)
+	prefix := "/"
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 0; i < len(segments) && len(paths) < 6; i++ {
+		if prefix != path {
+			paths = append(paths, prefix)
+		}
+		if segments[i] == "" {
+			break
+		}
+		prefix += segments[i] + "/"
+	}
+
+	expressions := make([]string, 0, len(hosts)*len(paths))
+	seen := make(map[string]bool)
+	for _, h := range hosts {
+		for _, p := range paths {
+			expression := h + p
+			if !seen[expression] {
+				seen[expression] = true
+				expressions = append(expressions, expression)
+			}
+		}
+	}
+	return expressions
+}
@@ -0,0 +1,91 @@
+package screening
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// How often list files are checked for changes by default
+const ReloadInterval = time.Minute
+
+// A file that is parsed again whenever it changes on disk. parse returns a
+// short summary for the log.
+type watchedFile struct {
+	path  string
+	name  string
+	parse func(data []byte) (string, error)
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+}
+
+func newWatchedFile(path string, name string, parse func(data []byte) (string, error)) *watchedFile {
+	return &watchedFile{path: path, name: name, parse: parse}
+}
+
+// Reload the file. On failure the previously parsed contents stay in use.
+func (f *watchedFile) Reload() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return fmt.Errorf("%s: %v", f.name, err)
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return fmt.Errorf("%s: %v", f.name, err)
+	}
+	summary, err := f.parse(data)
+	if err != nil {
+		return fmt.Errorf("%s %s: %v", f.name, f.path, err)
+	}
+
+	f.mu.Lock()
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+	f.mu.Unlock()
+	log.Printf("Screening %s loaded from %s (%s)", f.name, f.path, summary)
+	return nil
+}
+
+// Whether the file on disk differs from the one loaded
+func (f *watchedFile) changed() bool {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return !info.ModTime().Equal(f.modTime) || info.Size() != f.size
+}
+
+// Watch reloads the file whenever it changes until the context is cancelled
+func (f *watchedFile) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !f.changed() {
+				continue
+			}
+			if err := f.Reload(); err != nil {
+				log.Printf("Warning: Failed reloading screening %s: %v", f.name, err)
+			}
+		}
+	}
+}
+
+// Watch reloads the file given to LoadFile whenever it changes until the
+// context is cancelled
+func (l *DomainList) Watch(ctx context.Context, interval time.Duration) {
+	if l != nil && l.file != nil {
+		l.file.Watch(ctx, interval)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"url-shortener/useragent"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/joho/godotenv"
+)
+
+func init() {
+	_ = godotenv.Load(".env")
+}
+
+// Classifies the User-Agent of existing clicks into device, browser and os.
+// Usage: go run scripts/backfill-user-agents.go [-batch 1000] [-dry-run]
+func main() {
+	batchSize := flag.Int("batch", 1000, "clicks classified per batch")
+	dryRun := flag.Bool("dry-run", false, "print the classification without writing it")
+	flag.Parse()
+
+	databaseUrl := os.Getenv("DATABASE_URL")
+	if databaseUrl == "" {
+		log.Fatal("DATABASE_URL environment variable not set")
+	}
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, databaseUrl)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer conn.Close(ctx)
+
+	fmt.Print("🔧 Backfilling device, browser and os of clicks...\n\n")
+
+	// Walk the unclassified clicks in id order so every batch resumes
+	// where the previous one stopped
+	lastId := ""
+	total := 0
+	for {
+		rows, err := conn.Query(ctx,
+			`SELECT id, "userAgent" FROM url_clicks
+			 WHERE device IS NULL AND "userAgent" IS NOT NULL AND "userAgent" <> '' AND id > $1
+			 ORDER BY id LIMIT $2`,
+			lastId, *batchSize)
+		if err != nil {
+			log.Fatalf("Error querying clicks: %v", err)
+		}
+
+		type click struct{ id, userAgent string }
+		clicks, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (click, error) {
+			var c click
+			err := row.Scan(&c.id, &c.userAgent)
+			return c, err
+		})
+		if err != nil {
+			log.Fatalf("Error reading clicks: %v", err)
+		}
+		if len(clicks) == 0 {
+			break
+		}
+
+		batch := &pgx.Batch{}
+		for _, c := range clicks {
+			info := useragent.Parse(c.userAgent)
+			if *dryRun {
+				fmt.Printf("%s: %s / %s / %s\n", c.id, info.Device, info.Browser, info.OS)
+				continue
+			}
+			batch.Queue(`UPDATE url_clicks SET device = $2, browser = $3, os = $4 WHERE id = $1`,
+				c.id, info.Device, info.Browser, info.OS)
+		}
+		if !*dryRun {
+			if err := conn.SendBatch(ctx, batch).Close(); err != nil {
+				log.Fatalf("Error updating clicks: %v", err)
+			}
+		}
+
+		total += len(clicks)
+		lastId = clicks[len(clicks)-1].id
+		fmt.Printf("   Classified %d clicks so far\n", total)
+	}
+
+	fmt.Printf("✅ Classified %d clicks\n", total)
+}
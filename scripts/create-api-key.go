@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"url-shortener/auth"
+	"url-shortener/store"
+)
+
+// Issues an API key for a user, e.g. the first key of a new integration.
+// Usage: go run scripts/create-api-key.go -user <users.id> [-name "CI"]
+func main() {
+	userId := flag.String("user", "", "id of the user the key acts as")
+	name := flag.String("name", "CLI", "label shown in key listings")
+	flag.Parse()
+
+	if *userId == "" {
+		log.Fatal("-user is required")
+	}
+	if os.Getenv("DATABASE_URL") == "" {
+		log.Fatal("DATABASE_URL environment variable not set")
+	}
+
+	storage := store.InitializeStore()
+	defer storage.Close()
+
+	key, secret, err := auth.NewAPIKey(*userId, *name)
+	if err != nil {
+		log.Fatalf("Error generating API key: %v", err)
+	}
+	key, err = storage.CreateAPIKey(key)
+	if err != nil {
+		log.Fatalf("Error saving API key: %v", err)
+	}
+
+	fmt.Printf("✅ Created API key %s for user %s\n\n", key.Id, key.UserId)
+	fmt.Printf("   %s\n\n", secret)
+	fmt.Println("Store it now, it will not be shown again.")
+}
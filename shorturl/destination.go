@@ -0,0 +1,116 @@
+package shortener
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/idna"
+)
+
+// Longest destination accepted, after normalization
+const MaxUrlLength = 2048
+
+// Schemes a short link may redirect to. Anything else, javascript: and
+// data: in particular, is rejected.
+var AllowedSchemes = map[string]bool{
+	"http":  true,
+	"https": true,
+}
+
+// Ports implied by each scheme, dropped during normalization
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+var (
+	ErrUrlRequired  = errors.New("URL is required")
+	ErrUrlTooLong   = fmt.Errorf("URL must be at most %d characters", MaxUrlLength)
+	ErrUrlMalformed = errors.New("URL is malformed")
+	ErrUrlScheme    = errors.New("URL must start with http:// or https://")
+	ErrUrlHost      = errors.New("URL must contain a valid host name")
+	ErrUrlUserInfo  = errors.New("URL must not contain a user name or password")
+	ErrUrlPort      = errors.New("URL contains an invalid port")
+)
+
+// Host names are mapped with the lookup profile, which also rejects
+// characters that are not allowed in domain names
+var hostProfile = idna.Lookup
+
+// NormalizeUrl validates a destination URL and returns its canonical form:
+// lowercase scheme and host, internationalized host names in punycode and no
+// default port. The errors are the ErrUrl* values.
+func NormalizeUrl(rawUrl string) (string, error) {
+	rawUrl = strings.TrimSpace(rawUrl)
+	if rawUrl == "" {
+		return "", ErrUrlRequired
+	}
+	if len(rawUrl) > MaxUrlLength {
+		return "", ErrUrlTooLong
+	}
+	if strings.IndexFunc(rawUrl, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) >= 0 {
+		return "", ErrUrlMalformed
+	}
+
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return "", ErrUrlMalformed
+	}
+	scheme := strings.ToLower(parsed.Scheme)
+	if !AllowedSchemes[scheme] {
+		return "", ErrUrlScheme
+	}
+	if parsed.Opaque != "" || parsed.Host == "" {
+		return "", ErrUrlHost
+	}
+	if parsed.User != nil {
+		return "", ErrUrlUserInfo
+	}
+
+	host, err := normalizeHost(parsed.Hostname())
+	if err != nil {
+		return "", err
+	}
+	port := parsed.Port()
+	if port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return "", ErrUrlPort
+		}
+	}
+	if port == defaultPorts[scheme] || port == "" {
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		parsed.Host = host
+	} else {
+		parsed.Host = net.JoinHostPort(host, port)
+	}
+	parsed.Scheme = scheme
+
+	normalized := parsed.String()
+	if len(normalized) > MaxUrlLength {
+		return "", ErrUrlTooLong
+	}
+	return normalized, nil
+}
+
+// Lowercase a host name and convert it to its ASCII form. IP addresses are
+// kept as they are.
+func normalizeHost(host string) (string, error) {
+	if host == "" {
+		return "", ErrUrlHost
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String(), nil
+	}
+	ascii, err := hostProfile.ToASCII(strings.ToLower(host))
+	if err != nil || ascii == "" {
+		return "", ErrUrlHost
+	}
+	return ascii, nil
+}
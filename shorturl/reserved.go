@@ -0,0 +1,81 @@
+package shortener
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Codes that are always reserved, even before the routes using them exist
+var DefaultReservedWords = []string{"api", "admin", "health"}
+
+// ReservedWords is the registry of short codes that can never be allocated,
+// neither generated nor chosen as an alias. Matching is case-insensitive
+// and on the whole code.
+type ReservedWords struct {
+	mu    sync.RWMutex
+	words map[string]struct{}
+}
+
+// Initializing a registry holding the default words plus the given ones
+func NewReservedWords(words ...string) *ReservedWords {
+	reserved := &ReservedWords{words: make(map[string]struct{})}
+	reserved.Add(DefaultReservedWords...)
+	reserved.Add(words...)
+	return reserved
+}
+
+func (r *ReservedWords) Add(words ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, word := range words {
+		word = strings.ToLower(strings.TrimSpace(word))
+		if word != "" {
+			r.words[word] = struct{}{}
+		}
+	}
+}
+
+// AddRoutePath reserves the first segment of a registered route such as
+// "/links/:code" so that no short code can shadow it. Parameter segments
+// and the root route reserve nothing.
+func (r *ReservedWords) AddRoutePath(path string) {
+	segment := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)[0]
+	if segment == "" || strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+		return
+	}
+	r.Add(segment)
+}
+
+// AddFile reserves every non-empty line of a file; lines starting with '#'
+// are comments
+func (r *ReservedWords) AddFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r.Add(line)
+	}
+	return scanner.Err()
+}
+
+func (r *ReservedWords) IsReserved(code string) bool {
+	if r == nil {
+		return false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, reserved := r.words[strings.ToLower(code)]
+	return reserved
+}
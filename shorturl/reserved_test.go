@@ -0,0 +1,37 @@
+package shortener
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReservedWords(t *testing.T) {
+	reserved := NewReservedWords("MyBrand")
+	reserved.AddRoutePath("/create-short-url")
+	reserved.AddRoutePath("/links/:code")
+	reserved.AddRoutePath("/:shortUrl")
+	reserved.AddRoutePath("/")
+
+	assert.True(t, reserved.IsReserved("health"))
+	assert.True(t, reserved.IsReserved("mybrand"))
+	assert.True(t, reserved.IsReserved("Create-Short-Url"))
+	assert.True(t, reserved.IsReserved("links"))
+	assert.False(t, reserved.IsReserved(":shortUrl"))
+	assert.False(t, reserved.IsReserved("launch-2026"))
+
+	var empty *ReservedWords
+	assert.False(t, empty.IsReserved("admin"))
+}
+
+func TestReservedWordsFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reserved.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("# brands\nacme\n\n  Shrinkr  \n"), 0o644))
+
+	reserved := NewReservedWords()
+	assert.NoError(t, reserved.AddFile(path))
+	assert.True(t, reserved.IsReserved("acme"))
+	assert.True(t, reserved.IsReserved("shrinkr"))
+	assert.False(t, reserved.IsReserved("# brands"))
+}
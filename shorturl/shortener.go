@@ -2,6 +2,7 @@ package shortener
 
 import (
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"github.com/itchyny/base58-go"
 	"math/big"
@@ -24,9 +25,60 @@ func base58Encoded(bytes []byte) string {
 	return string(encoded)
 }
 
+// Length of the code produced on the first attempt
+const ShortLinkLength = 8
+
+// Number of candidate codes tried before allocation gives up
+const MaxAttempts = 5
+
 func GenerateShortLink(initialLink string, userId string) string {
-	urlHashBytes := sha256Of(initialLink + userId)
-	generatedNumber := new(big.Int).SetBytes(urlHashBytes).Uint64()
-	finalString := base58Encoded([]byte(fmt.Sprintf("%d", generatedNumber)))
-	return finalString[:8]
-}
\ No newline at end of file
+	return GenerateShortLinkAttempt(initialLink, userId, 0)
+}
+
+// GenerateShortLinkAttempt returns the candidate code for a given allocation
+// attempt. Attempt 0 is the plain hash of the link and user; later attempts
+// salt the hash with the attempt number and grow the code by one character
+// each, so a collision never produces the same candidate twice. Valid links
+// are normalized first, so equivalent spellings of a URL share a code.
+func GenerateShortLinkAttempt(initialLink string, userId string, attempt int) string {
+	if normalized, err := NormalizeUrl(initialLink); err == nil {
+		initialLink = normalized
+	}
+
+	if attempt == 0 {
+		urlHashBytes := sha256Of(initialLink + userId)
+		generatedNumber := new(big.Int).SetBytes(urlHashBytes).Uint64()
+		finalString := base58Encoded([]byte(fmt.Sprintf("%d", generatedNumber)))
+		return finalString[:ShortLinkLength]
+	}
+
+	// Encode the whole salted hash so there are enough characters to grow into
+	urlHashBytes := sha256Of(fmt.Sprintf("%s%s#%d", initialLink, userId, attempt))
+	finalString := base58Encoded([]byte(new(big.Int).SetBytes(urlHashBytes).String()))
+	return finalString[:ShortLinkLength+attempt]
+}
+
+// Bounds for user-chosen aliases
+const (
+	MinAliasLength = 3
+	MaxAliasLength = 64
+)
+
+var ErrInvalidAlias = errors.New("alias may only contain letters, digits, '-' and '_' and must start with a letter or digit")
+
+// ValidateAlias checks that a custom alias such as "launch-2026" can be used
+// as a short code
+func ValidateAlias(alias string) error {
+	if len(alias) < MinAliasLength || len(alias) > MaxAliasLength {
+		return fmt.Errorf("alias must be between %d and %d characters", MinAliasLength, MaxAliasLength)
+	}
+	for i, r := range alias {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case (r == '-' || r == '_') && i > 0:
+		default:
+			return ErrInvalidAlias
+		}
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package shortener
 
 import (
 	"github.com/stretchr/testify/assert"
+	"strings"
 	"testing"
 )
 
@@ -22,3 +23,30 @@ func TestShortLinkGenerator(t *testing.T) {
 	assert.Equal(t, shortLink_2, "d66yfx7N")
 	assert.Equal(t, shortLink_3, "dhZTayYQ")
 }
+
+
+func TestShortLinkAttempts(t *testing.T) {
+	initialLink := "https://www.eddywm.com/lets-build-a-url-shortener-in-go-with-redis-part-2-storage-layer/"
+
+	assert.Equal(t, GenerateShortLink(initialLink, UserId), GenerateShortLinkAttempt(initialLink, UserId, 0))
+
+	seen := map[string]bool{}
+	for attempt := 0; attempt < MaxAttempts; attempt++ {
+		candidate := GenerateShortLinkAttempt(initialLink, UserId, attempt)
+		assert.Len(t, candidate, ShortLinkLength+attempt)
+		assert.False(t, seen[candidate])
+		seen[candidate] = true
+	}
+}
+
+func TestValidateAlias(t *testing.T) {
+	assert.NoError(t, ValidateAlias("launch-2026"))
+	assert.NoError(t, ValidateAlias("My_Link"))
+
+	assert.Error(t, ValidateAlias("ab"))
+	assert.Error(t, ValidateAlias(strings.Repeat("a", MaxAliasLength+1)))
+	assert.Error(t, ValidateAlias("-leading"))
+	assert.Error(t, ValidateAlias("has space"))
+	assert.Error(t, ValidateAlias("slash/path"))
+	assert.Error(t, ValidateAlias("ünïcode"))
+}
@@ -0,0 +1,46 @@
+package store
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// APIKey is a credential for programmatic access on behalf of a user. Only
+// the SHA-256 hash of the secret is stored; Prefix is kept in clear so users
+// can tell their keys apart.
+type APIKey struct {
+	Id         string     `json:"id"`
+	UserId     string     `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+func (k APIKey) IsRevoked() bool {
+	return k.RevokedAt != nil
+}
+
+// APIKeyStore keeps the API keys of users
+type APIKeyStore interface {
+	// Store a new key, assigning its id and creation time
+	CreateAPIKey(key APIKey) (APIKey, error)
+	// Look up a key by the hash of its secret. Returns ErrNotFound for
+	// unknown keys; revoked keys are returned and must be rejected by the
+	// caller.
+	RetrieveAPIKey(keyHash string) (APIKey, error)
+	// Keys of a user, newest first, including revoked ones
+	ListAPIKeys(userId string) ([]APIKey, error)
+	// Returns ErrNotFound when the user has no such key
+	RevokeAPIKey(userId string, id string) error
+	TouchAPIKey(id string, usedAt time.Time) error
+}
+
+var apiKeySequence atomic.Uint64
+
+func generateAPIKeyId() string {
+	return fmt.Sprintf("key_%d_%d", time.Now().UnixNano(), apiKeySequence.Add(1))
+}
@@ -0,0 +1,216 @@
+package store
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Click is a single redirect as recorded for analytics
+type Click struct {
+	ShortCode string
+	UserId    string
+	IpAddress string
+	UserAgent string
+	Referer   string
+	ClickedAt time.Time
+
+	// Filled in by enrichers before the click is written
+	Country string
+	City    string
+	Device  string
+	Browser string
+	OS      string
+}
+
+// ClickEnricher adds derived data to a click. Enrichers run on the queue
+// workers, never on the redirect path.
+type ClickEnricher interface {
+	EnrichClick(click *Click)
+}
+
+// Returned when the click queue is full and the click was dropped
+var ErrClickQueueFull = errors.New("click queue is full")
+
+// Returned when a click arrives after the queue was closed
+var ErrClickQueueClosed = errors.New("click queue is closed")
+
+// Sizing of the click ingestion pipeline
+type ClickQueueConfig struct {
+	Capacity      int           // Clicks buffered before new ones are dropped
+	BatchSize     int           // Clicks written per batch at most
+	FlushInterval time.Duration // Longest a click waits for its batch to fill
+	Workers       int           // Batches written concurrently
+
+	Enrichers []ClickEnricher // Applied to every click before it is written
+}
+
+var DefaultClickQueueConfig = ClickQueueConfig{
+	Capacity:      10000,
+	BatchSize:     500,
+	FlushInterval: time.Second,
+	Workers:       2,
+}
+
+// Counters describing the click pipeline since start
+type ClickQueueStats struct {
+	Enqueued int64 `json:"enqueued"`
+	Dropped  int64 `json:"dropped"`
+	Written  int64 `json:"written"`
+	Skipped  int64 `json:"skipped"` // Clicks for short codes missing from the store
+	Failed   int64 `json:"failed"`
+	Pending  int   `json:"pending"`
+	Capacity int   `json:"capacity"`
+}
+
+// ClickQueue takes clicks off the redirect path. TrackUrlClick only puts the
+// click on a bounded in-process queue; workers write them in batches through
+// a ClickWriter. When the queue is full new clicks are dropped rather than
+// slowing down redirects, and counted in Stats.
+type ClickQueue struct {
+	writer ClickWriter
+	config ClickQueueConfig
+	queue  chan Click
+	wg     sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+
+	enqueued atomic.Int64
+	dropped  atomic.Int64
+	written  atomic.Int64
+	skipped  atomic.Int64
+	failed   atomic.Int64
+}
+
+// Initializing a click queue and starting its workers
+func NewClickQueue(writer ClickWriter, config ClickQueueConfig) *ClickQueue {
+	if config.Capacity <= 0 {
+		config.Capacity = DefaultClickQueueConfig.Capacity
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultClickQueueConfig.BatchSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = DefaultClickQueueConfig.FlushInterval
+	}
+	if config.Workers <= 0 {
+		config.Workers = DefaultClickQueueConfig.Workers
+	}
+
+	q := &ClickQueue{
+		writer: writer,
+		config: config,
+		queue:  make(chan Click, config.Capacity),
+	}
+	for i := 0; i < config.Workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+	return q
+}
+
+func (q *ClickQueue) TrackUrlClick(shortCode string, userId string, ipAddress string, userAgent string, referer string) error {
+	return q.Enqueue(Click{
+		ShortCode: shortCode,
+		UserId:    userId,
+		IpAddress: ipAddress,
+		UserAgent: userAgent,
+		Referer:   referer,
+		ClickedAt: time.Now(),
+	})
+}
+
+// Enqueue a click without ever blocking
+func (q *ClickQueue) Enqueue(click Click) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		q.dropped.Add(1)
+		return ErrClickQueueClosed
+	}
+
+	select {
+	case q.queue <- click:
+		q.enqueued.Add(1)
+		return nil
+	default:
+		q.dropped.Add(1)
+		return ErrClickQueueFull
+	}
+}
+
+// Close stops accepting clicks and waits until everything queued is written
+func (q *ClickQueue) Close() {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	close(q.queue)
+	q.mu.Unlock()
+
+	q.wg.Wait()
+	log.Printf("Click queue flushed: %+v", q.Stats())
+}
+
+func (q *ClickQueue) Stats() ClickQueueStats {
+	return ClickQueueStats{
+		Enqueued: q.enqueued.Load(),
+		Dropped:  q.dropped.Load(),
+		Written:  q.written.Load(),
+		Skipped:  q.skipped.Load(),
+		Failed:   q.failed.Load(),
+		Pending:  len(q.queue),
+		Capacity: q.config.Capacity,
+	}
+}
+
+func (q *ClickQueue) work() {
+	defer q.wg.Done()
+
+	batch := make([]Click, 0, q.config.BatchSize)
+	ticker := time.NewTicker(q.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case click, ok := <-q.queue:
+			if !ok {
+				q.flush(batch)
+				return
+			}
+			batch = append(batch, click)
+			if len(batch) >= q.config.BatchSize {
+				q.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			q.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+func (q *ClickQueue) flush(batch []Click) {
+	if len(batch) == 0 {
+		return
+	}
+	for i := range batch {
+		for _, enricher := range q.config.Enrichers {
+			enricher.EnrichClick(&batch[i])
+		}
+	}
+	written, err := q.writer.WriteClicks(batch)
+	if err != nil {
+		log.Printf("Warning: Failed writing %d clicks | Error: %v", len(batch), err)
+		q.failed.Add(int64(len(batch)))
+		return
+	}
+	q.written.Add(int64(written))
+	q.skipped.Add(int64(len(batch) - written))
+}
@@ -0,0 +1,130 @@
+package store
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Writer that records batches and can be held up to fill the queue. Clicks
+// for the unknown short code are skipped like a store would.
+type recordingWriter struct {
+	mu      sync.Mutex
+	batches [][]Click
+	release chan struct{}
+	unknown string
+}
+
+func (w *recordingWriter) WriteClicks(clicks []Click) (int, error) {
+	if w.release != nil {
+		<-w.release
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var batch []Click
+	for _, click := range clicks {
+		if w.unknown == "" || click.ShortCode != w.unknown {
+			batch = append(batch, click)
+		}
+	}
+	w.batches = append(w.batches, batch)
+	return len(batch), nil
+}
+
+func (w *recordingWriter) total() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	total := 0
+	for _, batch := range w.batches {
+		total += len(batch)
+	}
+	return total
+}
+
+func TestClickQueueBatchesAndFlushesOnClose(t *testing.T) {
+	writer := &recordingWriter{}
+	queue := NewClickQueue(writer, ClickQueueConfig{Capacity: 100, BatchSize: 10, FlushInterval: time.Hour, Workers: 1})
+
+	for i := 0; i < 25; i++ {
+		assert.NoError(t, queue.TrackUrlClick("abc12345", "guest-user", "127.0.0.1", "test-agent", ""))
+	}
+	queue.Close()
+
+	assert.Equal(t, 25, writer.total())
+	assert.Len(t, writer.batches, 3)
+	assert.Equal(t, int64(25), queue.Stats().Written)
+	assert.ErrorIs(t, queue.TrackUrlClick("abc12345", "guest-user", "127.0.0.1", "test-agent", ""), ErrClickQueueClosed)
+}
+
+func TestClickQueueCountsSkippedClicks(t *testing.T) {
+	writer := &recordingWriter{unknown: "missing1"}
+	queue := NewClickQueue(writer, ClickQueueConfig{Capacity: 10, BatchSize: 10, FlushInterval: time.Hour, Workers: 1})
+
+	assert.NoError(t, queue.TrackUrlClick("abc12345", "guest-user", "127.0.0.1", "test-agent", ""))
+	assert.NoError(t, queue.TrackUrlClick("missing1", "guest-user", "127.0.0.1", "test-agent", ""))
+	assert.NoError(t, queue.TrackUrlClick("abc12345", "guest-user", "127.0.0.1", "test-agent", ""))
+	queue.Close()
+
+	stats := queue.Stats()
+	assert.Equal(t, int64(3), stats.Enqueued)
+	assert.Equal(t, int64(2), stats.Written)
+	assert.Equal(t, int64(1), stats.Skipped)
+	assert.Equal(t, int64(0), stats.Failed)
+}
+
+func TestClickQueueFlushesOnInterval(t *testing.T) {
+	writer := &recordingWriter{}
+	queue := NewClickQueue(writer, ClickQueueConfig{Capacity: 100, BatchSize: 100, FlushInterval: 10 * time.Millisecond, Workers: 1})
+	defer queue.Close()
+
+	assert.NoError(t, queue.TrackUrlClick("abc12345", "guest-user", "127.0.0.1", "test-agent", ""))
+	assert.Eventually(t, func() bool { return writer.total() == 1 }, time.Second, 5*time.Millisecond)
+}
+
+func TestClickQueueDropsWhenFull(t *testing.T) {
+	writer := &recordingWriter{release: make(chan struct{})}
+	queue := NewClickQueue(writer, ClickQueueConfig{Capacity: 2, BatchSize: 1, FlushInterval: time.Hour, Workers: 1})
+
+	// The worker holds the first click while the next two fill the queue
+	assert.NoError(t, queue.TrackUrlClick("abc12345", "", "", "", ""))
+	assert.Eventually(t, func() bool { return queue.Stats().Pending == 0 }, time.Second, time.Millisecond)
+	assert.NoError(t, queue.TrackUrlClick("abc12345", "", "", "", ""))
+	assert.NoError(t, queue.TrackUrlClick("abc12345", "", "", "", ""))
+	assert.ErrorIs(t, queue.TrackUrlClick("abc12345", "", "", "", ""), ErrClickQueueFull)
+
+	close(writer.release)
+	queue.Close()
+
+	stats := queue.Stats()
+	assert.Equal(t, int64(3), stats.Enqueued)
+	assert.Equal(t, int64(1), stats.Dropped)
+	assert.Equal(t, int64(3), stats.Written)
+}
+
+func TestMemoryStoreWriteClicks(t *testing.T) {
+	memoryStore := NewMemoryStore()
+	_ = memoryStore.SaveUrlMapping("abc12345", "https://example.com", "guest-user")
+
+	written, err := memoryStore.WriteClicks([]Click{{ShortCode: "abc12345"}, {ShortCode: "missing1"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, written)
+	assert.Len(t, memoryStore.Clicks("abc12345"), 1)
+	assert.Empty(t, memoryStore.Clicks("missing1"))
+}
+
+type countryEnricher struct{}
+
+func (countryEnricher) EnrichClick(click *Click) {
+	click.Country = "NL"
+}
+
+func TestClickQueueRunsEnrichers(t *testing.T) {
+	writer := &recordingWriter{}
+	queue := NewClickQueue(writer, ClickQueueConfig{Capacity: 10, BatchSize: 10, FlushInterval: time.Hour, Workers: 1, Enrichers: []ClickEnricher{countryEnricher{}}})
+
+	assert.NoError(t, queue.TrackUrlClick("abc12345", "guest-user", "127.0.0.1", "test-agent", ""))
+	queue.Close()
+
+	assert.Equal(t, "NL", writer.batches[0][0].Country)
+}
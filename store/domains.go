@@ -0,0 +1,74 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Returned when a host is verified by another user, or already registered
+// by the same one
+var ErrDomainTaken = errors.New("domain is already registered")
+
+// Domain is a host name a user serves their links under. Links on a domain
+// are stored under DomainCode(domain.Id, code), so a code only has to be
+// unique on its own domain, and links of a deleted domain never resolve
+// again, even when someone else registers the host later.
+type Domain struct {
+	Id         string     `json:"id"`
+	UserId     string     `json:"user_id"`
+	Host       string     `json:"host"`
+	Token      string     `json:"-"` // Expected in the verification TXT record
+	CreatedAt  time.Time  `json:"created_at"`
+	VerifiedAt *time.Time `json:"verified_at"`
+}
+
+func (d Domain) IsVerified() bool {
+	return d.VerifiedAt != nil
+}
+
+// DomainStore keeps the custom domains of users. Any number of users may
+// register a host, but only one can verify it.
+type DomainStore interface {
+	// Register a domain, assigning its id and creation time. Returns
+	// ErrDomainTaken when the host is verified or the user registered it
+	// before.
+	CreateDomain(domain Domain) (Domain, error)
+	// Domains of a user by host
+	ListDomains(userId string) ([]Domain, error)
+	// The verified domain of a host, or ErrNotFound
+	RetrieveVerifiedDomain(host string) (Domain, error)
+	// Mark a domain of the user verified. Returns ErrNotFound when the user
+	// has no such domain and ErrDomainTaken when another user verified the
+	// host first.
+	VerifyDomain(userId string, id string, at time.Time) (Domain, error)
+	// Delete a domain of the user and the links on it. Returns ErrNotFound
+	// when the user has no such domain.
+	DeleteDomain(userId string, id string) error
+}
+
+// Key a link on a domain is stored under. Links on the default domain have
+// no domain ID and are stored under their code.
+func DomainCode(domainId string, code string) string {
+	if domainId == "" {
+		return code
+	}
+	return domainId + "/" + code
+}
+
+// The domain ID and code of a stored key, the reverse of DomainCode
+func SplitDomainCode(key string) (string, string) {
+	domainId, code, found := strings.Cut(key, "/")
+	if !found {
+		return "", key
+	}
+	return domainId, code
+}
+
+var domainSequence atomic.Uint64
+
+func generateDomainId() string {
+	return fmt.Sprintf("dom_%d_%d", time.Now().UnixNano(), domainSequence.Add(1))
+}
@@ -0,0 +1,69 @@
+package store
+
+import "time"
+
+// Values of ExportedLink.Status
+const (
+	LinkStatusActive      = "active"
+	LinkStatusInactive    = "inactive"
+	LinkStatusExpired     = "expired"
+	LinkStatusQuarantined = "quarantined"
+)
+
+// ExportStore reads a user's data page by page. Each page continues after
+// the cursor of the last row of the previous one, so exports of any size
+// run in constant memory without holding a transaction open.
+type ExportStore interface {
+	// Links of a user that are not deleted, oldest first
+	ExportLinks(userId string, after ExportCursor, limit int) ([]ExportedLink, error)
+	// Clicks on the links of a user in [from, to), oldest first
+	ExportClicks(userId string, from time.Time, to time.Time, after ExportCursor, limit int) ([]ExportedClick, error)
+}
+
+// ExportCursor is the position of a row in an export. The zero value starts
+// at the beginning.
+type ExportCursor struct {
+	Time time.Time
+	Id   string // Breaks ties between rows with the same time
+}
+
+// Whether a row at (t, id) comes after the cursor
+func (c ExportCursor) precedes(t time.Time, id string) bool {
+	return t.After(c.Time) || (t.Equal(c.Time) && id > c.Id)
+}
+
+type ExportedLink struct {
+	ShortCode   string
+	OriginalUrl string
+	CreatedAt   time.Time
+	Clicks      int64
+	Status      string
+	UTM         UTM
+}
+
+func (l ExportedLink) Cursor() ExportCursor {
+	return ExportCursor{Time: l.CreatedAt, Id: l.ShortCode}
+}
+
+type ExportedClick struct {
+	Id string
+	Click
+}
+
+func (c ExportedClick) Cursor() ExportCursor {
+	return ExportCursor{Time: c.ClickedAt, Id: c.Id}
+}
+
+// Status of a link as shown in exports
+func (l Link) exportStatus(now time.Time) string {
+	switch {
+	case l.IsQuarantined():
+		return LinkStatusQuarantined
+	case l.IsExpired(now):
+		return LinkStatusExpired
+	case !l.IsActive:
+		return LinkStatusInactive
+	default:
+		return LinkStatusActive
+	}
+}
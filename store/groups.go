@@ -0,0 +1,80 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Kinds of link groups
+const (
+	GroupTag      = "tag"      // Any number of tags per link
+	GroupCampaign = "campaign" // At most one campaign per link, like a folder
+)
+
+// Returned when a user already has a group of the same kind and name
+var ErrGroupNameTaken = errors.New("name already in use")
+
+// Group is a tag or campaign a user files links under
+type Group struct {
+	Id        string    `json:"id"`
+	UserId    string    `json:"user_id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	Links     int64     `json:"links"` // Links in the group that are not deleted
+}
+
+// GroupStore keeps a user's tags and campaigns and which links are in them.
+// Groups of another user are reported as ErrNotFound.
+type GroupStore interface {
+	CreateGroup(kind string, group Group) (Group, error)
+	// Groups of a kind owned by a user, by name
+	ListGroups(kind string, userId string) ([]Group, error)
+	RenameGroup(kind string, userId string, id string, name string) (Group, error)
+	// Links in a deleted group stay, they just leave the group
+	DeleteGroup(kind string, userId string, id string) error
+
+	// Replace the tags of a link
+	SetLinkTags(shortCode string, tagIds []string) error
+	// Move a link into a campaign, or out of its campaign with ""
+	SetLinkCampaign(shortCode string, campaignId string) error
+}
+
+// LinkListQuery selects a page of a user's links, newest first, optionally
+// only those with a tag or in a campaign
+type LinkListQuery struct {
+	UserId     string
+	TagId      string
+	CampaignId string
+	Before     ExportCursor // Zero starts at the newest link
+	Limit      int
+}
+
+// ListedLink is a link as shown in listings
+type ListedLink struct {
+	ExportedLink
+	Title      string
+	CampaignId string
+	TagIds     []string
+}
+
+// LinkLister pages through a user's links
+type LinkLister interface {
+	ListLinks(query LinkListQuery) ([]ListedLink, error)
+}
+
+// Whether a row at (t, id) comes after the cursor in newest first order
+func (c ExportCursor) follows(t time.Time, id string) bool {
+	if c.Time.IsZero() {
+		return true
+	}
+	return t.Before(c.Time) || (t.Equal(c.Time) && id < c.Id)
+}
+
+// Keeps group IDs created in the same nanosecond apart
+var groupSequence atomic.Uint64
+
+func generateGroupId(kind string) string {
+	return fmt.Sprintf("%s_%d_%d", kind, time.Now().UnixNano(), groupSequence.Add(1))
+}
@@ -0,0 +1,77 @@
+package store
+
+import "time"
+
+// Link is a short code together with its settings
+type Link struct {
+	ShortCode   string
+	OriginalUrl string
+	UserId      string
+	IsActive    bool
+	ExpiresAt   *time.Time
+	CustomAlias bool // The code was chosen by the user
+
+	// Hash of the password guarding the redirect, empty when unprotected
+	PasswordHash string
+	// Why the destination was held for review, empty when it was not
+	QuarantineReason string
+	// UTM parameters merged into OriginalUrl when the link was created
+	UTM UTM
+}
+
+func (l Link) IsProtected() bool {
+	return l.PasswordHash != ""
+}
+
+// A quarantined link does not redirect until it is released
+func (l Link) IsQuarantined() bool {
+	return l.QuarantineReason != ""
+}
+
+// Only links that redirect straight away may be cached: a cache hit skips
+// every other check
+func (l Link) isCacheable() bool {
+	return !l.IsProtected() && !l.IsQuarantined()
+}
+
+// A link with an expiry in the past no longer redirects
+func (l Link) IsExpired(now time.Time) bool {
+	return l.ExpiresAt != nil && !now.Before(*l.ExpiresAt)
+}
+
+// How long the link may stay in the cache: CacheDuration, capped at the
+// link's remaining lifetime
+func (l Link) cacheDuration() time.Duration {
+	if l.ExpiresAt == nil {
+		return CacheDuration
+	}
+	remaining := time.Until(*l.ExpiresAt)
+	if remaining < CacheDuration {
+		// Redis treats a zero TTL as "no expiry", so never go below a millisecond
+		if remaining < time.Millisecond {
+			return time.Millisecond
+		}
+		return remaining
+	}
+	return CacheDuration
+}
+
+// Whether saving link over existing would be a no-op: the same destination
+// for the same user, still live, unprotected, not quarantined and with the
+// same expiry.
+// Anything else means the code belongs to a different mapping.
+func (l Link) sameMapping(existing Link) bool {
+	if existing.OriginalUrl != l.OriginalUrl || existing.UserId != l.UserId {
+		return false
+	}
+	if !existing.isCacheable() || !l.isCacheable() {
+		return false
+	}
+	if !existing.IsActive || existing.IsExpired(time.Now()) {
+		return false
+	}
+	if existing.ExpiresAt == nil || l.ExpiresAt == nil {
+		return existing.ExpiresAt == nil && l.ExpiresAt == nil
+	}
+	return existing.ExpiresAt.Truncate(time.Millisecond).Equal(l.ExpiresAt.Truncate(time.Millisecond))
+}
@@ -0,0 +1,834 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+type memoryLink struct {
+	Link
+	createdAt time.Time
+	deleted   bool
+	metadata  *LinkMetadata
+
+	campaignId string
+	tagIds     []string
+}
+
+// MemoryStore keeps links and clicks in process memory. It needs no external
+// services, which makes it suitable for local development and handler tests.
+// Data does not survive a restart.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	links    map[string]memoryLink
+	versions map[string][]LinkVersion    // Oldest first
+	groups   map[string]map[string]Group // By kind, then ID
+	clicks   []Click
+	apiKeys  []APIKey
+	presets  []UTMPreset
+	domains  []Domain
+	sessions map[string]Session
+	users    map[string]User
+}
+
+// Initializing an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		links:    make(map[string]memoryLink),
+		versions: make(map[string][]LinkVersion),
+		groups:   map[string]map[string]Group{GroupTag: {}, GroupCampaign: {}},
+		sessions: make(map[string]Session),
+		users:    make(map[string]User),
+	}
+}
+
+func (m *MemoryStore) SaveUrlMapping(shortCode string, originalUrl string, userId string) error {
+	return m.SaveLink(Link{ShortCode: shortCode, OriginalUrl: originalUrl, UserId: userId})
+}
+
+func (m *MemoryStore) SaveLink(link Link) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.links[link.ShortCode]; ok {
+		if !link.sameMapping(existing.Link) {
+			return ErrShortCodeTaken
+		}
+		return nil
+	}
+
+	link.IsActive = true
+	m.links[link.ShortCode] = memoryLink{Link: link, createdAt: time.Now()}
+	return nil
+}
+
+func (m *MemoryStore) SaveLinks(links []Link) ([]error, error) {
+	results := make([]error, len(links))
+	for i, link := range links {
+		results[i] = m.SaveLink(link)
+	}
+	return results, nil
+}
+
+func (m *MemoryStore) RetrieveInitialUrl(shortCode string) string {
+	link, err := m.RetrieveLink(shortCode)
+	if err != nil || !link.IsActive || link.IsExpired(time.Now()) {
+		return ""
+	}
+	return link.OriginalUrl
+}
+
+func (m *MemoryStore) RetrieveLink(shortCode string) (Link, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	link, ok := m.links[shortCode]
+	if !ok || link.deleted {
+		return Link{}, ErrNotFound
+	}
+	return link.Link, nil
+}
+
+// There is no cache in front of the memory store
+func (m *MemoryStore) LoadLink(shortCode string) (Link, error) {
+	return m.RetrieveLink(shortCode)
+}
+
+func (m *MemoryStore) SetLinkActive(shortCode string, active bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	link, ok := m.links[shortCode]
+	if !ok || link.deleted {
+		return ErrNotFound
+	}
+	link.IsActive = active
+	m.links[shortCode] = link
+	return nil
+}
+
+func (m *MemoryStore) ReleaseLink(shortCode string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	link, ok := m.links[shortCode]
+	if !ok || link.deleted || !link.IsQuarantined() {
+		return ErrNotFound
+	}
+	link.QuarantineReason = ""
+	m.links[shortCode] = link
+	return nil
+}
+
+func (m *MemoryStore) SaveLinkMetadata(shortCode string, metadata LinkMetadata) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	link, ok := m.links[shortCode]
+	if !ok || link.deleted || link.OriginalUrl != metadata.OriginalUrl {
+		return ErrNotFound
+	}
+	link.metadata = &metadata
+	m.links[shortCode] = link
+	return nil
+}
+
+func (m *MemoryStore) ChangeDestination(shortCode string, change DestinationChange) (LinkVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	link, ok := m.links[shortCode]
+	if !ok || link.deleted {
+		return LinkVersion{}, ErrNotFound
+	}
+	version := LinkVersion{
+		Version:      len(m.versions[shortCode]) + 1,
+		OldUrl:       link.OriginalUrl,
+		NewUrl:       change.NewUrl,
+		ChangedBy:    change.ChangedBy,
+		ChangedAt:    time.Now(),
+		RolledBackTo: change.RolledBackTo,
+	}
+	m.versions[shortCode] = append(m.versions[shortCode], version)
+	link.OriginalUrl = change.NewUrl
+	link.QuarantineReason = change.QuarantineReason
+	link.UTM = change.UTM
+	link.metadata = nil
+	m.links[shortCode] = link
+	return version, nil
+}
+
+func (m *MemoryStore) LinkVersions(shortCode string) ([]LinkVersion, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stored := m.versions[shortCode]
+	versions := make([]LinkVersion, len(stored))
+	for i, version := range stored {
+		versions[len(stored)-1-i] = version
+	}
+	return versions, nil
+}
+
+func (m *MemoryStore) DeleteLink(shortCode string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	link, ok := m.links[shortCode]
+	if !ok || link.deleted {
+		return ErrNotFound
+	}
+	link.IsActive = false
+	link.deleted = true
+	m.links[shortCode] = link
+	return nil
+}
+
+func (m *MemoryStore) DeactivateExpiredLinks() (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	count := 0
+	for shortCode, link := range m.links {
+		if link.IsActive && link.IsExpired(now) {
+			link.IsActive = false
+			m.links[shortCode] = link
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *MemoryStore) IsShortCodeAvailable(shortCode string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, taken := m.links[shortCode]
+	return !taken, nil
+}
+
+func (m *MemoryStore) TrackUrlClick(shortCode string, userId string, ipAddress string, userAgent string, referer string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.links[shortCode]; !ok {
+		return ErrNotFound
+	}
+
+	m.clicks = append(m.clicks, Click{
+		ShortCode: shortCode,
+		UserId:    userId,
+		IpAddress: ipAddress,
+		UserAgent: userAgent,
+		Referer:   referer,
+		ClickedAt: time.Now(),
+	})
+	return nil
+}
+
+func (m *MemoryStore) WriteClicks(clicks []Click) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	written := 0
+	for _, click := range clicks {
+		if _, ok := m.links[click.ShortCode]; ok {
+			m.clicks = append(m.clicks, click)
+			written++
+		}
+	}
+	return written, nil
+}
+
+func (m *MemoryStore) LinkStats(query StatsQuery) (LinkStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	// Short codes whose clicks count
+	codes := make(map[string]bool)
+	if query.isGroup() {
+		for code, link := range m.links {
+			if !link.deleted && link.inGroups(query.TagId, query.CampaignId) {
+				codes[code] = true
+			}
+		}
+	} else if link, ok := m.links[query.ShortCode]; !ok || link.deleted {
+		return LinkStats{}, ErrNotFound
+	} else {
+		codes[query.ShortCode] = true
+	}
+
+	stats := LinkStats{}
+	uniqueIps := make(map[string]bool)
+	buckets := make(map[int64]StatsBucket)
+	bucketIps := make(map[int64]map[string]bool)
+	referrers := make(map[string]int64)
+	countries := make(map[string]int64)
+	devices := make(map[string]int64)
+	browsers := make(map[string]int64)
+	links := make(map[string]int64)
+
+	for _, click := range m.clicks {
+		if !codes[click.ShortCode] || click.ClickedAt.Before(query.From) || !click.ClickedAt.Before(query.To) {
+			continue
+		}
+		stats.TotalClicks++
+		if click.IpAddress != "" && !uniqueIps[click.IpAddress] {
+			uniqueIps[click.IpAddress] = true
+			stats.UniqueClicks++
+		}
+
+		key := BucketStart(click.ClickedAt, query.Interval, query.Location).Unix()
+		bucket := buckets[key]
+		bucket.Clicks++
+		if bucketIps[key] == nil {
+			bucketIps[key] = make(map[string]bool)
+		}
+		if click.IpAddress != "" && !bucketIps[key][click.IpAddress] {
+			bucketIps[key][click.IpAddress] = true
+			bucket.UniqueClicks++
+		}
+		buckets[key] = bucket
+
+		referrers[click.Referer]++
+		countries[click.Country]++
+		devices[click.Device]++
+		browsers[click.Browser]++
+		links[click.ShortCode]++
+	}
+
+	stats.Series = query.fillSeries(buckets)
+	stats.Referrers = topCounts(referrers, query.Limit)
+	stats.Countries = topCounts(countries, query.Limit)
+	stats.Devices = topCounts(devices, query.Limit)
+	stats.Browsers = topCounts(browsers, query.Limit)
+	if query.isGroup() {
+		stats.Links = topCounts(links, query.Limit)
+	}
+	return stats, nil
+}
+
+func (m *MemoryStore) CreateAPIKey(key APIKey) (APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key.Id = generateAPIKeyId()
+	key.CreatedAt = time.Now()
+	m.apiKeys = append(m.apiKeys, key)
+	return key, nil
+}
+
+func (m *MemoryStore) RetrieveAPIKey(keyHash string) (APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, key := range m.apiKeys {
+		if key.KeyHash == keyHash {
+			return key, nil
+		}
+	}
+	return APIKey{}, ErrNotFound
+}
+
+func (m *MemoryStore) ListAPIKeys(userId string) ([]APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := []APIKey{}
+	for i := len(m.apiKeys) - 1; i >= 0; i-- {
+		if m.apiKeys[i].UserId == userId {
+			keys = append(keys, m.apiKeys[i])
+		}
+	}
+	return keys, nil
+}
+
+func (m *MemoryStore) RevokeAPIKey(userId string, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, key := range m.apiKeys {
+		if key.Id == id && key.UserId == userId {
+			if key.RevokedAt == nil {
+				now := time.Now()
+				m.apiKeys[i].RevokedAt = &now
+			}
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *MemoryStore) TouchAPIKey(id string, usedAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, key := range m.apiKeys {
+		if key.Id == id {
+			m.apiKeys[i].LastUsedAt = &usedAt
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) RetrieveSession(sessionToken string) (Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	session, ok := m.sessions[sessionToken]
+	if !ok {
+		return Session{}, ErrNotFound
+	}
+	return session, nil
+}
+
+// SaveSession stands in for NextAuth signing a user in
+func (m *MemoryStore) SaveSession(sessionToken string, session Session) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[sessionToken] = session
+}
+
+func (m *MemoryStore) RetrieveUser(userId string) (User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[userId]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	return user, nil
+}
+
+func (m *MemoryStore) LinkUsage(userId string, since time.Time) (LinkUsage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var usage LinkUsage
+	for _, link := range m.links {
+		if link.UserId != userId {
+			continue
+		}
+		if !link.createdAt.Before(since) {
+			usage.LinksCreated++
+		}
+		if link.CustomAlias && !link.deleted {
+			usage.CustomAliases++
+		}
+	}
+	return usage, nil
+}
+
+func (m *MemoryStore) ExportLinks(userId string, after ExportCursor, limit int) ([]ExportedLink, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	clicks := make(map[string]int64)
+	for _, click := range m.clicks {
+		clicks[click.ShortCode]++
+	}
+	now := time.Now()
+	var links []ExportedLink
+	for _, link := range m.links {
+		if link.UserId != userId || link.deleted || !after.precedes(link.createdAt, link.ShortCode) {
+			continue
+		}
+		links = append(links, ExportedLink{
+			ShortCode:   link.ShortCode,
+			OriginalUrl: link.OriginalUrl,
+			CreatedAt:   link.createdAt,
+			Clicks:      clicks[link.ShortCode],
+			Status:      link.exportStatus(now),
+			UTM:         link.UTM,
+		})
+	}
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].Cursor().precedes(links[j].CreatedAt, links[j].ShortCode)
+	})
+	return links[:min(limit, len(links))], nil
+}
+
+func (m *MemoryStore) ExportClicks(userId string, from time.Time, to time.Time, after ExportCursor, limit int) ([]ExportedClick, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var clicks []ExportedClick
+	for i, click := range m.clicks {
+		// Positions stand in for IDs, padded so they sort as strings
+		id := fmt.Sprintf("%012d", i)
+		link := m.links[click.ShortCode]
+		if link.UserId != userId || click.ClickedAt.Before(from) || !click.ClickedAt.Before(to) || !after.precedes(click.ClickedAt, id) {
+			continue
+		}
+		clicks = append(clicks, ExportedClick{Id: id, Click: click})
+	}
+	sort.Slice(clicks, func(i, j int) bool {
+		return clicks[i].Cursor().precedes(clicks[j].ClickedAt, clicks[j].Id)
+	})
+	return clicks[:min(limit, len(clicks))], nil
+}
+
+// SaveUser stands in for the frontend creating or updating a user
+func (m *MemoryStore) SaveUser(user User) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.users[user.Id] = user
+}
+
+// Clicks returns a copy of the clicks recorded for a short code
+func (m *MemoryStore) Clicks(shortCode string) []Click {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var result []Click
+	for _, click := range m.clicks {
+		if click.ShortCode == shortCode {
+			result = append(result, click)
+		}
+	}
+	return result
+}
+
+func (m *MemoryStore) CreateGroup(kind string, group Group) (Group, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.groupNamed(kind, group.UserId, group.Name) != "" {
+		return Group{}, ErrGroupNameTaken
+	}
+	group.Id = generateGroupId(kind)
+	group.CreatedAt = time.Now()
+	group.Links = 0
+	m.groups[kind][group.Id] = group
+	return group, nil
+}
+
+func (m *MemoryStore) ListGroups(kind string, userId string) ([]Group, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	groups := []Group{}
+	for _, group := range m.groups[kind] {
+		if group.UserId == userId {
+			group.Links = m.groupLinks(kind, group.Id)
+			groups = append(groups, group)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups, nil
+}
+
+func (m *MemoryStore) RenameGroup(kind string, userId string, id string, name string) (Group, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	group, ok := m.groups[kind][id]
+	if !ok || group.UserId != userId {
+		return Group{}, ErrNotFound
+	}
+	if other := m.groupNamed(kind, userId, name); other != "" && other != id {
+		return Group{}, ErrGroupNameTaken
+	}
+	group.Name = name
+	m.groups[kind][id] = group
+	group.Links = m.groupLinks(kind, id)
+	return group, nil
+}
+
+func (m *MemoryStore) DeleteGroup(kind string, userId string, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	group, ok := m.groups[kind][id]
+	if !ok || group.UserId != userId {
+		return ErrNotFound
+	}
+	delete(m.groups[kind], id)
+	for code, link := range m.links {
+		if link.campaignId == id {
+			link.campaignId = ""
+		}
+		link.tagIds = without(link.tagIds, id)
+		m.links[code] = link
+	}
+	return nil
+}
+
+func (m *MemoryStore) SetLinkTags(shortCode string, tagIds []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	link, ok := m.links[shortCode]
+	if !ok || link.deleted {
+		return ErrNotFound
+	}
+	link.tagIds = nil
+	for _, id := range tagIds {
+		if _, ok := m.groups[GroupTag][id]; ok && !contains(link.tagIds, id) {
+			link.tagIds = append(link.tagIds, id)
+		}
+	}
+	sort.Strings(link.tagIds)
+	m.links[shortCode] = link
+	return nil
+}
+
+func (m *MemoryStore) SetLinkCampaign(shortCode string, campaignId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	link, ok := m.links[shortCode]
+	if !ok || link.deleted {
+		return ErrNotFound
+	}
+	if _, ok := m.groups[GroupCampaign][campaignId]; campaignId != "" && !ok {
+		return ErrNotFound
+	}
+	link.campaignId = campaignId
+	m.links[shortCode] = link
+	return nil
+}
+
+func (m *MemoryStore) ListLinks(query LinkListQuery) ([]ListedLink, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	clicks := make(map[string]int64)
+	for _, click := range m.clicks {
+		clicks[click.ShortCode]++
+	}
+	now := time.Now()
+	var links []ListedLink
+	for _, link := range m.links {
+		if link.UserId != query.UserId || link.deleted || !query.Before.follows(link.createdAt, link.ShortCode) {
+			continue
+		}
+		if !link.inGroups(query.TagId, query.CampaignId) {
+			continue
+		}
+		listed := ListedLink{
+			ExportedLink: ExportedLink{
+				ShortCode:   link.ShortCode,
+				OriginalUrl: link.OriginalUrl,
+				CreatedAt:   link.createdAt,
+				Clicks:      clicks[link.ShortCode],
+				Status:      link.exportStatus(now),
+				UTM:         link.UTM,
+			},
+			CampaignId: link.campaignId,
+			TagIds:     append([]string{}, link.tagIds...),
+		}
+		if link.metadata != nil {
+			listed.Title = link.metadata.Title
+		}
+		links = append(links, listed)
+	}
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].Cursor().follows(links[j].CreatedAt, links[j].ShortCode)
+	})
+	return links[:min(query.Limit, len(links))], nil
+}
+
+// Whether the link has the tag and is in the campaign; empty IDs match all
+func (m *MemoryStore) CreateUTMPreset(preset UTMPreset) (UTMPreset, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.presets {
+		if existing.UserId == preset.UserId && existing.Name == preset.Name {
+			return UTMPreset{}, ErrUTMPresetNameTaken
+		}
+	}
+	preset.Id = generateUTMPresetId()
+	preset.CreatedAt = time.Now()
+	m.presets = append(m.presets, preset)
+	return preset, nil
+}
+
+func (m *MemoryStore) RetrieveUTMPreset(userId string, id string) (UTMPreset, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, preset := range m.presets {
+		if preset.Id == id && preset.UserId == userId {
+			return preset, nil
+		}
+	}
+	return UTMPreset{}, ErrNotFound
+}
+
+func (m *MemoryStore) ListUTMPresets(userId string) ([]UTMPreset, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	presets := []UTMPreset{}
+	for _, preset := range m.presets {
+		if preset.UserId == userId {
+			presets = append(presets, preset)
+		}
+	}
+	sort.Slice(presets, func(i, j int) bool { return presets[i].Name < presets[j].Name })
+	return presets, nil
+}
+
+func (m *MemoryStore) DeleteUTMPreset(userId string, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, preset := range m.presets {
+		if preset.Id == id && preset.UserId == userId {
+			m.presets = append(m.presets[:i], m.presets[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *MemoryStore) CreateDomain(domain Domain) (Domain, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.domains {
+		if existing.Host == domain.Host && (existing.IsVerified() || existing.UserId == domain.UserId) {
+			return Domain{}, ErrDomainTaken
+		}
+	}
+	domain.Id = generateDomainId()
+	domain.CreatedAt = time.Now()
+	domain.VerifiedAt = nil
+	m.domains = append(m.domains, domain)
+	return domain, nil
+}
+
+func (m *MemoryStore) ListDomains(userId string) ([]Domain, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	domains := []Domain{}
+	for _, domain := range m.domains {
+		if domain.UserId == userId {
+			domains = append(domains, domain)
+		}
+	}
+	sort.Slice(domains, func(i, j int) bool { return domains[i].Host < domains[j].Host })
+	return domains, nil
+}
+
+func (m *MemoryStore) RetrieveVerifiedDomain(host string) (Domain, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, domain := range m.domains {
+		if domain.Host == host && domain.IsVerified() {
+			return domain, nil
+		}
+	}
+	return Domain{}, ErrNotFound
+}
+
+func (m *MemoryStore) VerifyDomain(userId string, id string, at time.Time) (Domain, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	index := -1
+	for i, domain := range m.domains {
+		if domain.Id == id && domain.UserId == userId {
+			index = i
+		}
+	}
+	if index < 0 {
+		return Domain{}, ErrNotFound
+	}
+	domain := m.domains[index]
+	if domain.IsVerified() {
+		return domain, nil
+	}
+	for _, other := range m.domains {
+		if other.Host == domain.Host && other.IsVerified() {
+			return Domain{}, ErrDomainTaken
+		}
+	}
+	domain.VerifiedAt = &at
+	m.domains[index] = domain
+	return domain, nil
+}
+
+func (m *MemoryStore) DeleteDomain(userId string, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, domain := range m.domains {
+		if domain.Id == id && domain.UserId == userId {
+			m.domains = append(m.domains[:i], m.domains[i+1:]...)
+			for code, link := range m.links {
+				if domainId, _ := SplitDomainCode(code); domainId == id {
+					link.deleted = true
+					m.links[code] = link
+				}
+			}
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (l memoryLink) inGroups(tagId string, campaignId string) bool {
+	return (tagId == "" || contains(l.tagIds, tagId)) && (campaignId == "" || l.campaignId == campaignId)
+}
+
+// ID of the user's group of a kind with this name, "" when there is none.
+// The caller holds the lock.
+func (m *MemoryStore) groupNamed(kind string, userId string, name string) string {
+	for id, group := range m.groups[kind] {
+		if group.UserId == userId && group.Name == name {
+			return id
+		}
+	}
+	return ""
+}
+
+// Links in a group that are not deleted. The caller holds the lock.
+func (m *MemoryStore) groupLinks(kind string, id string) int64 {
+	var count int64
+	for _, link := range m.links {
+		if link.deleted {
+			continue
+		}
+		if (kind == GroupTag && link.inGroups(id, "")) || (kind == GroupCampaign && link.inGroups("", id)) {
+			count++
+		}
+	}
+	return count
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func without(values []string, value string) []string {
+	var result []string
+	for _, v := range values {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// Metadata returns what was stored about a link's destination, nil when
+// nothing was
+func (m *MemoryStore) Metadata(shortCode string) *LinkMetadata {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.links[shortCode].metadata
+}
+
+func (m *MemoryStore) Close() {}
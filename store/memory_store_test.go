@@ -0,0 +1,74 @@
+package store
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreInsertionAndRetrieval(t *testing.T) {
+	memoryStore := NewMemoryStore()
+	initialLink := "https://www.guru3d.com/news-story/spotted-ryzen-threadripper-pro-3995wx-processor-with-8-channel-ddr4,2.html"
+	userUUId := "e0dba740-fc4b-4977-872c-d360239e6b1a"
+	shortURL := "Jsz4k57oAX"
+
+	assert.NoError(t, memoryStore.SaveUrlMapping(shortURL, initialLink, userUUId))
+	assert.Equal(t, initialLink, memoryStore.RetrieveInitialUrl(shortURL))
+	assert.Equal(t, "", memoryStore.RetrieveInitialUrl("missing"))
+}
+
+func TestMemoryStoreTrackUrlClick(t *testing.T) {
+	memoryStore := NewMemoryStore()
+	_ = memoryStore.SaveUrlMapping("abc12345", "https://example.com", "guest-user")
+
+	assert.NoError(t, memoryStore.TrackUrlClick("abc12345", "guest-user", "127.0.0.1", "test-agent", ""))
+	assert.ErrorIs(t, memoryStore.TrackUrlClick("missing", "guest-user", "127.0.0.1", "test-agent", ""), ErrNotFound)
+
+	clicks := memoryStore.Clicks("abc12345")
+	assert.Len(t, clicks, 1)
+	assert.Equal(t, "127.0.0.1", clicks[0].IpAddress)
+}
+
+func TestMemoryStoreNeverOverwrites(t *testing.T) {
+	memoryStore := NewMemoryStore()
+	assert.NoError(t, memoryStore.SaveUrlMapping("abc12345", "https://example.com/a", "user-1"))
+
+	// Saving the same mapping again is fine
+	assert.NoError(t, memoryStore.SaveUrlMapping("abc12345", "https://example.com/a", "user-1"))
+
+	assert.ErrorIs(t, memoryStore.SaveUrlMapping("abc12345", "https://example.com/b", "user-1"), ErrShortCodeTaken)
+	assert.ErrorIs(t, memoryStore.SaveUrlMapping("abc12345", "https://example.com/a", "user-2"), ErrShortCodeTaken)
+	assert.Equal(t, "https://example.com/a", memoryStore.RetrieveInitialUrl("abc12345"))
+}
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	memoryStore := NewMemoryStore()
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	_ = memoryStore.SaveLink(Link{ShortCode: "expired1", OriginalUrl: "https://example.com/a", ExpiresAt: &past})
+	_ = memoryStore.SaveLink(Link{ShortCode: "current1", OriginalUrl: "https://example.com/b", ExpiresAt: &future})
+
+	assert.Equal(t, "", memoryStore.RetrieveInitialUrl("expired1"))
+	assert.Equal(t, "https://example.com/b", memoryStore.RetrieveInitialUrl("current1"))
+
+	// An expired mapping is never handed out again, even to the same user
+	assert.ErrorIs(t, memoryStore.SaveLink(Link{ShortCode: "expired1", OriginalUrl: "https://example.com/a", ExpiresAt: &past}), ErrShortCodeTaken)
+
+	count, err := memoryStore.DeactivateExpiredLinks()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	link, err := memoryStore.RetrieveLink("expired1")
+	assert.NoError(t, err)
+	assert.False(t, link.IsActive)
+}
+
+func TestLinkCacheDuration(t *testing.T) {
+	assert.Equal(t, CacheDuration, Link{}.cacheDuration())
+
+	soon := time.Now().Add(time.Minute)
+	assert.LessOrEqual(t, Link{ExpiresAt: &soon}.cacheDuration(), time.Minute)
+
+	later := time.Now().Add(48 * time.Hour)
+	assert.Equal(t, CacheDuration, Link{ExpiresAt: &later}.cacheDuration())
+}
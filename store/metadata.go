@@ -0,0 +1,22 @@
+package store
+
+import "time"
+
+// LinkMetadata describes the page a link points to, as read from its HTML
+type LinkMetadata struct {
+	OriginalUrl string // The destination that was fetched
+	Title       string // og:title, else <title>
+	Description string // og:description, else the meta description
+	ImageUrl    string // og:image
+	SiteName    string // og:site_name
+	FaviconUrl  string
+	FetchedAt   time.Time
+}
+
+// MetadataStore keeps what was learned about a link's destination
+type MetadataStore interface {
+	// Store metadata fetched for a link. ErrNotFound when the link is gone
+	// or no longer points at metadata.OriginalUrl, so a slow fetch never
+	// describes a destination the link has moved away from.
+	SaveLinkMetadata(shortCode string, metadata LinkMetadata) error
+}
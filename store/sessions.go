@@ -0,0 +1,24 @@
+package store
+
+import "time"
+
+// Session is a NextAuth database session together with the user it belongs
+// to. The frontend writes sessions; the API only reads them.
+type Session struct {
+	UserId  string
+	Expires time.Time
+	Role    string // users.role: USER, ADMIN or MODERATOR
+	Email   string
+	Name    string
+}
+
+func (s Session) IsExpired(now time.Time) bool {
+	return !now.Before(s.Expires)
+}
+
+// SessionStore looks up sessions by their token
+type SessionStore interface {
+	// Returns ErrNotFound for unknown tokens. Expired sessions are returned
+	// and must be rejected by the caller.
+	RetrieveSession(sessionToken string) (Session, error)
+}
@@ -0,0 +1,135 @@
+package store
+
+import (
+	"sort"
+	"time"
+)
+
+// Bucket sizes for the click time series
+const (
+	IntervalHour = "hour"
+	IntervalDay  = "day"
+	IntervalWeek = "week"
+)
+
+// StatsStore computes click analytics from url_clicks
+type StatsStore interface {
+	LinkStats(query StatsQuery) (LinkStats, error)
+}
+
+// StatsQuery selects the clicks of one link, or of every link in a tag or
+// campaign, in [From, To). Buckets are aligned to Interval boundaries in
+// Location; weeks start on Monday.
+type StatsQuery struct {
+	ShortCode  string
+	TagId      string // Instead of ShortCode
+	CampaignId string // Instead of ShortCode
+	From       time.Time
+	To         time.Time
+	Interval   string
+	Location   *time.Location
+	Limit      int // Entries in each top list
+}
+
+// Whether the query covers a group of links rather than one
+func (q StatsQuery) isGroup() bool {
+	return q.TagId != "" || q.CampaignId != ""
+}
+
+type StatsBucket struct {
+	Start        time.Time `json:"start"`
+	Clicks       int64     `json:"clicks"`
+	UniqueClicks int64     `json:"unique_clicks"`
+}
+
+type StatsCount struct {
+	Value  string `json:"value"`
+	Clicks int64  `json:"clicks"`
+}
+
+// LinkStats are the analytics of one link over a time range. Unique clicks
+// are counted by distinct IP address.
+type LinkStats struct {
+	TotalClicks  int64         `json:"total_clicks"`
+	UniqueClicks int64         `json:"unique_clicks"`
+	Series       []StatsBucket `json:"series"`
+	Referrers    []StatsCount  `json:"top_referrers"`
+	Countries    []StatsCount  `json:"countries"`
+	Devices      []StatsCount  `json:"devices"`
+	Browsers     []StatsCount  `json:"browsers"`
+	// Links of a tag or campaign with the most clicks, by short code
+	Links []StatsCount `json:"top_links,omitempty"`
+}
+
+// Start of the bucket containing t
+func BucketStart(t time.Time, interval string, location *time.Location) time.Time {
+	t = t.In(location)
+	switch interval {
+	case IntervalHour:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, location)
+	case IntervalWeek:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, location)
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, location)
+	}
+}
+
+// Start of the bucket following the one starting at start
+func nextBucket(start time.Time, interval string) time.Time {
+	switch interval {
+	case IntervalHour:
+		return start.Add(time.Hour)
+	case IntervalWeek:
+		return start.AddDate(0, 0, 7)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// Whether the query spans more than max buckets. Counting stops right after
+// max, so that huge ranges are turned down without walking through them.
+func (q StatsQuery) SpansMoreBucketsThan(max int) bool {
+	count := 0
+	for start := BucketStart(q.From, q.Interval, q.Location); start.Before(q.To); start = nextBucket(start, q.Interval) {
+		count++
+		if count > max {
+			return true
+		}
+	}
+	return false
+}
+
+// Every bucket of the range in order, including those without clicks
+func (q StatsQuery) fillSeries(counted map[int64]StatsBucket) []StatsBucket {
+	series := []StatsBucket{}
+	for start := BucketStart(q.From, q.Interval, q.Location); start.Before(q.To); start = nextBucket(start, q.Interval) {
+		bucket, ok := counted[start.Unix()]
+		if !ok {
+			bucket = StatsBucket{}
+		}
+		bucket.Start = start
+		series = append(series, bucket)
+	}
+	return series
+}
+
+// Most frequent non-empty values, ties broken alphabetically
+func topCounts(counts map[string]int64, limit int) []StatsCount {
+	result := []StatsCount{}
+	for value, clicks := range counts {
+		if value != "" {
+			result = append(result, StatsCount{Value: value, Clicks: clicks})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Clicks != result[j].Clicks {
+			return result[i].Clicks > result[j].Clicks
+		}
+		return result[i].Value < result[j].Value
+	})
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
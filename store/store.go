@@ -0,0 +1,90 @@
+package store
+
+import (
+	"errors"
+	"log"
+)
+
+// Returned when a short code has no mapping in the store
+var ErrNotFound = errors.New("short url not found")
+
+// Returned when a short code is already mapped to a different URL or user
+var ErrShortCodeTaken = errors.New("short code already in use")
+
+// Returned by the Redis + Postgres backend for operations that cannot be
+// served from the cache alone while Postgres is unavailable
+var ErrRequiresDatabase = errors.New("this operation requires PostgreSQL")
+
+// LinkStore persists the mapping between a short code and the original URL.
+// SaveLink must never overwrite an existing mapping to a different URL or
+// user; it returns ErrShortCodeTaken instead. RetrieveLink returns
+// ErrNotFound for unknown codes.
+type LinkStore interface {
+	SaveLink(link Link) error
+	RetrieveLink(shortCode string) (Link, error)
+	// Like RetrieveLink but never served from the cache, whose entries only
+	// hold the destination. Use it whenever the owner matters.
+	LoadLink(shortCode string) (Link, error)
+	IsShortCodeAvailable(shortCode string) (bool, error)
+
+	// Changes take effect on the next redirect on every instance
+	SetLinkActive(shortCode string, active bool) error
+	// Soft-delete: the link stops resolving but its code is never reused
+	DeleteLink(shortCode string) error
+	// Clear the quarantine of a link held for review. ErrNotFound when the
+	// link does not exist or is not quarantined.
+	ReleaseLink(shortCode string) error
+}
+
+// LinkBatchSaver saves many links at once. Each link gets the outcome
+// SaveLink would have given it; the error is for failures of the whole
+// batch, in which case none of the links were saved.
+type LinkBatchSaver interface {
+	SaveLinks(links []Link) ([]error, error)
+}
+
+// ClickStore records redirect clicks for analytics
+type ClickStore interface {
+	TrackUrlClick(shortCode string, userId string, ipAddress string, userAgent string, referer string) error
+}
+
+// ClickWriter persists a batch of clicks in one go and reports how many were
+// written. Clicks for unknown short codes are skipped. Implementations must
+// not keep the slice.
+type ClickWriter interface {
+	WriteClicks(clicks []Click) (int, error)
+}
+
+// Store is implemented by backends that can serve both links and clicks
+type Store interface {
+	LinkStore
+	LinkBatchSaver
+	LinkVersionStore
+	ClickStore
+	ClickWriter
+	StatsStore
+	APIKeyStore
+	SessionStore
+	UserStore
+	UsageStore
+	ExportStore
+	GroupStore
+	LinkLister
+	UTMPresetStore
+	DomainStore
+	MetadataStore
+	LinkExpirer
+	Close()
+}
+
+// Open the backend selected by name. "memory" keeps everything in process,
+// anything else uses Redis + Postgres.
+func Open(backend string) Store {
+	switch backend {
+	case "memory":
+		log.Println("Using in-memory store backend")
+		return NewMemoryStore()
+	default:
+		return InitializeStore()
+	}
+}
@@ -2,12 +2,16 @@ package store
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/joho/godotenv"
 	"github.com/go-redis/redis"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"log"
 	"os"
+	"sync/atomic"
 	"time"
 )
 func init() {
@@ -20,11 +24,8 @@ type StorageService struct {
 	dbPool      *pgxpool.Pool
 }
 
-// Top level declarations for the storeService and Redis context
-var (
-	storeService = &StorageService{}
-	ctx           = context.Background()
-)
+// Top level declaration for the Redis/Postgres context
+var ctx = context.Background()
 
 // Note that in a real world usage, the cache duration shouldn't have  
 // an expiration time, an LRU policy config should be set where the 
@@ -33,8 +34,28 @@ var (
 
 const CacheDuration = 6 * time.Hour
 
+// How long a short code stays marked as invalidated after a change. Readers
+// that loaded the old row before the change will not re-cache it meanwhile.
+const invalidationWindow = 10 * time.Second
+
+// Redis key marking a short code as recently changed
+func invalidationKey(shortCode string) string {
+	return "invalidated:" + shortCode
+}
+
+// Cache a destination unless the code was invalidated in the meantime
+var cacheIfValidScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[2]) == 1 then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+return 1
+`)
+
 // Initializing the store service and return a store pointer 
 func InitializeStore() *StorageService {
+	storeService := &StorageService{}
+
 	redisClient := redis.NewClient(&redis.Options{
 		Addr:     "localhost:6379",
 		Password: "",
@@ -100,21 +121,28 @@ func InitializeStore() *StorageService {
 /* We want to be able to save the mapping between the originalUrl 
 and the generated shortUrl url
 */
-func SaveUrlMapping(shortCode string, originalUrl string, userId string) error {
-	log.Printf("SaveUrlMapping called with: shortCode=%s, originalUrl=%s, userId=%s", shortCode, originalUrl, userId)
-	
-	// Save to Redis first (non-blocking)
-	if storeService.redisClient != nil {
-		err := storeService.redisClient.Set(shortCode, originalUrl, CacheDuration).Err()
-	if err != nil {
-			log.Printf("Warning: Failed saving to Redis | Error: %v - shortCode: %s", err, shortCode)
-			// Continue even if Redis fails
-		} else {
-			log.Printf("Successfully saved to Redis: %s", shortCode)
-	}
+func (storeService *StorageService) SaveUrlMapping(shortCode string, originalUrl string, userId string) error {
+	return storeService.SaveLink(Link{ShortCode: shortCode, OriginalUrl: originalUrl, UserId: userId})
+}
+
+/* Save a link with its settings. An existing short code is never
+repointed: if it already maps to a different URL or user,
+ErrShortCodeTaken is returned so the caller can try another code.
+*/
+func (storeService *StorageService) SaveLink(link Link) error {
+	shortCode, originalUrl, userId := link.ShortCode, link.OriginalUrl, link.UserId
+	log.Printf("SaveLink called with: shortCode=%s, originalUrl=%s, userId=%s", shortCode, originalUrl, userId)
+
+	// Protected and quarantined links are never cached, so they need
+	// Postgres to live in
+	if !link.isCacheable() && storeService.dbPool == nil {
+		return ErrRequiresDatabase
 	}
-	
-	// Save to Postgres if available (using camelCase columns as in actual database)
+
+	// Postgres is the source of truth for which code belongs to whom. When it
+	// fails the link is not saved at all: a Redis-only link would redirect
+	// until its cache entry expires and then vanish.
+	savedToPostgres := false
 	if storeService.dbPool != nil {
 		log.Printf("Attempting to save to PostgreSQL...")
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -124,135 +152,1562 @@ func SaveUrlMapping(shortCode string, originalUrl string, userId string) error {
 		urlId := generateUrlId()
 		log.Printf("Generated URL ID: %s", urlId)
 
-		query := `INSERT INTO urls (id, "shortCode", "originalUrl", "userId", "createdAt", "updatedAt") 
-			 VALUES ($1, $2, $3, $4, NOW(), NOW())
-			 ON CONFLICT ("shortCode") DO UPDATE SET 
-			 "originalUrl" = EXCLUDED."originalUrl", 
-			 "userId" = EXCLUDED."userId", 
-			 "updatedAt" = NOW()`
-		
-		log.Printf("Executing query: %s", query)
-		log.Printf("With values: urlId=%s, shortCode=%s, originalUrl=%s, userId=%s", urlId, shortCode, originalUrl, userId)
-
-		result, err := storeService.dbPool.Exec(ctx, query, urlId, shortCode, originalUrl, userId)
-	if err != nil {
+		result, err := storeService.dbPool.Exec(ctx, insertLinkQuery, insertLinkArgs(urlId, link)...)
+		if err != nil {
 			log.Printf("Error: Failed saving to Postgres | Error: %v - shortCode: %s", err, shortCode)
-			log.Printf("Full error details: %+v", err)
-			// If Postgres fails but Redis succeeded, still return success
-			if storeService.redisClient != nil {
-				log.Printf("Returning success because Redis succeeded, even though Postgres failed")
-				return nil
-			}
 			return fmt.Errorf("database error: %v", err)
+		} else if result.RowsAffected() == 0 {
+			// The code already exists, only the very same mapping may reuse it
+			existing, err := scanLinkMapping(storeService.dbPool.QueryRow(ctx,
+				`SELECT `+linkMappingColumns+` FROM urls WHERE "shortCode" = $1`, shortCode))
+			if err != nil {
+				return fmt.Errorf("database error: %v", err)
+			}
+			if !link.sameMapping(existing) {
+				log.Printf("Short code %s is already mapped to another URL", shortCode)
+				return ErrShortCodeTaken
+			}
+			savedToPostgres = true
+		} else {
+			log.Printf("Successfully saved to PostgreSQL: %s", shortCode)
+			savedToPostgres = true
 		}
-		
-		rowsAffected := result.RowsAffected()
-		log.Printf("Successfully saved to PostgreSQL. Rows affected: %d", rowsAffected)
 	} else {
 		log.Printf("Warning: No PostgreSQL connection available")
 	}
-	
-	log.Printf("SaveUrlMapping completed successfully")
-	// Success if we saved to at least one storage
+
+	if storeService.redisClient != nil && !link.isCacheable() && savedToPostgres {
+		// Make sure no stale cache entry lets the redirect skip the password
+		// or the review
+		_ = storeService.redisClient.Del(shortCode).Err()
+	}
+
+	if storeService.redisClient != nil && link.isCacheable() {
+		if savedToPostgres {
+			// Postgres confirmed the code is ours, so refresh whatever is cached
+			err := storeService.redisClient.Set(shortCode, originalUrl, link.cacheDuration()).Err()
+			if err != nil {
+				log.Printf("Warning: Failed saving to Redis | Error: %v - shortCode: %s", err, shortCode)
+			}
+		} else {
+			// Without Postgres, Redis decides who owns the code
+			created, err := storeService.redisClient.SetNX(shortCode, originalUrl, link.cacheDuration()).Result()
+			if err != nil {
+				log.Printf("Warning: Failed saving to Redis | Error: %v - shortCode: %s", err, shortCode)
+			} else if !created {
+				existingUrl, err := storeService.redisClient.Get(shortCode).Result()
+				if err == nil && existingUrl != originalUrl {
+					log.Printf("Short code %s is already mapped to another URL", shortCode)
+					return ErrShortCodeTaken
+				}
+			} else {
+				log.Printf("Successfully saved to Redis: %s", shortCode)
+			}
+		}
+	}
+
+	log.Printf("SaveLink completed successfully")
 	return nil
 }
 
+// Inserts a link unless its code exists. Arguments come from
+// insertLinkArgs.
+const insertLinkQuery = `INSERT INTO urls (id, "shortCode", "originalUrl", "userId", "expiresAt", password, "isCustomAlias", "quarantineReason",
+	                   "utmSource", "utmMedium", "utmCampaign", "utmTerm", "utmContent", "createdAt", "updatedAt") 
+	 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, NOW(), NOW())
+	 ON CONFLICT ("shortCode") DO NOTHING`
+
+func insertLinkArgs(urlId string, link Link) []interface{} {
+	var passwordHash interface{}
+	if link.IsProtected() {
+		passwordHash = link.PasswordHash
+	}
+	return []interface{}{urlId, link.ShortCode, link.OriginalUrl, link.UserId, link.ExpiresAt,
+		passwordHash, link.CustomAlias, nullIfEmpty(link.QuarantineReason),
+		nullIfEmpty(link.UTM.Source), nullIfEmpty(link.UTM.Medium), nullIfEmpty(link.UTM.Campaign),
+		nullIfEmpty(link.UTM.Term), nullIfEmpty(link.UTM.Content)}
+}
+
+// UTM columns of urls u, in the order of the UTM fields
+const utmColumns = `COALESCE(u."utmSource", ''), COALESCE(u."utmMedium", ''), COALESCE(u."utmCampaign", ''),
+		        COALESCE(u."utmTerm", ''), COALESCE(u."utmContent", '')`
+
+// Columns compared by Link.sameMapping, read with scanLinkMapping
+const linkMappingColumns = `"shortCode", "originalUrl", COALESCE("userId", ''), COALESCE("isActive", true), "expiresAt", COALESCE(password, ''), COALESCE("quarantineReason", '')`
+
+func scanLinkMapping(row pgx.Row) (Link, error) {
+	var link Link
+	err := row.Scan(&link.ShortCode, &link.OriginalUrl, &link.UserId, &link.IsActive, &link.ExpiresAt, &link.PasswordHash, &link.QuarantineReason)
+	return link, err
+}
+
+/* Save many links in one transaction. Links are inserted in a single
+batch; codes that already exist are compared with the existing mapping
+afterwards, just like SaveLink does one by one.
+*/
+func (storeService *StorageService) SaveLinks(links []Link) ([]error, error) {
+	results := make([]error, len(links))
+	if storeService.dbPool == nil {
+		// Without Postgres there is no transaction to share
+		for i, link := range links {
+			results[i] = storeService.SaveLink(link)
+		}
+		return results, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := storeService.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	batch := &pgx.Batch{}
+	for _, link := range links {
+		batch.Queue(insertLinkQuery, insertLinkArgs(generateUrlId(), link)...)
+	}
+	batchResults := tx.SendBatch(ctx, batch)
+	var conflicts []string
+	conflicted := make(map[int]bool)
+	for i, link := range links {
+		result, err := batchResults.Exec()
+		if err != nil {
+			batchResults.Close()
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		if result.RowsAffected() == 0 {
+			conflicted[i] = true
+			conflicts = append(conflicts, link.ShortCode)
+		}
+	}
+	if err := batchResults.Close(); err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+
+	// Codes that were taken before, or earlier in this batch
+	if len(conflicts) > 0 {
+		rows, err := tx.Query(ctx, `SELECT `+linkMappingColumns+` FROM urls WHERE "shortCode" = ANY($1)`, conflicts)
+		if err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		existing, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Link, error) {
+			return scanLinkMapping(row)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("database error: %v", err)
+		}
+		byCode := make(map[string]Link, len(existing))
+		for _, link := range existing {
+			byCode[link.ShortCode] = link
+		}
+		for i := range conflicted {
+			if !links[i].sameMapping(byCode[links[i].ShortCode]) {
+				results[i] = ErrShortCodeTaken
+			}
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+
+	if storeService.redisClient != nil {
+		for i, link := range links {
+			if results[i] != nil {
+				continue
+			}
+			if link.isCacheable() {
+				err = storeService.redisClient.Set(link.ShortCode, link.OriginalUrl, link.cacheDuration()).Err()
+			} else {
+				err = storeService.redisClient.Del(link.ShortCode).Err()
+			}
+			if err != nil {
+				log.Printf("Warning: Failed updating Redis | Error: %v - shortCode: %s", err, link.ShortCode)
+			}
+		}
+	}
+	return results, nil
+}
+
 /*
 We should be able to retrieve the initial long URL once the short 
 is provided. This is when users will be calling the shortlink in the 
 url, so what we need to do here is to retrieve the long url and
 think about redirect.
 */
-func RetrieveInitialUrl(shortCode string) string {
-	// Try Redis first
+func (storeService *StorageService) RetrieveInitialUrl(shortCode string) string {
+	link, err := storeService.RetrieveLink(shortCode)
+	if err != nil || !link.IsActive || link.IsExpired(time.Now()) {
+		return ""
+	}
+	return link.OriginalUrl
+}
+
+// Retrieve a link with its settings. Inactive and expired links are
+// returned as well so the caller can tell them apart from unknown codes.
+func (storeService *StorageService) RetrieveLink(shortCode string) (Link, error) {
+	// Try Redis first. Only live, unprotected links are cached and their
+	// TTL never outlasts the expiry, so a hit is always active and open.
 	if storeService.redisClient != nil {
 		result, err := storeService.redisClient.Get(shortCode).Result()
-	if err == nil {
-		return result
+		if err == nil {
+			return Link{ShortCode: shortCode, OriginalUrl: result, IsActive: true}, nil
+		}
+	}
+
+	// If not found in Redis, try Postgres
+	if storeService.dbPool == nil {
+		return Link{}, ErrNotFound
 	}
+	return storeService.LoadLink(shortCode)
+}
+
+// Read a link with its owner from Postgres, skipping the cache. Without
+// Postgres there is no owner to report, so this fails with
+// ErrRequiresDatabase.
+func (storeService *StorageService) LoadLink(shortCode string) (Link, error) {
+	if storeService.dbPool == nil {
+		return Link{}, ErrRequiresDatabase
 	}
 
-	// If not found in Redis, try Postgres (using camelCase columns)
-	if storeService.dbPool != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// camelCase columns, as created by Prisma
+	link := Link{ShortCode: shortCode}
+	err := storeService.dbPool.QueryRow(ctx,
+		`SELECT "originalUrl", COALESCE("userId", ''), COALESCE("isActive", true), "expiresAt", COALESCE(password, ''), COALESCE("quarantineReason", '') FROM urls WHERE "shortCode" = $1 AND "deletedAt" IS NULL`,
+		shortCode).Scan(&link.OriginalUrl, &link.UserId, &link.IsActive, &link.ExpiresAt, &link.PasswordHash, &link.QuarantineReason)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Link{}, ErrNotFound
+	}
+	if err != nil {
+		log.Printf("Warning: Failed RetrieveLink from Postgres | Error: %v - shortCode: %s", err, shortCode)
+		return Link{}, fmt.Errorf("database error: %v", err)
+	}
 
-	var originalUrl string
-		err := storeService.dbPool.QueryRow(ctx, 
-			`SELECT "originalUrl" FROM urls WHERE "shortCode" = $1 AND "isActive" = true`, 
-			shortCode).Scan(&originalUrl)
+	// Cache in Redis for future requests, but never the destination of a
+	// protected or quarantined link
+	if storeService.redisClient != nil && link.IsActive && link.isCacheable() && !link.IsExpired(time.Now()) {
+		err := cacheIfValidScript.Run(storeService.redisClient,
+			[]string{shortCode, invalidationKey(shortCode)},
+			link.OriginalUrl, link.cacheDuration().Milliseconds()).Err()
 		if err != nil {
-			log.Printf("Warning: Failed RetrieveInitialUrl from Postgres | Error: %v - shortCode: %s", err, shortCode)
-			return ""
+			log.Printf("Warning: Failed caching short URL in Redis | Error: %v - shortCode: %s", err, shortCode)
 		}
+	}
+	return link, nil
+}
 
-		// Cache in Redis for future requests
-		if storeService.redisClient != nil {
-			_ = storeService.redisClient.Set(shortCode, originalUrl, CacheDuration).Err()
+// Activate or deactivate a link and drop it from the cache
+func (storeService *StorageService) SetLinkActive(shortCode string, active bool) error {
+	if storeService.dbPool == nil {
+		// Without Postgres the cache is all there is: deactivating removes
+		// the entry for good and there is nothing to bring back
+		if active {
+			return ErrRequiresDatabase
 		}
-		return originalUrl
+		return storeService.invalidateCache(shortCode)
 	}
 
-	return ""
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := storeService.dbPool.Exec(ctx,
+		`UPDATE urls SET "isActive" = $2, "updatedAt" = NOW() WHERE "shortCode" = $1 AND "deletedAt" IS NULL`,
+		shortCode, active)
+	if err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return storeService.invalidateCache(shortCode)
 }
 
-// Track URL click for analytics
-func TrackUrlClick(shortCode string, userId string, ipAddress string, userAgent string, referer string) error {
+// Release a quarantined link so that it redirects
+func (storeService *StorageService) ReleaseLink(shortCode string) error {
 	if storeService.dbPool == nil {
-		return nil // Skip tracking if no database
+		return ErrNotFound
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// First get the URL ID using correct quoted column name
+	result, err := storeService.dbPool.Exec(ctx,
+		`UPDATE urls SET "quarantineReason" = NULL, "updatedAt" = NOW()
+		 WHERE "shortCode" = $1 AND "deletedAt" IS NULL AND "quarantineReason" IS NOT NULL`,
+		shortCode)
+	if err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return storeService.invalidateCache(shortCode)
+}
+
+// Store a link's destination metadata. The cache holds destinations only,
+// so it is left alone.
+func (storeService *StorageService) SaveLinkMetadata(shortCode string, metadata LinkMetadata) error {
+	if storeService.dbPool == nil {
+		return ErrRequiresDatabase
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := storeService.dbPool.Exec(ctx,
+		`UPDATE urls SET title = NULLIF($3, ''), description = NULLIF($4, ''), "imageUrl" = NULLIF($5, ''),
+		        "siteName" = NULLIF($6, ''), "faviconUrl" = NULLIF($7, ''), "metadataFetchedAt" = $8
+		 WHERE "shortCode" = $1 AND "originalUrl" = $2 AND "deletedAt" IS NULL`,
+		shortCode, metadata.OriginalUrl, metadata.Title, metadata.Description, metadata.ImageUrl,
+		metadata.SiteName, metadata.FaviconUrl, metadata.FetchedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Soft-delete a link and drop it from the cache
+func (storeService *StorageService) DeleteLink(shortCode string) error {
+	if storeService.dbPool == nil {
+		return storeService.invalidateCache(shortCode)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := storeService.dbPool.Exec(ctx,
+		`UPDATE urls SET "isActive" = false, "deletedAt" = NOW(), "updatedAt" = NOW() WHERE "shortCode" = $1 AND "deletedAt" IS NULL`,
+		shortCode)
+	if err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return storeService.invalidateCache(shortCode)
+}
+
+/* Point a link at a new destination and record the change in
+url_versions, in one transaction. The row lock keeps version numbers
+gapless when changes race. Metadata described the old destination, so it
+is cleared.
+*/
+func (storeService *StorageService) ChangeDestination(shortCode string, change DestinationChange) (LinkVersion, error) {
+	if storeService.dbPool == nil {
+		return LinkVersion{}, ErrRequiresDatabase
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := storeService.dbPool.Begin(ctx)
+	if err != nil {
+		return LinkVersion{}, fmt.Errorf("database error: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
 	var urlId string
-	err := storeService.dbPool.QueryRow(ctx, 
-		`SELECT id FROM urls WHERE "shortCode" = $1`, 
-		shortCode).Scan(&urlId)
+	version := LinkVersion{
+		NewUrl:       change.NewUrl,
+		ChangedBy:    change.ChangedBy,
+		ChangedAt:    time.Now().UTC(),
+		RolledBackTo: change.RolledBackTo,
+	}
+	err = tx.QueryRow(ctx,
+		`SELECT id, "originalUrl" FROM urls WHERE "shortCode" = $1 AND "deletedAt" IS NULL FOR UPDATE`,
+		shortCode).Scan(&urlId, &version.OldUrl)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return LinkVersion{}, ErrNotFound
+	}
 	if err != nil {
-		log.Printf("Warning: Failed to find URL for tracking | Error: %v - shortCode: %s", err, shortCode)
-		return err
+		return LinkVersion{}, fmt.Errorf("database error: %v", err)
+	}
+	err = tx.QueryRow(ctx,
+		`SELECT COALESCE(MAX(version), 0) + 1 FROM url_versions WHERE "urlId" = $1`, urlId).Scan(&version.Version)
+	if err != nil {
+		return LinkVersion{}, fmt.Errorf("database error: %v", err)
 	}
 
-	// Generate click ID
-	clickId := generateClickId()
+	_, err = tx.Exec(ctx,
+		`INSERT INTO url_versions (id, "urlId", version, "oldUrl", "newUrl", "changedBy", "changedAt", "rolledBackTo")
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		generateVersionId(), urlId, version.Version, version.OldUrl, version.NewUrl, version.ChangedBy,
+		version.ChangedAt, version.RolledBackTo)
+	if err != nil {
+		return LinkVersion{}, fmt.Errorf("database error: %v", err)
+	}
+	_, err = tx.Exec(ctx,
+		`UPDATE urls SET "originalUrl" = $2, "quarantineReason" = $3, title = NULL, description = NULL,
+		        "imageUrl" = NULL, "siteName" = NULL, "faviconUrl" = NULL, "metadataFetchedAt" = NULL,
+		        "utmSource" = $4, "utmMedium" = $5, "utmCampaign" = $6, "utmTerm" = $7, "utmContent" = $8, "updatedAt" = NOW()
+		 WHERE id = $1`,
+		urlId, change.NewUrl, nullIfEmpty(change.QuarantineReason),
+		nullIfEmpty(change.UTM.Source), nullIfEmpty(change.UTM.Medium), nullIfEmpty(change.UTM.Campaign),
+		nullIfEmpty(change.UTM.Term), nullIfEmpty(change.UTM.Content))
+	if err != nil {
+		return LinkVersion{}, fmt.Errorf("database error: %v", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return LinkVersion{}, fmt.Errorf("database error: %v", err)
+	}
+	return version, storeService.invalidateCache(shortCode)
+}
 
-	// Handle guest users - use NULL instead of "guest-user" to avoid foreign key constraint
-	var userIdParam interface{}
-	if userId == "guest-user" || userId == "" {
-		userIdParam = nil // Use NULL for guest users
-	} else {
-		userIdParam = userId
+// Changes of a link's destination, newest first
+func (storeService *StorageService) LinkVersions(shortCode string) ([]LinkVersion, error) {
+	if storeService.dbPool == nil {
+		return nil, ErrRequiresDatabase
 	}
 
-	// Insert click record using the correct camelCase column names
-	_, err = storeService.dbPool.Exec(ctx,
-		`INSERT INTO url_clicks (id, "urlId", "userId", "ipAddress", "userAgent", referer, "clickedAt") 
-		 VALUES ($1, $2, $3, $4, $5, $6, NOW())`,
-		clickId, urlId, userIdParam, ipAddress, userAgent, referer,
-	)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := storeService.dbPool.Query(ctx,
+		`SELECT v.version, v."oldUrl", v."newUrl", v."changedBy", v."changedAt", v."rolledBackTo"
+		 FROM url_versions v JOIN urls u ON u.id = v."urlId"
+		 WHERE u."shortCode" = $1
+		 ORDER BY v.version DESC`,
+		shortCode)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	versions, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (LinkVersion, error) {
+		var version LinkVersion
+		err := row.Scan(&version.Version, &version.OldUrl, &version.NewUrl, &version.ChangedBy, &version.ChangedAt, &version.RolledBackTo)
+		return version, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	return versions, nil
+}
+
+// Table of each kind of group and how its links are counted
+var groupTables = map[string]struct {
+	table string
+	links string // Links of group g that are not deleted
+}{
+	GroupTag: {"tags",
+		`(SELECT COUNT(*) FROM url_tags t JOIN urls u ON u.id = t."urlId" WHERE t."tagId" = g.id AND u."deletedAt" IS NULL)`},
+	GroupCampaign: {"campaigns",
+		`(SELECT COUNT(*) FROM urls u WHERE u."campaignId" = g.id AND u."deletedAt" IS NULL)`},
+}
+
+func groupTable(kind string) (string, string, error) {
+	table, ok := groupTables[kind]
+	if !ok {
+		return "", "", fmt.Errorf("unknown group kind %q", kind)
+	}
+	return table.table, table.links, nil
+}
+
+func scanGroup(row pgx.CollectableRow) (Group, error) {
+	var group Group
+	err := row.Scan(&group.Id, &group.UserId, &group.Name, &group.CreatedAt, &group.Links)
+	return group, err
+}
+
+// Whether err is a Postgres error with the given SQLSTATE code
+func isPgError(err error, code string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == code
+}
+
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+)
+
+func (storeService *StorageService) CreateGroup(kind string, group Group) (Group, error) {
+	if storeService.dbPool == nil {
+		return Group{}, ErrRequiresDatabase
+	}
+	table, _, err := groupTable(kind)
+	if err != nil {
+		return Group{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	group.Id = generateGroupId(kind)
+	group.CreatedAt = time.Now().UTC()
+	group.Links = 0
+	result, err := storeService.dbPool.Exec(ctx,
+		fmt.Sprintf(`INSERT INTO %s (id, "userId", name, "createdAt") VALUES ($1, $2, $3, $4)
+		 ON CONFLICT ("userId", name) DO NOTHING`, table),
+		group.Id, group.UserId, group.Name, group.CreatedAt)
+	if err != nil {
+		return Group{}, fmt.Errorf("database error: %v", err)
+	}
+	if result.RowsAffected() == 0 {
+		return Group{}, ErrGroupNameTaken
+	}
+	return group, nil
+}
+
+func (storeService *StorageService) ListGroups(kind string, userId string) ([]Group, error) {
+	if storeService.dbPool == nil {
+		return nil, ErrRequiresDatabase
+	}
+	table, links, err := groupTable(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := storeService.dbPool.Query(ctx,
+		fmt.Sprintf(`SELECT g.id, g."userId", g.name, g."createdAt", %s FROM %s g
+		 WHERE g."userId" = $1 ORDER BY g.name`, links, table),
+		userId)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	groups, err := pgx.CollectRows(rows, scanGroup)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	return groups, nil
+}
+
+func (storeService *StorageService) RenameGroup(kind string, userId string, id string, name string) (Group, error) {
+	if storeService.dbPool == nil {
+		return Group{}, ErrRequiresDatabase
+	}
+	table, links, err := groupTable(kind)
+	if err != nil {
+		return Group{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := storeService.dbPool.Query(ctx,
+		fmt.Sprintf(`UPDATE %s g SET name = $3 WHERE g.id = $1 AND g."userId" = $2
+		 RETURNING g.id, g."userId", g.name, g."createdAt", %s`, table, links),
+		id, userId, name)
+	if err != nil {
+		return Group{}, fmt.Errorf("database error: %v", err)
+	}
+	group, err := pgx.CollectOneRow(rows, scanGroup)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return Group{}, ErrNotFound
+	case isPgError(err, pgUniqueViolation):
+		return Group{}, ErrGroupNameTaken
+	case err != nil:
+		return Group{}, fmt.Errorf("database error: %v", err)
+	}
+	return group, nil
+}
+
+// Links leave a deleted group through the foreign keys: url_tags rows are
+// removed and "campaignId" is set to NULL
+func (storeService *StorageService) DeleteGroup(kind string, userId string, id string) error {
+	if storeService.dbPool == nil {
+		return ErrRequiresDatabase
+	}
+	table, _, err := groupTable(kind)
 	if err != nil {
-		log.Printf("Warning: Failed tracking URL click | Error: %v - shortCode: %s", err, shortCode)
 		return err
 	}
 
-	log.Printf("Successfully tracked click for short URL: %s", shortCode)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := storeService.dbPool.Exec(ctx,
+		fmt.Sprintf(`DELETE FROM %s WHERE id = $1 AND "userId" = $2`, table), id, userId)
+	if err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
 	return nil
 }
 
-// Helper function to generate URL ID (simple implementation)
-func generateUrlId() string {
-	return fmt.Sprintf("url_%d", time.Now().UnixNano())
-}
+// Replace the tags of a link in one transaction. Unknown tag IDs are
+// skipped.
+func (storeService *StorageService) SetLinkTags(shortCode string, tagIds []string) error {
+	if storeService.dbPool == nil {
+		return ErrRequiresDatabase
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := storeService.dbPool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var urlId string
+	err = tx.QueryRow(ctx,
+		`SELECT id FROM urls WHERE "shortCode" = $1 AND "deletedAt" IS NULL FOR UPDATE`, shortCode).Scan(&urlId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM url_tags WHERE "urlId" = $1`, urlId); err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+	_, err = tx.Exec(ctx,
+		`INSERT INTO url_tags ("urlId", "tagId") SELECT $1, id FROM tags WHERE id = ANY($2)`,
+		urlId, tagIds)
+	if err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+	return nil
+}
+
+func (storeService *StorageService) SetLinkCampaign(shortCode string, campaignId string) error {
+	if storeService.dbPool == nil {
+		return ErrRequiresDatabase
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := storeService.dbPool.Exec(ctx,
+		`UPDATE urls SET "campaignId" = $2, "updatedAt" = NOW() WHERE "shortCode" = $1 AND "deletedAt" IS NULL`,
+		shortCode, nullIfEmpty(campaignId))
+	if isPgError(err, pgForeignKeyViolation) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Columns of utm_presets p, read with scanUTMPreset
+const utmPresetColumns = `p.id, p."userId", p.name, COALESCE(p."utmSource", ''), COALESCE(p."utmMedium", ''),
+		 COALESCE(p."utmCampaign", ''), COALESCE(p."utmTerm", ''), COALESCE(p."utmContent", ''), p."createdAt"`
+
+func scanUTMPreset(row pgx.CollectableRow) (UTMPreset, error) {
+	var preset UTMPreset
+	err := row.Scan(&preset.Id, &preset.UserId, &preset.Name, &preset.UTM.Source, &preset.UTM.Medium,
+		&preset.UTM.Campaign, &preset.UTM.Term, &preset.UTM.Content, &preset.CreatedAt)
+	return preset, err
+}
+
+func (storeService *StorageService) CreateUTMPreset(preset UTMPreset) (UTMPreset, error) {
+	if storeService.dbPool == nil {
+		return UTMPreset{}, ErrRequiresDatabase
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	preset.Id = generateUTMPresetId()
+	preset.CreatedAt = time.Now().UTC()
+	result, err := storeService.dbPool.Exec(ctx,
+		`INSERT INTO utm_presets (id, "userId", name, "utmSource", "utmMedium", "utmCampaign", "utmTerm", "utmContent", "createdAt")
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		 ON CONFLICT ("userId", name) DO NOTHING`,
+		preset.Id, preset.UserId, preset.Name, nullIfEmpty(preset.UTM.Source), nullIfEmpty(preset.UTM.Medium),
+		nullIfEmpty(preset.UTM.Campaign), nullIfEmpty(preset.UTM.Term), nullIfEmpty(preset.UTM.Content), preset.CreatedAt)
+	if err != nil {
+		return UTMPreset{}, fmt.Errorf("database error: %v", err)
+	}
+	if result.RowsAffected() == 0 {
+		return UTMPreset{}, ErrUTMPresetNameTaken
+	}
+	return preset, nil
+}
+
+func (storeService *StorageService) RetrieveUTMPreset(userId string, id string) (UTMPreset, error) {
+	if storeService.dbPool == nil {
+		return UTMPreset{}, ErrRequiresDatabase
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := storeService.dbPool.Query(ctx,
+		`SELECT `+utmPresetColumns+` FROM utm_presets p WHERE p.id = $1 AND p."userId" = $2`, id, userId)
+	if err != nil {
+		return UTMPreset{}, fmt.Errorf("database error: %v", err)
+	}
+	preset, err := pgx.CollectOneRow(rows, scanUTMPreset)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return UTMPreset{}, ErrNotFound
+	}
+	if err != nil {
+		return UTMPreset{}, fmt.Errorf("database error: %v", err)
+	}
+	return preset, nil
+}
+
+func (storeService *StorageService) ListUTMPresets(userId string) ([]UTMPreset, error) {
+	if storeService.dbPool == nil {
+		return nil, ErrRequiresDatabase
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := storeService.dbPool.Query(ctx,
+		`SELECT `+utmPresetColumns+` FROM utm_presets p WHERE p."userId" = $1 ORDER BY p.name`, userId)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	presets, err := pgx.CollectRows(rows, scanUTMPreset)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	return presets, nil
+}
+
+func (storeService *StorageService) DeleteUTMPreset(userId string, id string) error {
+	if storeService.dbPool == nil {
+		return ErrRequiresDatabase
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := storeService.dbPool.Exec(ctx,
+		`DELETE FROM utm_presets WHERE id = $1 AND "userId" = $2`, id, userId)
+	if err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Columns of domains d, read with scanDomain
+const domainColumns = `d.id, d."userId", d.host, d.token, d."createdAt", d."verifiedAt"`
+
+func scanDomain(row pgx.CollectableRow) (Domain, error) {
+	var domain Domain
+	err := row.Scan(&domain.Id, &domain.UserId, &domain.Host, &domain.Token, &domain.CreatedAt, &domain.VerifiedAt)
+	return domain, err
+}
+
+func (storeService *StorageService) CreateDomain(domain Domain) (Domain, error) {
+	if storeService.dbPool == nil {
+		return Domain{}, ErrRequiresDatabase
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	domain.Id = generateDomainId()
+	domain.CreatedAt = time.Now().UTC()
+	domain.VerifiedAt = nil
+	result, err := storeService.dbPool.Exec(ctx,
+		`INSERT INTO domains (id, "userId", host, token, "createdAt")
+		 SELECT $1, $2, $3, $4, $5
+		 WHERE NOT EXISTS (SELECT 1 FROM domains WHERE host = $3 AND "verifiedAt" IS NOT NULL)
+		 ON CONFLICT ("userId", host) DO NOTHING`,
+		domain.Id, domain.UserId, domain.Host, domain.Token, domain.CreatedAt)
+	if err != nil {
+		return Domain{}, fmt.Errorf("database error: %v", err)
+	}
+	if result.RowsAffected() == 0 {
+		return Domain{}, ErrDomainTaken
+	}
+	return domain, nil
+}
+
+func (storeService *StorageService) ListDomains(userId string) ([]Domain, error) {
+	if storeService.dbPool == nil {
+		return nil, ErrRequiresDatabase
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := storeService.dbPool.Query(ctx,
+		`SELECT `+domainColumns+` FROM domains d WHERE d."userId" = $1 ORDER BY d.host`, userId)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	domains, err := pgx.CollectRows(rows, scanDomain)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	return domains, nil
+}
+
+func (storeService *StorageService) RetrieveVerifiedDomain(host string) (Domain, error) {
+	if storeService.dbPool == nil {
+		return Domain{}, ErrRequiresDatabase
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := storeService.dbPool.Query(ctx,
+		`SELECT `+domainColumns+` FROM domains d WHERE d.host = $1 AND d."verifiedAt" IS NOT NULL`, host)
+	if err != nil {
+		return Domain{}, fmt.Errorf("database error: %v", err)
+	}
+	domain, err := pgx.CollectOneRow(rows, scanDomain)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Domain{}, ErrNotFound
+	}
+	if err != nil {
+		return Domain{}, fmt.Errorf("database error: %v", err)
+	}
+	return domain, nil
+}
+
+// The unique index on verified hosts decides between users verifying the
+// same host at once
+func (storeService *StorageService) VerifyDomain(userId string, id string, at time.Time) (Domain, error) {
+	if storeService.dbPool == nil {
+		return Domain{}, ErrRequiresDatabase
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := storeService.dbPool.Query(ctx,
+		`UPDATE domains d SET "verifiedAt" = COALESCE(d."verifiedAt", $3)
+		 WHERE d.id = $1 AND d."userId" = $2
+		 RETURNING `+domainColumns,
+		id, userId, at.UTC())
+	if err != nil {
+		return Domain{}, fmt.Errorf("database error: %v", err)
+	}
+	domain, err := pgx.CollectOneRow(rows, scanDomain)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return Domain{}, ErrNotFound
+	case isPgError(err, pgUniqueViolation):
+		return Domain{}, ErrDomainTaken
+	case err != nil:
+		return Domain{}, fmt.Errorf("database error: %v", err)
+	}
+	return domain, nil
+}
+
+// Links of the domain are soft-deleted with it. Their cache entries are
+// left to expire: nothing routes to the domain's ID any more.
+func (storeService *StorageService) DeleteDomain(userId string, id string) error {
+	if storeService.dbPool == nil {
+		return ErrRequiresDatabase
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := storeService.dbPool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, `DELETE FROM domains WHERE id = $1 AND "userId" = $2`, id, userId)
+	if err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	_, err = tx.Exec(ctx,
+		`UPDATE urls SET "isActive" = false, "deletedAt" = NOW(), "updatedAt" = NOW()
+		 WHERE starts_with("shortCode", $1) AND "deletedAt" IS NULL`,
+		DomainCode(id, ""))
+	if err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+	return nil
+}
+
+// A page of a user's links, newest first
+func (storeService *StorageService) ListLinks(query LinkListQuery) ([]ListedLink, error) {
+	if storeService.dbPool == nil {
+		return nil, ErrRequiresDatabase
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var before interface{}
+	if !query.Before.Time.IsZero() {
+		before = query.Before.Time.UTC()
+	}
+	rows, err := storeService.dbPool.Query(ctx,
+		`SELECT u."shortCode", u."originalUrl", u."createdAt", COALESCE(u."isActive", true), u."expiresAt",
+		        COALESCE(u."quarantineReason", ''),
+		        (SELECT COUNT(*) FROM url_clicks c WHERE c."urlId" = u.id),
+		        COALESCE(u.title, ''), COALESCE(u."campaignId", ''),
+		        ARRAY(SELECT t."tagId" FROM url_tags t WHERE t."urlId" = u.id ORDER BY t."tagId"),
+		        `+utmColumns+`
+		 FROM urls u
+		 WHERE u."userId" = $1 AND u."deletedAt" IS NULL
+		   AND ($2::text = '' OR EXISTS (SELECT 1 FROM url_tags t WHERE t."urlId" = u.id AND t."tagId" = $2))
+		   AND ($3::text = '' OR u."campaignId" = $3)
+		   AND ($4::timestamp IS NULL OR (u."createdAt", u."shortCode") < ($4, $5))
+		 ORDER BY u."createdAt" DESC, u."shortCode" DESC
+		 LIMIT $6`,
+		query.UserId, query.TagId, query.CampaignId, before, query.Before.Id, query.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	now := time.Now()
+	links, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (ListedLink, error) {
+		var listed ListedLink
+		var link Link
+		err := row.Scan(&listed.ShortCode, &listed.OriginalUrl, &listed.CreatedAt, &link.IsActive, &link.ExpiresAt,
+			&link.QuarantineReason, &listed.Clicks, &listed.Title, &listed.CampaignId, &listed.TagIds,
+			&listed.UTM.Source, &listed.UTM.Medium, &listed.UTM.Campaign, &listed.UTM.Term, &listed.UTM.Content)
+		listed.Status = link.exportStatus(now)
+		return listed, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	return links, nil
+}
+
+// Remove the cached destination and mark the code as invalidated in one
+// transaction, so that a reader holding the old row cannot cache it again.
+// Redis is shared by every instance, so the change is visible everywhere.
+func (storeService *StorageService) invalidateCache(shortCode string) error {
+	if storeService.redisClient == nil {
+		return nil
+	}
+	_, err := storeService.redisClient.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Del(shortCode)
+		pipe.Set(invalidationKey(shortCode), 1, invalidationWindow)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Warning: Failed invalidating Redis cache | Error: %v - shortCode: %s", err, shortCode)
+		return fmt.Errorf("cache error: %v", err)
+	}
+	return nil
+}
+
+// Check whether a short code is unused in both Redis and Postgres
+func (storeService *StorageService) IsShortCodeAvailable(shortCode string) (bool, error) {
+	if storeService.redisClient != nil {
+		exists, err := storeService.redisClient.Exists(shortCode).Result()
+		if err != nil {
+			log.Printf("Warning: Failed checking Redis for short code | Error: %v - shortCode: %s", err, shortCode)
+		} else if exists > 0 {
+			return false, nil
+		}
+	}
+
+	if storeService.dbPool != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		var exists bool
+		err := storeService.dbPool.QueryRow(ctx,
+			`SELECT EXISTS (SELECT 1 FROM urls WHERE "shortCode" = $1)`,
+			shortCode).Scan(&exists)
+		if err != nil {
+			return false, fmt.Errorf("database error: %v", err)
+		}
+		return !exists, nil
+	}
+
+	return true, nil
+}
+
+// Track URL click for analytics
+func (storeService *StorageService) TrackUrlClick(shortCode string, userId string, ipAddress string, userAgent string, referer string) error {
+	if storeService.dbPool == nil {
+		return nil // Skip tracking if no database
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// First get the URL ID using correct quoted column name
+	var urlId string
+	err := storeService.dbPool.QueryRow(ctx, 
+		`SELECT id FROM urls WHERE "shortCode" = $1`, 
+		shortCode).Scan(&urlId)
+	if err != nil {
+		log.Printf("Warning: Failed to find URL for tracking | Error: %v - shortCode: %s", err, shortCode)
+		return err
+	}
+
+	// Generate click ID
+	clickId := generateClickId()
+
+	// Handle guest users - use NULL instead of "guest-user" to avoid foreign key constraint
+	userIdParam := clickUserId(userId)
+
+	// Insert click record using the correct camelCase column names
+	_, err = storeService.dbPool.Exec(ctx,
+		`INSERT INTO url_clicks (id, "urlId", "userId", "ipAddress", "userAgent", referer, "clickedAt") 
+		 VALUES ($1, $2, $3, $4, $5, $6, NOW())`,
+		clickId, urlId, userIdParam, ipAddress, userAgent, referer,
+	)
+	if err != nil {
+		log.Printf("Warning: Failed tracking URL click | Error: %v - shortCode: %s", err, shortCode)
+		return err
+	}
+
+	log.Printf("Successfully tracked click for short URL: %s", shortCode)
+	return nil
+}
+
+// Write a batch of clicks with a single COPY. Short codes are resolved to
+// URL IDs in one query; clicks for unknown codes are skipped.
+func (storeService *StorageService) WriteClicks(clicks []Click) (int, error) {
+	if storeService.dbPool == nil || len(clicks) == 0 {
+		return 0, nil // Skip tracking if no database
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	shortCodes := make([]string, 0, len(clicks))
+	seen := make(map[string]bool)
+	for _, click := range clicks {
+		if !seen[click.ShortCode] {
+			seen[click.ShortCode] = true
+			shortCodes = append(shortCodes, click.ShortCode)
+		}
+	}
+
+	rows, err := storeService.dbPool.Query(ctx,
+		`SELECT "shortCode", id FROM urls WHERE "shortCode" = ANY($1)`, shortCodes)
+	if err != nil {
+		return 0, fmt.Errorf("database error: %v", err)
+	}
+	urlIds := make(map[string]string)
+	for rows.Next() {
+		var shortCode, urlId string
+		if err := rows.Scan(&shortCode, &urlId); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("database error: %v", err)
+		}
+		urlIds[shortCode] = urlId
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("database error: %v", err)
+	}
+
+	copyRows := make([][]interface{}, 0, len(clicks))
+	for _, click := range clicks {
+		urlId, ok := urlIds[click.ShortCode]
+		if !ok {
+			log.Printf("Warning: Skipping click for unknown short code: %s", click.ShortCode)
+			continue
+		}
+		copyRows = append(copyRows, []interface{}{
+			generateClickId(), urlId, clickUserId(click.UserId),
+			click.IpAddress, click.UserAgent, click.Referer, click.ClickedAt.UTC(),
+			nullIfEmpty(click.Country), nullIfEmpty(click.City),
+			nullIfEmpty(click.Device), nullIfEmpty(click.Browser), nullIfEmpty(click.OS),
+		})
+	}
+
+	if len(copyRows) == 0 {
+		return 0, nil
+	}
+	written, err := storeService.dbPool.CopyFrom(ctx,
+		pgx.Identifier{"url_clicks"},
+		[]string{"id", "urlId", "userId", "ipAddress", "userAgent", "referer", "clickedAt", "country", "city", "device", "browser", "os"},
+		pgx.CopyFromRows(copyRows))
+	if err != nil {
+		return 0, fmt.Errorf("database error: %v", err)
+	}
+	return int(written), nil
+}
+
+// Compute the analytics of one link from url_clicks
+func (storeService *StorageService) LinkStats(query StatsQuery) (LinkStats, error) {
+	if storeService.dbPool == nil {
+		return LinkStats{}, ErrRequiresDatabase
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	urlIds, err := storeService.statsUrlIds(ctx, query)
+	if err != nil {
+		return LinkStats{}, err
+	}
+
+	// clickedAt holds UTC wall clock times
+	from, to := query.From.UTC(), query.To.UTC()
+	stats := LinkStats{}
+
+	err = storeService.dbPool.QueryRow(ctx,
+		`SELECT COUNT(*), COUNT(DISTINCT "ipAddress") FROM url_clicks
+		 WHERE "urlId" = ANY($1) AND "clickedAt" >= $2 AND "clickedAt" < $3`,
+		urlIds, from, to).Scan(&stats.TotalClicks, &stats.UniqueClicks)
+	if err != nil {
+		return LinkStats{}, fmt.Errorf("database error: %v", err)
+	}
+
+	// Buckets are truncated in the requested time zone and come back as
+	// wall clock times there
+	rows, err := storeService.dbPool.Query(ctx,
+		`SELECT date_trunc($4, ("clickedAt" AT TIME ZONE 'UTC') AT TIME ZONE $5) AS bucket,
+		        COUNT(*), COUNT(DISTINCT "ipAddress")
+		 FROM url_clicks
+		 WHERE "urlId" = ANY($1) AND "clickedAt" >= $2 AND "clickedAt" < $3
+		 GROUP BY bucket`,
+		urlIds, from, to, query.Interval, query.Location.String())
+	if err != nil {
+		return LinkStats{}, fmt.Errorf("database error: %v", err)
+	}
+	buckets := make(map[int64]StatsBucket)
+	for rows.Next() {
+		var wallClock time.Time
+		var bucket StatsBucket
+		if err := rows.Scan(&wallClock, &bucket.Clicks, &bucket.UniqueClicks); err != nil {
+			rows.Close()
+			return LinkStats{}, fmt.Errorf("database error: %v", err)
+		}
+		start := time.Date(wallClock.Year(), wallClock.Month(), wallClock.Day(),
+			wallClock.Hour(), 0, 0, 0, query.Location)
+		buckets[start.Unix()] = bucket
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return LinkStats{}, fmt.Errorf("database error: %v", err)
+	}
+	stats.Series = query.fillSeries(buckets)
+
+	for _, top := range []struct {
+		column string
+		result *[]StatsCount
+	}{
+		{"referer", &stats.Referrers},
+		{"country", &stats.Countries},
+		{"device", &stats.Devices},
+		{"browser", &stats.Browsers},
+	} {
+		*top.result, err = storeService.topClickValues(ctx, urlIds, top.column, from, to, query.Limit)
+		if err != nil {
+			return LinkStats{}, err
+		}
+	}
+
+	if query.isGroup() {
+		rows, err := storeService.dbPool.Query(ctx,
+			`SELECT u."shortCode", COUNT(*) FROM url_clicks c JOIN urls u ON u.id = c."urlId"
+			 WHERE c."urlId" = ANY($1) AND c."clickedAt" >= $2 AND c."clickedAt" < $3
+			 GROUP BY u."shortCode" ORDER BY COUNT(*) DESC, u."shortCode" LIMIT $4`,
+			urlIds, from, to, query.Limit)
+		if err != nil {
+			return LinkStats{}, fmt.Errorf("database error: %v", err)
+		}
+		stats.Links, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (StatsCount, error) {
+			var count StatsCount
+			err := row.Scan(&count.Value, &count.Clicks)
+			return count, err
+		})
+		if err != nil {
+			return LinkStats{}, fmt.Errorf("database error: %v", err)
+		}
+	}
+	return stats, nil
+}
+
+// IDs of the links whose clicks a stats query covers. ErrNotFound for an
+// unknown short code; a group may well be empty.
+func (storeService *StorageService) statsUrlIds(ctx context.Context, query StatsQuery) ([]string, error) {
+	var rows pgx.Rows
+	var err error
+	switch {
+	case query.TagId != "":
+		rows, err = storeService.dbPool.Query(ctx,
+			`SELECT u.id FROM urls u JOIN url_tags t ON t."urlId" = u.id
+			 WHERE t."tagId" = $1 AND u."deletedAt" IS NULL`, query.TagId)
+	case query.CampaignId != "":
+		rows, err = storeService.dbPool.Query(ctx,
+			`SELECT id FROM urls WHERE "campaignId" = $1 AND "deletedAt" IS NULL`, query.CampaignId)
+	default:
+		rows, err = storeService.dbPool.Query(ctx,
+			`SELECT id FROM urls WHERE "shortCode" = $1 AND "deletedAt" IS NULL`, query.ShortCode)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	urlIds, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	if len(urlIds) == 0 && !query.isGroup() {
+		return nil, ErrNotFound
+	}
+	return urlIds, nil
+}
+
+func (storeService *StorageService) topClickValues(ctx context.Context, urlIds []string, column string, from time.Time, to time.Time, limit int) ([]StatsCount, error) {
+	rows, err := storeService.dbPool.Query(ctx,
+		fmt.Sprintf(`SELECT %[1]s, COUNT(*) FROM url_clicks
+		 WHERE "urlId" = ANY($1) AND "clickedAt" >= $2 AND "clickedAt" < $3 AND %[1]s IS NOT NULL AND %[1]s <> ''
+		 GROUP BY %[1]s ORDER BY COUNT(*) DESC, %[1]s LIMIT $4`, column),
+		urlIds, from, to, limit)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	counts, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (StatsCount, error) {
+		var count StatsCount
+		err := row.Scan(&count.Value, &count.Clicks)
+		return count, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	return counts, nil
+}
+
+func (storeService *StorageService) CreateAPIKey(key APIKey) (APIKey, error) {
+	if storeService.dbPool == nil {
+		return APIKey{}, ErrRequiresDatabase
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	key.Id = generateAPIKeyId()
+	key.CreatedAt = time.Now().UTC()
+	_, err := storeService.dbPool.Exec(ctx,
+		`INSERT INTO api_keys (id, "userId", name, prefix, "keyHash", "createdAt")
+		 VALUES ($1, $2, $3, $4, $5, $6)`,
+		key.Id, key.UserId, key.Name, key.Prefix, key.KeyHash, key.CreatedAt)
+	if err != nil {
+		return APIKey{}, fmt.Errorf("database error: %v", err)
+	}
+	return key, nil
+}
+
+const apiKeyColumns = `id, "userId", name, prefix, "keyHash", "createdAt", "lastUsedAt", "revokedAt"`
+
+func scanAPIKey(row pgx.Row) (APIKey, error) {
+	var key APIKey
+	err := row.Scan(&key.Id, &key.UserId, &key.Name, &key.Prefix, &key.KeyHash,
+		&key.CreatedAt, &key.LastUsedAt, &key.RevokedAt)
+	return key, err
+}
+
+func (storeService *StorageService) RetrieveAPIKey(keyHash string) (APIKey, error) {
+	if storeService.dbPool == nil {
+		return APIKey{}, ErrRequiresDatabase
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	key, err := scanAPIKey(storeService.dbPool.QueryRow(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys WHERE "keyHash" = $1`, keyHash))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return APIKey{}, ErrNotFound
+	}
+	if err != nil {
+		return APIKey{}, fmt.Errorf("database error: %v", err)
+	}
+	return key, nil
+}
+
+func (storeService *StorageService) ListAPIKeys(userId string) ([]APIKey, error) {
+	if storeService.dbPool == nil {
+		return nil, ErrRequiresDatabase
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := storeService.dbPool.Query(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys WHERE "userId" = $1 ORDER BY "createdAt" DESC`, userId)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	keys, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (APIKey, error) {
+		return scanAPIKey(row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	return keys, nil
+}
+
+func (storeService *StorageService) RevokeAPIKey(userId string, id string) error {
+	if storeService.dbPool == nil {
+		return ErrRequiresDatabase
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := storeService.dbPool.Exec(ctx,
+		`UPDATE api_keys SET "revokedAt" = COALESCE("revokedAt", $3) WHERE id = $1 AND "userId" = $2`,
+		id, userId, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (storeService *StorageService) TouchAPIKey(id string, usedAt time.Time) error {
+	if storeService.dbPool == nil {
+		return ErrRequiresDatabase
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := storeService.dbPool.Exec(ctx,
+		`UPDATE api_keys SET "lastUsedAt" = $2 WHERE id = $1`, id, usedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+	return nil
+}
+
+func (storeService *StorageService) RetrieveSession(sessionToken string) (Session, error) {
+	if storeService.dbPool == nil {
+		return Session{}, ErrRequiresDatabase
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var session Session
+	var email, name *string
+	err := storeService.dbPool.QueryRow(ctx,
+		`SELECT s."userId", s.expires, u.role::text, u.email, u.name
+		 FROM sessions s JOIN users u ON u.id = s."userId"
+		 WHERE s."sessionToken" = $1`,
+		sessionToken).Scan(&session.UserId, &session.Expires, &session.Role, &email, &name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Session{}, ErrNotFound
+	}
+	if err != nil {
+		return Session{}, fmt.Errorf("database error: %v", err)
+	}
+	if email != nil {
+		session.Email = *email
+	}
+	if name != nil {
+		session.Name = *name
+	}
+	return session, nil
+}
+
+func (storeService *StorageService) RetrieveUser(userId string) (User, error) {
+	if storeService.dbPool == nil {
+		return User{}, ErrRequiresDatabase
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user := User{Id: userId}
+	err := storeService.dbPool.QueryRow(ctx,
+		`SELECT role::text, "subscriptionTier"::text, "subscriptionExpires" FROM users WHERE id = $1`,
+		userId).Scan(&user.Role, &user.SubscriptionTier, &user.SubscriptionExpires)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return User{}, ErrNotFound
+	}
+	if err != nil {
+		return User{}, fmt.Errorf("database error: %v", err)
+	}
+	return user, nil
+}
+
+// RedisClient exposes the cache connection for features that coordinate
+// across instances, such as rate limiting
+func (storeService *StorageService) RedisClient() *redis.Client {
+	return storeService.redisClient
+}
+
+func (storeService *StorageService) LinkUsage(userId string, since time.Time) (LinkUsage, error) {
+	if storeService.dbPool == nil {
+		return LinkUsage{}, ErrRequiresDatabase
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var usage LinkUsage
+	err := storeService.dbPool.QueryRow(ctx,
+		`SELECT COUNT(*) FILTER (WHERE "createdAt" >= $2),
+		        COUNT(*) FILTER (WHERE "isCustomAlias" AND "deletedAt" IS NULL)
+		 FROM urls WHERE "userId" = $1`,
+		userId, since.UTC()).Scan(&usage.LinksCreated, &usage.CustomAliases)
+	if err != nil {
+		return LinkUsage{}, fmt.Errorf("database error: %v", err)
+	}
+	return usage, nil
+}
+
+// One page of a user's links with their click counts. The cursor is
+// compared as a row value so the (userId, createdAt) index serves every page.
+func (storeService *StorageService) ExportLinks(userId string, after ExportCursor, limit int) ([]ExportedLink, error) {
+	if storeService.dbPool == nil {
+		return nil, ErrRequiresDatabase
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := storeService.dbPool.Query(ctx,
+		`SELECT u."shortCode", u."originalUrl", u."createdAt", COALESCE(u."isActive", true), u."expiresAt",
+		        COALESCE(u."quarantineReason", ''),
+		        (SELECT COUNT(*) FROM url_clicks c WHERE c."urlId" = u.id),
+		        `+utmColumns+`
+		 FROM urls u
+		 WHERE u."userId" = $1 AND u."deletedAt" IS NULL AND (u."createdAt", u."shortCode") > ($2, $3)
+		 ORDER BY u."createdAt", u."shortCode"
+		 LIMIT $4`,
+		userId, after.Time.UTC(), after.Id, limit)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	now := time.Now()
+	links, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (ExportedLink, error) {
+		var exported ExportedLink
+		var link Link
+		err := row.Scan(&exported.ShortCode, &exported.OriginalUrl, &exported.CreatedAt, &link.IsActive, &link.ExpiresAt,
+			&link.QuarantineReason, &exported.Clicks,
+			&exported.UTM.Source, &exported.UTM.Medium, &exported.UTM.Campaign, &exported.UTM.Term, &exported.UTM.Content)
+		exported.Status = link.exportStatus(now)
+		return exported, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	return links, nil
+}
+
+// One page of the clicks on a user's links in [from, to)
+func (storeService *StorageService) ExportClicks(userId string, from time.Time, to time.Time, after ExportCursor, limit int) ([]ExportedClick, error) {
+	if storeService.dbPool == nil {
+		return nil, ErrRequiresDatabase
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := storeService.dbPool.Query(ctx,
+		`SELECT c.id, u."shortCode", COALESCE(c."userId", ''), COALESCE(c."ipAddress", ''), COALESCE(c."userAgent", ''),
+		        COALESCE(c.referer, ''), c."clickedAt", COALESCE(c.country, ''), COALESCE(c.city, ''),
+		        COALESCE(c.device, ''), COALESCE(c.browser, ''), COALESCE(c.os, '')
+		 FROM url_clicks c JOIN urls u ON u.id = c."urlId"
+		 WHERE u."userId" = $1 AND c."clickedAt" >= $2 AND c."clickedAt" < $3 AND (c."clickedAt", c.id) > ($4, $5)
+		 ORDER BY c."clickedAt", c.id
+		 LIMIT $6`,
+		userId, from.UTC(), to.UTC(), after.Time.UTC(), after.Id, limit)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	clicks, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (ExportedClick, error) {
+		var click ExportedClick
+		err := row.Scan(&click.Id, &click.ShortCode, &click.UserId, &click.IpAddress, &click.UserAgent,
+			&click.Referer, &click.ClickedAt, &click.Country, &click.City,
+			&click.Device, &click.Browser, &click.OS)
+		return click, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	return clicks, nil
+}
+
+// Guest users are stored as NULL to satisfy the users foreign key
+func clickUserId(userId string) interface{} {
+	if userId == "guest-user" || userId == "" {
+		return nil
+	}
+	return userId
+}
+
+// Store unknown values as NULL rather than empty strings
+func nullIfEmpty(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// Mark every active link whose expiry has passed as inactive and drop it
+// from the cache. Returns the number of links deactivated.
+func (storeService *StorageService) DeactivateExpiredLinks() (int, error) {
+	if storeService.dbPool == nil {
+		return 0, nil // Redis entries expire on their own
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := storeService.dbPool.Query(ctx,
+		`UPDATE urls SET "isActive" = false, "updatedAt" = NOW()
+		 WHERE "isActive" = true AND "expiresAt" IS NOT NULL AND "expiresAt" <= NOW()
+		 RETURNING "shortCode"`)
+	if err != nil {
+		return 0, fmt.Errorf("database error: %v", err)
+	}
+	shortCodes, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return 0, fmt.Errorf("database error: %v", err)
+	}
+
+	if storeService.redisClient != nil && len(shortCodes) > 0 {
+		if err := storeService.redisClient.Del(shortCodes...).Err(); err != nil {
+			log.Printf("Warning: Failed removing expired links from Redis | Error: %v", err)
+		}
+	}
+	return len(shortCodes), nil
+}
+
+// Sequences keeping URL and version IDs unique when a batch is generated
+// within one tick of a coarse clock
+var urlSequence, versionSequence atomic.Uint64
+
+// Helper function to generate URL ID (simple implementation)
+func generateUrlId() string {
+	return fmt.Sprintf("url_%d_%d", time.Now().UnixNano(), urlSequence.Add(1))
+}
+
+func generateVersionId() string {
+	return fmt.Sprintf("ver_%d_%d", time.Now().UnixNano(), versionSequence.Add(1))
+}
+
+// Sequence keeping click IDs unique within a batch written in the same nanosecond
+var clickSequence atomic.Uint64
 
 // Helper function to generate click ID (simple implementation)
 func generateClickId() string {
-	return fmt.Sprintf("click_%d", time.Now().UnixNano())
+	return fmt.Sprintf("click_%d_%d", time.Now().UnixNano(), clickSequence.Add(1))
 }
 
 // Graceful shutdown
-func CloseStore() {
+func (storeService *StorageService) Close() {
 	if storeService.redisClient != nil {
 		storeService.redisClient.Close()
 	}
@@ -1,8 +1,16 @@
 package store
 
 import (
-	"github.com/stretchr/testify/assert"
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/go-redis/redis"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"strings"
 	"testing"
 )
 
@@ -21,10 +29,82 @@ func TestInsertionAndRetrieval(t *testing.T) {
 	shortURL := "Jsz4k57oAX"
 
 	// Persist data mapping
-	SaveUrlMapping(shortURL, initialLink, userUUId)
+	testStoreService.SaveUrlMapping(shortURL, initialLink, userUUId)
 
 	// Retrieve initial URL
-	retrievedUrl := RetrieveInitialUrl(shortURL)
+	retrievedUrl := testStoreService.RetrieveInitialUrl(shortURL)
 
 	assert.Equal(t, initialLink, retrievedUrl)
 }
+
+func TestGeneratedIdsAreUnique(t *testing.T) {
+	for _, generate := range []func() string{generateUrlId, generateVersionId, generateClickId} {
+		seen := make(map[string]bool)
+		for i := 0; i < 10000; i++ {
+			id := generate()
+			assert.False(t, seen[id], id)
+			seen[id] = true
+		}
+	}
+}
+
+// Serve a Redis that accepts every write, so only Postgres can fail
+func acceptingRedis(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					// Commands arrive as arrays of bulk strings
+					var args int
+					if _, err := fmt.Fscanf(reader, "*%d\r\n", &args); err != nil {
+						return
+					}
+					command := ""
+					for i := 0; i < args; i++ {
+						var size int
+						if _, err := fmt.Fscanf(reader, "$%d\r\n", &size); err != nil {
+							return
+						}
+						arg := make([]byte, size+2)
+						if _, err := io.ReadFull(reader, arg); err != nil {
+							return
+						}
+						if i == 0 {
+							command = strings.ToUpper(string(arg[:size]))
+						}
+					}
+					reply := "+OK\r\n"
+					if command == "SETNX" || command == "DEL" {
+						reply = ":1\r\n"
+					}
+					conn.Write([]byte(reply))
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestSaveLinkReportsDatabaseErrors(t *testing.T) {
+	// Nothing listens on the Postgres port
+	dbPool, err := pgxpool.New(context.Background(), "postgres://user@127.0.0.1:1/urls?connect_timeout=1")
+	assert.NoError(t, err)
+	defer dbPool.Close()
+	storeService := &StorageService{
+		redisClient: redis.NewClient(&redis.Options{Addr: acceptingRedis(t)}),
+		dbPool:      dbPool,
+	}
+
+	err = storeService.SaveLink(Link{ShortCode: "abc12345", OriginalUrl: "https://example.com", UserId: "user-1"})
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrShortCodeTaken)
+}
@@ -0,0 +1,36 @@
+package store
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// LinkExpirer deactivates links whose expiry has passed
+type LinkExpirer interface {
+	DeactivateExpiredLinks() (int, error)
+}
+
+// Default interval between two expiry sweeps
+const SweepInterval = 5 * time.Minute
+
+// RunExpirySweeper marks expired links inactive every interval until the
+// context is cancelled
+func RunExpirySweeper(ctx context.Context, expirer LinkExpirer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			count, err := expirer.DeactivateExpiredLinks()
+			if err != nil {
+				log.Printf("Warning: Expiry sweep failed: %v", err)
+			} else if count > 0 {
+				log.Printf("Expiry sweep deactivated %d links", count)
+			}
+		}
+	}
+}
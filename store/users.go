@@ -0,0 +1,28 @@
+package store
+
+import "time"
+
+// User is the part of a users row the API needs for billing decisions
+type User struct {
+	Id                  string
+	Role                string
+	SubscriptionTier    string // FREE, PRO or ENTERPRISE
+	SubscriptionExpires *time.Time
+}
+
+// UserStore reads users written by the frontend
+type UserStore interface {
+	// Returns ErrNotFound for unknown users
+	RetrieveUser(userId string) (User, error)
+}
+
+// LinkUsage is what a user's links count against their plan
+type LinkUsage struct {
+	LinksCreated  int64 `json:"links_created"`  // Since the start of the period, deleted ones included
+	CustomAliases int64 `json:"custom_aliases"` // Links with a custom alias that are not deleted
+}
+
+// UsageStore counts a user's links
+type UsageStore interface {
+	LinkUsage(userId string, since time.Time) (LinkUsage, error)
+}
@@ -0,0 +1,86 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+var ErrUTMPresetNameTaken = errors.New("a UTM preset with this name already exists")
+
+// UTM parameters of a link, kept apart from the destination they were
+// merged into so that links can be reported on by campaign source
+type UTM struct {
+	Source   string `json:"utm_source,omitempty"`
+	Medium   string `json:"utm_medium,omitempty"`
+	Campaign string `json:"utm_campaign,omitempty"`
+	Term     string `json:"utm_term,omitempty"`
+	Content  string `json:"utm_content,omitempty"`
+}
+
+func (u UTM) IsZero() bool {
+	return u == UTM{}
+}
+
+// Query parameters of the set values, in the conventional order
+func (u UTM) Params() [][2]string {
+	var params [][2]string
+	for _, param := range [][2]string{
+		{"utm_source", u.Source},
+		{"utm_medium", u.Medium},
+		{"utm_campaign", u.Campaign},
+		{"utm_term", u.Term},
+		{"utm_content", u.Content},
+	} {
+		if param[1] != "" {
+			params = append(params, param)
+		}
+	}
+	return params
+}
+
+// Values of u, with the unset ones taken from defaults
+func (u UTM) Or(defaults UTM) UTM {
+	pick := func(value string, fallback string) string {
+		if value != "" {
+			return value
+		}
+		return fallback
+	}
+	return UTM{
+		Source:   pick(u.Source, defaults.Source),
+		Medium:   pick(u.Medium, defaults.Medium),
+		Campaign: pick(u.Campaign, defaults.Campaign),
+		Term:     pick(u.Term, defaults.Term),
+		Content:  pick(u.Content, defaults.Content),
+	}
+}
+
+// UTMPreset is a named set of UTM parameters a user applies to new links
+type UTMPreset struct {
+	Id        string    `json:"id"`
+	UserId    string    `json:"user_id"`
+	Name      string    `json:"name"`
+	UTM       UTM       `json:"utm"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UTMPresetStore keeps the UTM presets of users. Names are unique per user.
+type UTMPresetStore interface {
+	// Store a new preset, assigning its id and creation time. Returns
+	// ErrUTMPresetNameTaken when the user has a preset of that name.
+	CreateUTMPreset(preset UTMPreset) (UTMPreset, error)
+	// Returns ErrNotFound when the user has no such preset
+	RetrieveUTMPreset(userId string, id string) (UTMPreset, error)
+	// Presets of a user by name
+	ListUTMPresets(userId string) ([]UTMPreset, error)
+	// Returns ErrNotFound when the user has no such preset
+	DeleteUTMPreset(userId string, id string) error
+}
+
+var utmPresetSequence atomic.Uint64
+
+func generateUTMPresetId() string {
+	return fmt.Sprintf("utm_%d_%d", time.Now().UnixNano(), utmPresetSequence.Add(1))
+}
@@ -0,0 +1,57 @@
+package store
+
+import "time"
+
+// LinkVersion is one change of a link's destination. Versions are numbered
+// from 1 per link; version 0 stands for the destination the link was
+// created with.
+type LinkVersion struct {
+	Version   int       `json:"version"`
+	OldUrl    string    `json:"old_url"`
+	NewUrl    string    `json:"new_url"`
+	ChangedBy string    `json:"changed_by"` // User who made the change
+	ChangedAt time.Time `json:"changed_at"`
+	// The version whose destination was restored, nil for plain edits
+	RolledBackTo *int `json:"rolled_back_to,omitempty"`
+}
+
+// DestinationChange describes a new destination for a link
+type DestinationChange struct {
+	NewUrl       string
+	ChangedBy    string
+	RolledBackTo *int
+	// Holds the new destination for review. The link's quarantine is
+	// replaced either way: it was about the old destination.
+	QuarantineReason string
+	// UTM parameters the new destination carries. They replace the link's
+	// so reports follow what visitors are actually sent to.
+	UTM UTM
+}
+
+// LinkVersionStore changes destinations and keeps their history. Every
+// change drops the cached destination so it applies to the next redirect.
+type LinkVersionStore interface {
+	// Point a link at a new destination and record the change. ErrNotFound
+	// for unknown and deleted links.
+	ChangeDestination(shortCode string, change DestinationChange) (LinkVersion, error)
+	// Changes of a link's destination, newest first
+	LinkVersions(shortCode string) ([]LinkVersion, error)
+}
+
+// The destination of a link as of version, given its changes newest first.
+// Version 0 is the destination the link was created with, current is where
+// it points now. False when there is no such version.
+func DestinationAt(versions []LinkVersion, version int, current string) (string, bool) {
+	if version == 0 {
+		if len(versions) == 0 {
+			return current, true
+		}
+		return versions[len(versions)-1].OldUrl, true
+	}
+	for _, v := range versions {
+		if v.Version == version {
+			return v.NewUrl, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,154 @@
+package useragent
+
+import (
+	"strings"
+	"url-shortener/store"
+)
+
+// Device classes stored in url_clicks.device
+const (
+	Desktop = "desktop"
+	Mobile  = "mobile"
+	Tablet  = "tablet"
+	Bot     = "bot"
+)
+
+// Info is the classification of a User-Agent header
+type Info struct {
+	Device  string
+	Browser string
+	OS      string
+}
+
+// Known crawlers, link previewers and HTTP libraries, matched on the
+// lowercased User-Agent. The name is stored as the browser.
+var bots = []struct{ token, name string }{
+	{"googlebot", "Googlebot"},
+	{"bingbot", "Bingbot"},
+	{"yandexbot", "YandexBot"},
+	{"duckduckbot", "DuckDuckBot"},
+	{"baiduspider", "Baiduspider"},
+	{"applebot", "Applebot"},
+	{"facebookexternalhit", "Facebook"},
+	{"twitterbot", "Twitterbot"},
+	{"linkedinbot", "LinkedInBot"},
+	{"slackbot", "Slackbot"},
+	{"discordbot", "Discordbot"},
+	{"telegrambot", "TelegramBot"},
+	{"whatsapp", "WhatsApp"},
+	{"curl/", "curl"},
+	{"wget/", "Wget"},
+	{"python-requests", "python-requests"},
+	{"go-http-client", "Go-http-client"},
+	{"headlesschrome", "HeadlessChrome"},
+}
+
+// Generic markers of automated clients
+var botMarkers = []string{"bot", "crawler", "spider", "slurp", "preview", "scraper"}
+
+// Browser families, most specific first: many browsers also claim to be
+// Chrome and Safari
+var browsers = []struct{ token, name string }{
+	{"edg/", "Edge"},
+	{"edge/", "Edge"},
+	{"edga/", "Edge"},
+	{"edgios/", "Edge"},
+	{"opr/", "Opera"},
+	{"opera", "Opera"},
+	{"samsungbrowser/", "Samsung Internet"},
+	{"ucbrowser/", "UC Browser"},
+	{"yabrowser/", "Yandex"},
+	{"vivaldi/", "Vivaldi"},
+	{"fxios/", "Firefox"},
+	{"firefox/", "Firefox"},
+	{"crios/", "Chrome"},
+	{"chrome/", "Chrome"},
+	{"msie ", "Internet Explorer"},
+	{"trident/", "Internet Explorer"},
+	{"safari/", "Safari"},
+}
+
+// Operating system families, most specific first
+var systems = []struct{ token, name string }{
+	{"windows phone", "Windows Phone"},
+	{"windows", "Windows"},
+	{"iphone", "iOS"},
+	{"ipad", "iOS"},
+	{"ipod", "iOS"},
+	{"android", "Android"},
+	{"cros", "Chrome OS"},
+	{"mac os x", "macOS"},
+	{"macintosh", "macOS"},
+	{"linux", "Linux"},
+}
+
+// Parse classifies a User-Agent header. An empty header gives an empty Info.
+func Parse(userAgent string) Info {
+	ua := strings.ToLower(strings.TrimSpace(userAgent))
+	if ua == "" {
+		return Info{}
+	}
+
+	info := Info{
+		Browser: match(ua, browsers, "Other"),
+		OS:      match(ua, systems, "Other"),
+	}
+
+	if name := match(ua, bots, ""); name != "" {
+		info.Device = Bot
+		info.Browser = name
+		return info
+	}
+	for _, marker := range botMarkers {
+		if strings.Contains(ua, marker) {
+			info.Device = Bot
+			info.Browser = "Bot"
+			return info
+		}
+	}
+
+	switch {
+	case isTablet(ua):
+		info.Device = Tablet
+	case isMobile(ua):
+		info.Device = Mobile
+	default:
+		info.Device = Desktop
+	}
+	return info
+}
+
+func match(ua string, families []struct{ token, name string }, fallback string) string {
+	for _, family := range families {
+		if strings.Contains(ua, family.token) {
+			return family.name
+		}
+	}
+	return fallback
+}
+
+// Android tablets leave "mobile" out of their User-Agent
+func isTablet(ua string) bool {
+	if strings.Contains(ua, "ipad") || strings.Contains(ua, "tablet") ||
+		strings.Contains(ua, "kindle") || strings.Contains(ua, "silk/") || strings.Contains(ua, "playbook") {
+		return true
+	}
+	return strings.Contains(ua, "android") && !strings.Contains(ua, "mobile")
+}
+
+func isMobile(ua string) bool {
+	for _, token := range []string{"mobi", "iphone", "ipod", "android", "windows phone", "blackberry", "opera mini"} {
+		if strings.Contains(ua, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// Enricher classifies the User-Agent of every click in the ingestion queue
+type Enricher struct{}
+
+func (Enricher) EnrichClick(click *store.Click) {
+	info := Parse(click.UserAgent)
+	click.Device, click.Browser, click.OS = info.Device, info.Browser, info.OS
+}
@@ -0,0 +1,73 @@
+package useragent
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"url-shortener/store"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		userAgent string
+		expected  Info
+	}{
+		{
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+			Info{Desktop, "Chrome", "Windows"},
+		},
+		{
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Edg/124.0.2478.51",
+			Info{Desktop, "Edge", "Windows"},
+		},
+		{
+			"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_4_1) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4.1 Safari/605.1.15",
+			Info{Desktop, "Safari", "macOS"},
+		},
+		{
+			"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0",
+			Info{Desktop, "Firefox", "Linux"},
+		},
+		{
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/124.0.6367.88 Mobile/15E148 Safari/604.1",
+			Info{Mobile, "Chrome", "iOS"},
+		},
+		{
+			"Mozilla/5.0 (Linux; Android 14; SM-S918B) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/24.0 Chrome/117.0.0.0 Mobile Safari/537.36",
+			Info{Mobile, "Samsung Internet", "Android"},
+		},
+		{
+			"Mozilla/5.0 (iPad; CPU OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1",
+			Info{Tablet, "Safari", "iOS"},
+		},
+		{
+			"Mozilla/5.0 (Linux; Android 13; SM-X710) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+			Info{Tablet, "Chrome", "Android"},
+		},
+		{
+			"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			Info{Bot, "Googlebot", "Other"},
+		},
+		{
+			"curl/8.5.0",
+			Info{Bot, "curl", "Other"},
+		},
+		{
+			"SomeCrawler/1.0 (+https://example.com/crawler)",
+			Info{Bot, "Bot", "Other"},
+		},
+		{"", Info{}},
+	}
+
+	for _, testCase := range cases {
+		assert.Equal(t, testCase.expected, Parse(testCase.userAgent), testCase.userAgent)
+	}
+}
+
+func TestEnricher(t *testing.T) {
+	click := store.Click{UserAgent: "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0"}
+	Enricher{}.EnrichClick(&click)
+
+	assert.Equal(t, Desktop, click.Device)
+	assert.Equal(t, "Firefox", click.Browser)
+	assert.Equal(t, "Linux", click.OS)
+}